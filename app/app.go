@@ -1,17 +1,22 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"xenotification/app/bootstrap"
-	"xenotification/app/constant"
+	"xenotification/app/env"
 	"xenotification/app/kit/validator"
 	"xenotification/app/response"
 	"xenotification/app/response/errcode"
 	"xenotification/app/router"
 
+	"log/slog"
 	"math/rand"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -32,7 +37,6 @@ func Start(port string) {
 
 	e.Use(
 		middleware.Recover(),
-		middleware.Logger(),
 		middleware.RequestIDWithConfig(middleware.RequestIDConfig{
 			Generator: func() string {
 				return fmt.Sprintf("%d%d", time.Now().UnixNano(), rand.Intn(100000))
@@ -41,15 +45,47 @@ func Start(port string) {
 
 	// CORS : Allow cross site domain
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins:     constant.CORSDomain,
+		AllowOrigins:     []string{env.Config.App.SystemPath, "*"},
 		AllowMethods:     []string{echo.GET, echo.PUT, echo.POST, echo.DELETE, echo.PATCH, echo.OPTIONS, echo.HEAD},
 		AllowCredentials: true,
 		MaxAge:           24 * 60 * 60,
 	}))
 
-	router.New(e, bs)
+	r := router.New(e, bs)
 
-	e.Logger.Fatal(e.Start(":" + port))
+	go func() {
+		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
+	sig := <-quit
+
+	bs.Logger.Info("shutting down", slog.String("signal", sig.String()), slog.Duration("timeout", env.Config.App.ShutdownTimeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), env.Config.App.ShutdownTimeout)
+	defer cancel()
+
+	// Refuse new deliveries first, then let in-flight requests finish
+	r.Drain()
+	if err := e.Shutdown(ctx); err != nil {
+		bs.Logger.Error("failed to shut down http server", slog.Any("error", err))
+	}
+	if err := r.Shutdown(ctx); err != nil {
+		bs.Logger.Error("failed to drain deliveries", slog.Any("error", err))
+	}
+
+	// Connections get a fresh deadline, the drain may have used up ctx
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer closeCancel()
+
+	if err := bs.Close(closeCtx); err != nil {
+		bs.Logger.Error("failed to close connections", slog.Any("error", err))
+	}
+
+	bs.Logger.Info("shutdown complete")
 }
 
 // customErrorHandler :
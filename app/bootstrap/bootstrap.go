@@ -1,32 +1,64 @@
 package bootstrap
 
 import (
-	"context"
+	"database/sql"
+	"log/slog"
+	"xenotification/app/kit/encryption"
+	"xenotification/app/kit/health"
+	"xenotification/app/kit/heartbeat"
+	httprequest "xenotification/app/kit/httpRequest"
+	"xenotification/app/kit/idempotency"
+	"xenotification/app/kit/locker"
 	"xenotification/app/repository"
 
-	"github.com/go-redsync/redsync"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/gomodule/redigo/redis"
 	"go.mongodb.org/mongo-driver/mongo"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 // Bootstrap :
 type Bootstrap struct {
-	MongoDB    *mongo.Client
-	Repository *repository.Repository
-	Redsync    *redsync.Redsync
+	MongoDB        *mongo.Client
+	Postgres       *sql.DB
+	Repository     repository.Repository
+	Cipher         *encryption.Cipher
+	Redis          *redis.Pool
+	Locker         locker.Locker
+	RateLimitRedis *goredis.Client
+	Heartbeat      heartbeat.Store
+	Idempotency    idempotency.Store
+	HTTPClient     *httprequest.Client
+	HealthChecks   []health.Check
+	TracerProvider *sdktrace.TracerProvider
+	Logger         *slog.Logger
 }
 
 // New :
 func New() *Bootstrap {
 
 	bs := new(Bootstrap)
-	bs.initMongoDB()
-	bs.initJaeger()
+	bs.initLogger()
+	bs.initTracing()
+	bs.initEncryption()
+	bs.initRepository()
+	bs.migrate()
 	bs.initRedsync()
+	bs.initRateLimitRedis()
+	bs.initHTTPClient()
+	bs.initHealth()
 	// go bs.initCron()
 
-	repo := repository.New(context.Background(), bs.MongoDB)
+	return bs
+}
 
-	bs.Repository = repo
+// NewStorage : connects to the database only, for commands which do not serve traffic
+func NewStorage() *Bootstrap {
+
+	bs := new(Bootstrap)
+	bs.initLogger()
+	bs.initEncryption()
+	bs.initRepository()
 
 	return bs
 }
@@ -0,0 +1,45 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Close : flushes pending spans and disconnects from the database and Redis
+func (bs *Bootstrap) Close(ctx context.Context) error {
+	var result error
+
+	if bs.TracerProvider != nil {
+		if err := bs.TracerProvider.Shutdown(ctx); err != nil {
+			result = multierror.Append(result, fmt.Errorf("tracer provider: %w", err))
+		}
+	}
+
+	if bs.MongoDB != nil {
+		if err := bs.MongoDB.Disconnect(ctx); err != nil {
+			result = multierror.Append(result, fmt.Errorf("mongodb: %w", err))
+		}
+	}
+
+	if bs.Postgres != nil {
+		if err := bs.Postgres.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("postgres: %w", err))
+		}
+	}
+
+	if bs.Redis != nil {
+		if err := bs.Redis.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("redis: %w", err))
+		}
+	}
+
+	if bs.RateLimitRedis != nil {
+		if err := bs.RateLimitRedis.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("rate limit redis: %w", err))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,29 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"xenotification/app/env"
+	"xenotification/app/kit/encryption"
+)
+
+// initEncryption : loads the key-encryption keys. Production and sandbox refuse to start without them,
+// elsewhere payloads and notification keys are stored in plaintext.
+func (bs *Bootstrap) initEncryption() *Bootstrap {
+	keyring, err := encryption.LoadKeyring(env.Config.Encryption.KeyFile, env.Config.Encryption.Keys, env.Config.Encryption.ActiveKeyID)
+	if err != nil {
+		panic(fmt.Sprintf("cannot load encryption keys: %v", err))
+	}
+
+	if keyring == nil {
+		if env.IsProduction() || env.IsSandbox() {
+			panic("ENCRYPTION_KEYFILE or ENCRYPTION_KEYS is required")
+		}
+		bs.Logger.Warn("no encryption key configured, payloads and notification keys are stored in plaintext")
+		return bs
+	}
+
+	bs.Cipher = encryption.New(keyring)
+
+	return bs
+}
@@ -0,0 +1,79 @@
+package bootstrap
+
+import (
+	"context"
+
+	"xenotification/app/env"
+	"xenotification/app/kit/health"
+	"xenotification/app/kit/heartbeat"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func (bs *Bootstrap) initHealth() *Bootstrap {
+	bs.Heartbeat = heartbeat.NewRedis(bs.Redis)
+
+	// The database check depends on the configured driver, the memory driver has none
+	var checks []health.Check
+	switch {
+	case bs.MongoDB != nil:
+		checks = append(checks, health.Check{
+			Name:     "mongodb",
+			Critical: true,
+			Run: func(ctx context.Context) error {
+				return bs.MongoDB.Ping(ctx, readpref.Primary())
+			},
+		})
+	case bs.Postgres != nil:
+		checks = append(checks, health.Check{
+			Name:     "postgres",
+			Critical: true,
+			Run: func(ctx context.Context) error {
+				return bs.Postgres.PingContext(ctx)
+			},
+		})
+	}
+
+	bs.HealthChecks = append(checks, []health.Check{
+		{
+			Name:     "redis.redsync",
+			Critical: true,
+			Run: func(ctx context.Context) error {
+				conn, err := bs.Redis.GetContext(ctx)
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+
+				return ping(ctx, conn)
+			},
+		},
+		{
+			Name:     "redis.rateLimit",
+			Critical: true,
+			Run: func(ctx context.Context) error {
+				return bs.RateLimitRedis.Ping(ctx).Err()
+			},
+		},
+		{
+			// The retry sweep is triggered by an external scheduler, a stale heartbeat
+			// means retries have stopped but this instance can still serve traffic
+			Name:     "scheduler." + heartbeat.CronSendNotification,
+			Critical: false,
+			Run:      heartbeat.Check(bs.Heartbeat, heartbeat.CronSendNotification, env.Config.Health.HeartbeatMaxAge),
+		},
+		{
+			Name:     "scheduler." + heartbeat.CronRecoverNotification,
+			Critical: false,
+			Run:      heartbeat.Check(bs.Heartbeat, heartbeat.CronRecoverNotification, env.Config.Health.HeartbeatMaxAge),
+		},
+		{
+			// Retention usually runs daily, so it gets its own max age
+			Name:     "scheduler." + heartbeat.CronArchiveNotification,
+			Critical: false,
+			Run:      heartbeat.Check(bs.Heartbeat, heartbeat.CronArchiveNotification, env.Config.Retention.HeartbeatMaxAge),
+		},
+	}...)
+
+	return bs
+}
@@ -0,0 +1,41 @@
+package bootstrap
+
+import (
+	"fmt"
+	"os"
+
+	"xenotification/app/env"
+	httprequest "xenotification/app/kit/httpRequest"
+)
+
+// initHTTPClient : the client webhooks are sent with, subscriptions can override its options
+func (bs *Bootstrap) initHTTPClient() *Bootstrap {
+	config := env.Config.HTTPClient
+
+	var caBundle []byte
+	if config.CABundle != "" {
+		var err error
+		if caBundle, err = os.ReadFile(config.CABundle); err != nil {
+			panic(fmt.Sprintf("cannot read HTTP_CLIENT_CA_BUNDLE: %v", err))
+		}
+	}
+
+	client, err := httprequest.New(httprequest.Options{
+		ConnectTimeout:      config.ConnectTimeout,
+		TLSHandshakeTimeout: config.TLSHandshakeTimeout,
+		Timeout:             config.Timeout,
+		MaxResponseSize:     config.MaxResponseSize,
+		MaxRedirects:        config.MaxRedirects,
+		MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		IdleConnTimeout:     config.IdleConnTimeout,
+		ProxyURL:            config.ProxyURL,
+		CABundle:            string(caBundle),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("cannot create http client: %v", err))
+	}
+
+	bs.HTTPClient = client
+
+	return bs
+}
@@ -0,0 +1,22 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"os"
+
+	"xenotification/app/env"
+	"xenotification/app/kit/logger"
+)
+
+func (bs *Bootstrap) initLogger() *Bootstrap {
+	bs.Logger = logger.New(os.Stdout, env.Config.Log.Level, env.Config.Log.Format).
+		With(
+			slog.String("app", env.Config.App.Name),
+			slog.String("version", env.Config.App.Version),
+			slog.String("env", env.Config.App.Env),
+		)
+
+	slog.SetDefault(bs.Logger)
+
+	return bs
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"xenotification/app/env"
+	"xenotification/app/kit/tracing"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -14,6 +15,10 @@ import (
 func (bs *Bootstrap) initMongoDB() *Bootstrap {
 	ctx := context.Background()
 
+	if env.Config.Mongo.Host == "" || env.Config.Mongo.DBName == "" {
+		panic("MONGODB_HOST and MONGODB_DBNAME are required when DB_DRIVER is mongo")
+	}
+
 	// connect db
 	connStr := fmt.Sprintf(
 		"mongodb://%s:%s@%s/%s",
@@ -24,7 +29,7 @@ func (bs *Bootstrap) initMongoDB() *Bootstrap {
 		env.Config.Mongo.DBName,
 	)
 
-	client, err := mongo.NewClient(options.Client().ApplyURI(connStr))
+	client, err := mongo.NewClient(options.Client().ApplyURI(connStr).SetMonitor(tracing.NewMongoMonitor()))
 	if err != nil {
 		panic(err)
 	}
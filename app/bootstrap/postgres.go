@@ -0,0 +1,34 @@
+package bootstrap
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"xenotification/app/env"
+
+	_ "github.com/lib/pq"
+)
+
+func (bs *Bootstrap) initPostgres() *Bootstrap {
+	if env.Config.Postgres.URL == "" {
+		panic("POSTGRES_URL is required when DB_DRIVER is postgres")
+	}
+
+	db, err := sql.Open("postgres", env.Config.Postgres.URL)
+	if err != nil {
+		panic(err)
+	}
+	db.SetMaxOpenConns(env.Config.Postgres.MaxOpenConns)
+	db.SetMaxIdleConns(env.Config.Postgres.MaxOpenConns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		panic(err)
+	}
+
+	bs.Postgres = db
+
+	return bs
+}
@@ -0,0 +1,25 @@
+package bootstrap
+
+import (
+	"context"
+
+	"xenotification/app/env"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+func (bs *Bootstrap) initRateLimitRedis() *Bootstrap {
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     env.Config.Redis.Host,
+		Password: env.Config.Redis.Password,
+		DB:       1,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		panic(err)
+	}
+
+	bs.RateLimitRedis = client
+
+	return bs
+}
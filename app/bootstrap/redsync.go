@@ -1,9 +1,12 @@
 package bootstrap
 
 import (
+	"context"
 	"time"
 
 	"xenotification/app/env"
+	"xenotification/app/kit/idempotency"
+	"xenotification/app/kit/locker"
 
 	"github.com/go-redsync/redsync"
 	"github.com/gomodule/redigo/redis"
@@ -11,9 +14,11 @@ import (
 
 func (bs *Bootstrap) initRedsync() *Bootstrap {
 
-	bs.Redsync = redsync.New([]redsync.Pool{
-		getRedisPool(),
-	})
+	bs.Redis = getRedisPool()
+	bs.Locker = locker.NewRedsync(redsync.New([]redsync.Pool{
+		bs.Redis,
+	}))
+	bs.Idempotency = idempotency.NewRedis(bs.Redis)
 
 	return bs
 }
@@ -21,13 +26,21 @@ func (bs *Bootstrap) initRedsync() *Bootstrap {
 func getRedisPool() *redis.Pool {
 	url := env.Config.Redis.Host
 	password := env.Config.Redis.Password
+	timeout := env.Config.Redis.Timeout
 	database := 0
 
 	redisPool := &redis.Pool{
-		MaxIdle:   80,
-		MaxActive: 12000,
+		MaxIdle:     80,
+		MaxActive:   12000,
+		IdleTimeout: env.Config.Redis.IdleTimeout,
 		Dial: func() (redis.Conn, error) {
-			return redis.Dial("tcp", url, redis.DialPassword(password), redis.DialDatabase(database))
+			return redis.Dial("tcp", url,
+				redis.DialPassword(password),
+				redis.DialDatabase(database),
+				redis.DialConnectTimeout(timeout),
+				redis.DialReadTimeout(timeout),
+				redis.DialWriteTimeout(timeout),
+			)
 		},
 		TestOnBorrow: func(c redis.Conn, t time.Time) error {
 			_, err := c.Do("PING")
@@ -35,15 +48,27 @@ func getRedisPool() *redis.Pool {
 		},
 	}
 
-	if err := ping(redisPool.Get()); err != nil {
+	conn := redisPool.Get()
+	defer conn.Close()
+
+	if err := ping(context.Background(), conn); err != nil {
 		panic(err)
 	}
 
 	return redisPool
 }
 
-func ping(c redis.Conn) error {
-	pong, err := c.Do("PING")
+// ping : waits for the reply no longer than ctx allows
+func ping(ctx context.Context, c redis.Conn) error {
+	var (
+		pong interface{}
+		err  error
+	)
+	if deadline, ok := ctx.Deadline(); ok {
+		pong, err = redis.DoWithTimeout(c, time.Until(deadline), "PING")
+	} else {
+		pong, err = c.Do("PING")
+	}
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,58 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"xenotification/app/env"
+	"xenotification/app/repository"
+	"xenotification/app/repository/encrypted"
+	"xenotification/app/repository/memory"
+	"xenotification/app/repository/postgres"
+)
+
+// Storage drivers
+const (
+	DBDriverMongo    = "mongo"
+	DBDriverPostgres = "postgres"
+	DBDriverMemory   = "memory"
+)
+
+// initRepository : the storage is picked from DB_DRIVER. The memory driver keeps nothing
+// across restarts and is only meant for local development.
+func (bs *Bootstrap) initRepository() *Bootstrap {
+	switch env.Config.DB.Driver {
+	case DBDriverMongo:
+		bs.initMongoDB()
+		bs.Repository = repository.New(context.Background(), bs.MongoDB, bs.Logger)
+
+	case DBDriverPostgres:
+		bs.initPostgres()
+		bs.Repository = postgres.New(context.Background(), bs.Postgres, bs.Logger)
+
+	case DBDriverMemory:
+		bs.Repository = memory.New()
+
+	default:
+		panic(fmt.Sprintf("unknown db driver %q", env.Config.DB.Driver))
+	}
+
+	if bs.Cipher != nil {
+		bs.Repository = encrypted.New(bs.Repository, bs.Cipher)
+	}
+
+	return bs
+}
+
+// migrate : runs the pending migrations when DB_MIGRATE_ON_START is set
+func (bs *Bootstrap) migrate() *Bootstrap {
+	if !env.Config.DB.MigrateOnStart {
+		return bs
+	}
+
+	if err := bs.Repository.Migrate(); err != nil {
+		panic(fmt.Sprintf("cannot migrate %s: %v", env.Config.DB.Driver, err))
+	}
+
+	return bs
+}
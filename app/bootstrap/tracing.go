@@ -0,0 +1,82 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"xenotification/app/env"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Tracing exporters
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterNone   = "none"
+)
+
+// initTracing : the exporter is picked from TRACING_EXPORTER, defaulting to stdout
+// in development and OTLP (configured through the standard OTEL_EXPORTER_OTLP_* vars) elsewhere
+func (bs *Bootstrap) initTracing() *Bootstrap {
+	exporter := env.Config.Tracing.Exporter
+	if exporter == "" {
+		exporter = TracingExporterOTLP
+		if env.IsDevelopment() {
+			exporter = TracingExporterStdout
+		}
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(env.Config.App.Name),
+		semconv.ServiceVersion(env.Config.App.Version),
+		semconv.DeploymentEnvironment(env.Config.App.Env),
+	))
+	if err != nil {
+		panic(fmt.Sprintf("cannot init tracing resource: %v", err))
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(env.Config.Tracing.SampleRatio))),
+	}
+
+	switch exporter {
+	case TracingExporterOTLP:
+		exp, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			panic(fmt.Sprintf("cannot init OTLP exporter: %v", err))
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+
+	case TracingExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			panic(fmt.Sprintf("cannot init stdout exporter: %v", err))
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+
+	case TracingExporterNone:
+
+	default:
+		panic(fmt.Sprintf("unknown tracing exporter %q", exporter))
+	}
+
+	bs.TracerProvider = sdktrace.NewTracerProvider(opts...)
+
+	otel.SetTracerProvider(bs.TracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return bs
+}
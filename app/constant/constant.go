@@ -2,14 +2,54 @@ package constant
 
 import (
 	"time"
-	"xenotification/app/env"
 )
 
-var (
-	CORSDomain = []string{env.Config.App.SystemPath, "*"}
+// Webhook headers, besides the notification key they let merchants dedupe retries
+const (
+	HeaderWebhookKey        = "X-Xendit-Key"
+	HeaderWebhookEventID    = "X-Xendit-Event-Id"
+	HeaderWebhookDeliveryID = "X-Xendit-Delivery-Id"
+	HeaderWebhookAttempt    = "X-Xendit-Attempt"
+	HeaderWebhookEventType  = "X-Xendit-Event-Type"
+	HeaderWebhookCreatedAt  = "X-Xendit-Created-At"
 )
 
+// HeaderReadToken : one of ENCRYPTION_READ_TOKENS, for callers allowed to read payloads and notification keys
+const HeaderReadToken = "X-Read-Token"
+
+// HeaderActor : names who is calling the API, e.g. the dashboard user, for the subscription audit log
+const HeaderActor = "X-Actor"
+
+// EventTypeEndpointDisabled : the notification type merchants subscribe to, with a fallback endpoint, to hear about
+// their subscriptions being disabled after failing for too long
+const EventTypeEndpointDisabled = "notification.endpoint_disabled"
+
+// EventTypeVerification : the challenge sent to a subscription's new endpoint, which must answer it before
+// receiving any notification
+const EventTypeVerification = "subscription.verification"
+
 const (
-	RetryAttemptCount    = 3
-	RetryAttemptDuration = 1 * time.Minute
+	// MaxDeliveryTimeout : the longest request timeout a subscription can set, as timeoutMs
+	MaxDeliveryTimeout = 60 * time.Second
+
+	// NotificationLockExpiry : outlasts the slowest delivery, an OAuth2 token fetch and the request, both made
+	// again when the endpoint answers 401
+	NotificationLockExpiry = 4*MaxDeliveryTimeout + 30*time.Second
+
+	// StuckDeliveryTimeout : a delivery still pending after this long is considered abandoned,
+	// it must stay above the lock expiry of a delivery
+	StuckDeliveryTimeout = 5 * time.Minute
+
+	// RetentionBatchSize : notifications archived or purged per transaction
+	RetentionBatchSize = 100
+
+	// IdempotencyLease : how long a request holds its idempotency key before a retry may take over,
+	// past the request's lock expiry
+	IdempotencyLease = NotificationLockExpiry + 30*time.Second
+
+	// ResealBatchSize : records rewrapped per query by the key rotation
+	ResealBatchSize = 100
+
+	// ReleaseBatchSize : held notifications read per query when they are released
+	ReleaseBatchSize = 50
 )
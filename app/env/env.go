@@ -1,7 +1,13 @@
 package env
 
 import (
+	"crypto/subtle"
+	"os"
 	"reflect"
+	"strings"
+	"time"
+
+	"xenotification/app/types"
 
 	"github.com/caarlos0/env/v6"
 )
@@ -14,24 +20,142 @@ var Config = struct {
 		Env        string `env:"ENV,required"`
 		Port       string `env:"PORT"`
 		SystemPath string `env:"SYSTEM_PATH,required"`
+
+		ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"25s"`
+	}
+	DB struct {
+		Driver         string `env:"DB_DRIVER" envDefault:"mongo"`
+		MigrateOnStart bool   `env:"DB_MIGRATE_ON_START" envDefault:"true"`
 	}
 	Mongo struct {
-		Host     string `env:"MONGODB_HOST,required"`
-		Username string `env:"MONGODB_USERNAME,required"`
-		Password string `env:"MONGODB_PASSWORD,required"`
-		DBName   string `env:"MONGODB_DBNAME,required"`
+		Host     string `env:"MONGODB_HOST"`
+		Username string `env:"MONGODB_USERNAME"`
+		Password string `env:"MONGODB_PASSWORD"`
+		DBName   string `env:"MONGODB_DBNAME"`
+	}
+	Postgres struct {
+		URL          string `env:"POSTGRES_URL"`
+		MaxOpenConns int    `env:"POSTGRES_MAX_OPEN_CONNS" envDefault:"20"`
 	}
 	Redis struct {
 		Host     string `env:"REDIS_HOST,required"`
 		Password string `env:"REDIS_PASSWORD,required"`
+		// Timeout : bounds connecting, and each read and write
+		Timeout     time.Duration `env:"REDIS_TIMEOUT" envDefault:"5s"`
+		IdleTimeout time.Duration `env:"REDIS_IDLE_TIMEOUT" envDefault:"4m"`
+	}
+	Health struct {
+		CheckTimeout    time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s"`
+		HeartbeatMaxAge time.Duration `env:"HEALTH_HEARTBEAT_MAX_AGE" envDefault:"5m"`
+	}
+	Log struct {
+		Level  string `env:"LOG_LEVEL" envDefault:"info"`
+		Format string `env:"LOG_FORMAT" envDefault:"json"`
+	}
+	Retention struct {
+		ArchiveAfter    time.Duration       `env:"RETENTION_ARCHIVE_AFTER" envDefault:"720h"`
+		PurgeAfter      time.Duration       `env:"RETENTION_PURGE_AFTER" envDefault:"8760h"`
+		Merchants       []MerchantRetention `env:"RETENTION_MERCHANTS" envSeparator:","`
+		HeartbeatMaxAge time.Duration       `env:"RETENTION_HEARTBEAT_MAX_AGE" envDefault:"25h"`
+		// Test mode notifications have their own periods, merchant overrides only apply to live ones
+		TestArchiveAfter time.Duration `env:"RETENTION_TEST_ARCHIVE_AFTER" envDefault:"720h"`
+		TestPurgeAfter   time.Duration `env:"RETENTION_TEST_PURGE_AFTER" envDefault:"8760h"`
+	}
+	Retry struct {
+		Attempts     uint          `env:"RETRY_ATTEMPTS" envDefault:"3"`
+		Interval     time.Duration `env:"RETRY_INTERVAL" envDefault:"1m"`
+		TestAttempts uint          `env:"RETRY_TEST_ATTEMPTS" envDefault:"3"`
+		TestInterval time.Duration `env:"RETRY_TEST_INTERVAL" envDefault:"1m"`
+	}
+	HTTPClient struct {
+		ConnectTimeout      time.Duration `env:"HTTP_CLIENT_CONNECT_TIMEOUT" envDefault:"5s"`
+		TLSHandshakeTimeout time.Duration `env:"HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT" envDefault:"5s"`
+		Timeout             time.Duration `env:"HTTP_CLIENT_TIMEOUT" envDefault:"30s"`
+		MaxResponseSize     int64         `env:"HTTP_CLIENT_MAX_RESPONSE_SIZE" envDefault:"1048576"`
+		MaxRedirects        int           `env:"HTTP_CLIENT_MAX_REDIRECTS" envDefault:"0"`
+		MaxIdleConnsPerHost int           `env:"HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST" envDefault:"10"`
+		IdleConnTimeout     time.Duration `env:"HTTP_CLIENT_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+		ProxyURL            string        `env:"HTTP_CLIENT_PROXY_URL"`
+		CABundle            string        `env:"HTTP_CLIENT_CA_BUNDLE"`
+	}
+	ClientCertificate struct {
+		ExpiryWarning time.Duration `env:"CLIENT_CERTIFICATE_EXPIRY_WARNING" envDefault:"720h"`
+	}
+	Idempotency struct {
+		TTL time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	}
+	AutoDisable struct {
+		Failures int           `env:"AUTO_DISABLE_FAILURES" envDefault:"100"`
+		After    time.Duration `env:"AUTO_DISABLE_AFTER" envDefault:"72h"`
+	}
+	Encryption struct {
+		KeyFile     string `env:"ENCRYPTION_KEYFILE"`
+		Keys        string `env:"ENCRYPTION_KEYS"`
+		ActiveKeyID string `env:"ENCRYPTION_ACTIVE_KEY_ID"`
+		// ReadTokens : callers presenting one of these get the sealed fields decrypted, the others redacted
+		ReadTokens []string `env:"ENCRYPTION_READ_TOKENS" envSeparator:","`
+	}
+	Tracing struct {
+		Exporter    string  `env:"TRACING_EXPORTER"`
+		SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
 	}
 }{}
 
-func init() {
-	if err := env.ParseWithFuncs(&Config,
-		map[reflect.Type]env.ParserFunc{}); err != nil {
-		panic(err)
+// Load : reads Config from the environment, it fails when a required variable is missing
+func Load() error {
+	return LoadWith(nil)
+}
+
+// LoadWith : reads Config from the environment with the given variables on top, e.g. the required ones in tests
+func LoadWith(variables map[string]string) error {
+	opts := env.Options{}
+	if variables != nil {
+		opts.Environment = make(map[string]string)
+		for _, each := range os.Environ() {
+			if key, value, ok := strings.Cut(each, "="); ok {
+				opts.Environment[key] = value
+			}
+		}
+		for key, value := range variables {
+			opts.Environment[key] = value
+		}
+	}
+
+	return env.ParseWithFuncs(&Config,
+		map[reflect.Type]env.ParserFunc{
+			reflect.TypeOf(MerchantRetention{}): parseMerchantRetention,
+		}, opts)
+}
+
+// RetentionFor : how long the merchant's delivered notifications stay live, and how long before they are purged
+func RetentionFor(merchantID string) (archiveAfter, purgeAfter time.Duration) {
+	for _, each := range Config.Retention.Merchants {
+		if each.MerchantID == merchantID {
+			return each.ArchiveAfter, each.PurgeAfter
+		}
+	}
+	return Config.Retention.ArchiveAfter, Config.Retention.PurgeAfter
+}
+
+// RetryFor : how many attempts notifications of the mode get, and how long after a failed one the next is made
+func RetryFor(mode types.Mode) (attempts uint, interval time.Duration) {
+	if mode == types.ModeTest {
+		return Config.Retry.TestAttempts, Config.Retry.TestInterval
+	}
+	return Config.Retry.Attempts, Config.Retry.Interval
+}
+
+// CanReadSecrets : whether the token is one of the configured read tokens
+func CanReadSecrets(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, each := range Config.Encryption.ReadTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(each)) == 1 {
+			return true
+		}
 	}
+	return false
 }
 
 // IsProduction :
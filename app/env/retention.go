@@ -0,0 +1,41 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MerchantRetention : overrides the global retention for one merchant, written as merchantId:archiveAfter:purgeAfter
+type MerchantRetention struct {
+	MerchantID   string
+	ArchiveAfter time.Duration
+	PurgeAfter   time.Duration
+}
+
+func parseMerchantRetention(value string) (interface{}, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid merchant retention %q, expected merchantId:archiveAfter:purgeAfter", value)
+	}
+
+	archiveAfter, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid merchant retention %q: %w", value, err)
+	}
+
+	purgeAfter, err := time.ParseDuration(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid merchant retention %q: %w", value, err)
+	}
+
+	if purgeAfter < archiveAfter {
+		return nil, fmt.Errorf("invalid merchant retention %q, purge must come after archive", value)
+	}
+
+	return MerchantRetention{
+		MerchantID:   parts[0],
+		ArchiveAfter: archiveAfter,
+		PurgeAfter:   purgeAfter,
+	}, nil
+}
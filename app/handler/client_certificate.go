@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"xenotification/app/env"
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/response"
+	"xenotification/app/response/errcode"
+	"xenotification/app/response/transformer"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetClientCertificates :
+func (h Handler) GetClientCertificates(c echo.Context) error {
+	var input struct {
+		MerchantID string `query:"merchantId"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	certs, err := h.repository.WithContext(c.Request().Context()).FindClientCertificates(input.MerchantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	formattedCerts := make([]transformer.ClientCertificate, len(certs))
+	for i, each := range certs {
+		formattedCerts[i] = transformer.ToClientCertificate(each, env.Config.ClientCertificate.ExpiryWarning)
+	}
+
+	return c.JSON(http.StatusOK, response.Items{
+		Items: formattedCerts,
+		Count: len(formattedCerts),
+	})
+}
+
+// UploadClientCertificate : stores a PEM certificate and its private key for subscriptions to present to
+// endpoints requiring mutual TLS. The key is sealed at rest and never returned.
+func (h Handler) UploadClientCertificate(c echo.Context) error {
+
+	var input struct {
+		MerchantID  string `json:"merchantId" validate:"required"`
+		Certificate string `json:"certificate" validate:"required"`
+		PrivateKey  string `json:"privateKey" validate:"required"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	leaf, err := parseClientCertificate(input.Certificate, input.PrivateKey)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	fingerprint := sha256.Sum256(leaf.Raw)
+
+	cert := new(model.ClientCertificate)
+	cert.ID = primitive.NewObjectID()
+	cert.MerchantID = input.MerchantID
+	cert.Certificate = input.Certificate
+	cert.PrivateKey = input.PrivateKey
+	cert.Subject = leaf.Subject.String()
+	cert.Fingerprint = hex.EncodeToString(fingerprint[:])
+	cert.NotAfter = leaf.NotAfter.UTC()
+	cert.CreatedAt = time.Now().UTC()
+	cert.UpdatedAt = time.Now().UTC()
+
+	if err := h.repository.WithContext(c.Request().Context()).CreateClientCertificate(cert); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	return c.JSON(http.StatusOK, response.Item{
+		Item: transformer.ToClientCertificate(cert, env.Config.ClientCertificate.ExpiryWarning),
+	})
+}
+
+// DeleteClientCertificate : a certificate still presented by a subscription cannot be deleted
+func (h Handler) DeleteClientCertificate(c echo.Context) error {
+
+	var input struct {
+		MerchantID string `json:"merchantId" validate:"required"`
+		ID         string `json:"id" validate:"required"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	id, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	repo := h.repository.WithContext(c.Request().Context())
+
+	if _, err := repo.FindClientCertificate(id, input.MerchantID); err == repository.ErrNotFound {
+		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.ClientCertificateNotFound, err))
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	inUse, err := repo.ClientCertificateInUse(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+	if inUse {
+		return c.JSON(http.StatusConflict, response.NewException(c, errcode.ClientCertificateInUse, errors.New("move the subscriptions to another certificate first")))
+	}
+
+	if err := repo.DeleteClientCertificate(id, input.MerchantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	return c.JSON(http.StatusOK, response.Item{
+		Item: true,
+	})
+}
+
+// parseClientCertificate : checks the key matches the certificate and returns the leaf
+func parseClientCertificate(certificate, privateKey string) (*x509.Certificate, error) {
+	pair, err := tls.X509KeyPair([]byte(certificate), []byte(privateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if !time.Now().Before(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	// No extended key usage allows any use
+	if len(leaf.ExtKeyUsage) > 0 {
+		clientAuth := false
+		for _, usage := range leaf.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageClientAuth || usage == x509.ExtKeyUsageAny {
+				clientAuth = true
+			}
+		}
+		if !clientAuth {
+			return nil, errors.New("certificate is not valid for client authentication")
+		}
+	}
+
+	return leaf, nil
+}
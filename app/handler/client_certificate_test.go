@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"xenotification/app/kit/validator"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestCertificate : a certificate for client authentication signed by parent, self-signed when parent is nil
+func newTestCertificate(t *testing.T, commonName string, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	return cert, key,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestClientCertificate(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	ca, caKey, _, _ := newTestCertificate(t, "Merchant CA", time.Now().Add(24*time.Hour), nil, nil)
+	_, _, certPEM, keyPEM := newTestCertificate(t, "xenotification", time.Now().Add(365*24*time.Hour), ca, caKey)
+	_, _, expiringPEM, expiringKeyPEM := newTestCertificate(t, "expiring", time.Now().Add(24*time.Hour), ca, caKey)
+	_, _, _, otherKeyPEM := newTestCertificate(t, "other", time.Now().Add(24*time.Hour), ca, caKey)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	// Only accepts clients presenting a certificate issued by the merchant's CA
+	merchant := httptest.NewUnstartedServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":"This is success message"}`))
+	})))
+	merchant.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	merchant.StartTLS()
+	defer merchant.Close()
+
+	serverCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: merchant.Certificate().Raw}))
+
+	upload := func(certificate, privateKey string) (int, map[string]interface{}) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId":  "123456",
+			"certificate": certificate,
+			"privateKey":  privateKey,
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/client-certificate", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.UploadClientCertificate(e.NewContext(req, rec)))
+
+		var response struct {
+			Item map[string]interface{} `json:"item"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response.Item
+	}
+
+	upsert := func(typ, clientCertificateID string) (int, map[string]interface{}) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId":          "123456",
+			"type":                typ,
+			"notificationUrl":     merchant.URL,
+			"httpOptions":         map[string]interface{}{"serverCa": serverCA},
+			"clientCertificateId": clientCertificateID,
+		})
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/subscription", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.UpsertSubscription(e.NewContext(req, rec)))
+
+		var response struct {
+			Item map[string]interface{} `json:"item"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response.Item
+	}
+
+	send := func(typ string) (statusCode int) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId": "123456",
+			"requestId":  typ,
+			"type":       typ,
+			"payload":    map[string]interface{}{"amount": 100},
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if assert.NoError(t, h.SendNotification(e.NewContext(req, rec))) && assert.Equal(t, http.StatusOK, rec.Code) {
+			var response struct {
+				Item struct {
+					StatusCode int `json:"statusCode"`
+				} `json:"item"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			statusCode = response.Item.StatusCode
+		}
+		return
+	}
+
+	remove := func(id string) int {
+		data, _ := json.Marshal(map[string]interface{}{"merchantId": "123456", "id": id})
+
+		req := httptest.NewRequest(http.MethodDelete, "/v1/client-certificate", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.DeleteClientCertificate(e.NewContext(req, rec)))
+		return rec.Code
+	}
+
+	code, _ := upload(certPEM, otherKeyPEM)
+	assert.Equal(t, http.StatusUnprocessableEntity, code, "the key must match the certificate")
+
+	code, cert := upload(certPEM, keyPEM)
+	if !assert.Equal(t, http.StatusOK, code) {
+		return
+	}
+	assert.Equal(t, "CN=xenotification", cert["subject"])
+	assert.NotContains(t, cert, "privateKey")
+	assert.NotContains(t, cert, "warnings")
+
+	// The private key is only stored sealed
+	id, _ := primitive.ObjectIDFromHex(cert["id"].(string))
+	stored, err := h.repository.FindClientCertificate(id, "123456")
+	if assert.NoError(t, err) {
+		assert.Empty(t, stored.PrivateKey)
+		assert.NotNil(t, stored.Sealed)
+	}
+
+	code, _ = upsert("MTLS", primitive.NewObjectID().Hex())
+	assert.Equal(t, http.StatusUnprocessableEntity, code, "the certificate must exist")
+
+	code, subscription := upsert("MTLS", cert["id"].(string))
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, cert["id"], subscription["clientCertificate"].(map[string]interface{})["id"])
+		assert.NotContains(t, subscription, "warnings")
+	}
+	code, _ = upsert("NO_CERT", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	assert.Equal(t, http.StatusOK, send("MTLS"))
+	assert.Equal(t, 0, send("NO_CERT"), "the handshake fails without a client certificate")
+
+	assert.Equal(t, http.StatusConflict, remove(cert["id"].(string)))
+
+	// Expires within the warning window
+	code, expiring := upload(expiringPEM, expiringKeyPEM)
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Len(t, expiring["warnings"], 1)
+
+		code, subscription = upsert("MTLS", expiring["id"].(string))
+		if assert.Equal(t, http.StatusOK, code) {
+			assert.Len(t, subscription["warnings"], 1)
+		}
+	}
+
+	assert.Equal(t, http.StatusOK, remove(cert["id"].(string)))
+	assert.Equal(t, http.StatusNotFound, remove(cert["id"].(string)))
+}
@@ -1,39 +1,60 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"xenotification/app/constant"
+	"xenotification/app/env"
+	"xenotification/app/kit/heartbeat"
+	"xenotification/app/kit/tracing"
 	"xenotification/app/model"
+	"xenotification/app/repository"
 	"xenotification/app/response"
 	"xenotification/app/response/errcode"
 	"xenotification/app/types"
 
-	"github.com/go-redsync/redsync"
 	"github.com/ivpusic/grpool"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// CronSendNotification :
+// CronSendNotification : retries the failed notifications due, then releases those still held for
+// subscriptions which are active again
 func (h Handler) CronSendNotification(c echo.Context) error {
-	// Get all the failed notification attempts to be retried
+	if !h.deliveries.begin() {
+		return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, errShuttingDown))
+	}
+	defer h.deliveries.end()
+
+	cronCtx := c.Request().Context()
+
+	// Get all the failed notification attempts to be retried, each mode has its own retry policy
 	var failedNotificationsToRetry []*model.Notification
 
-	cursor := ""
-	for {
-		notifications, newCursor, err := h.repository.FindRetryNotifications(cursor)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
-		}
+	for _, mode := range storedModes {
+		policy := repository.RetryPolicy{Mode: mode}
+		policy.Attempts, policy.Interval = env.RetryFor(mode)
 
-		failedNotificationsToRetry = append(failedNotificationsToRetry, notifications...)
+		cursor := ""
+		for {
+			notifications, newCursor, err := h.repository.WithContext(cronCtx).FindRetryNotifications(policy, cursor)
+			if err != nil {
+				h.log(cronCtx).Error("failed to find notifications to retry", slog.Any("error", err))
+				return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+			}
 
-		if newCursor != "" {
-			cursor = newCursor
-		} else {
-			break
+			failedNotificationsToRetry = append(failedNotificationsToRetry, notifications...)
+
+			if newCursor != "" {
+				cursor = newCursor
+			} else {
+				break
+			}
 		}
 	}
 
@@ -46,12 +67,34 @@ func (h Handler) CronSendNotification(c echo.Context) error {
 		pool.JobQueue <- func(i int, notification *model.Notification) func() {
 			return func() {
 				defer pool.JobDone()
+
+				// Leave the rest of the queue for the next run once shutdown starts
+				if h.deliveries.isDraining() {
+					return
+				}
+
+				// Continue the producer's trace, linking back to this cron run
+				ctx := tracing.ContextWithTraceParent(cronCtx, notification.TraceParent)
+				ctx, span := tracing.Start(ctx, "notification.retry", trace.WithLinks(trace.LinkFromContext(cronCtx)))
+				defer span.End()
+
+				repo := h.repository.WithContext(ctx)
+				log := h.notificationLog(ctx, notification, notification.AttemptNo+1)
+
 				// Lock based on the request ID first
-				notificationRequestLock := h.redsync.NewMutex(fmt.Sprintf("%s-%s", notification.Type, notification.RequestID), redsync.SetExpiry(120*time.Second))
-				if err := notificationRequestLock.Lock(); err != nil {
+				notificationRequestLock, err := h.lock(ctx, notificationLockName(notification.Type, notification.RequestID, notification.Mode), constant.NotificationLockExpiry)
+				if err != nil {
+					log.Warn("skipping retry, notification is locked", slog.Any("error", err))
+					return
+				}
+				defer h.unlock(ctx, notificationRequestLock)
+
+				// Retried once the subscription is active again
+				subscription := currentSubscription(repo, notification)
+				if subscription != nil && subscription.Status != "" && subscription.Status != types.SubscriptionStatusActive {
+					log.Info("skipping retry, subscription is not active", slog.String("subscription_status", string(subscription.Status)))
 					return
 				}
-				defer notificationRequestLock.Unlock()
 
 				notificationAttempt := new(model.NotificationAttempt)
 				notificationAttempt.ID = primitive.NewObjectID()
@@ -59,25 +102,229 @@ func (h Handler) CronSendNotification(c echo.Context) error {
 				notificationAttempt.MerchantID = notification.MerchantID
 				notificationAttempt.AttemptNo = notification.AttemptNo + 1
 				notificationAttempt.Status = types.NotificationStatusPending
+				notificationAttempt.TraceParent = tracing.TraceParent(ctx)
 				notificationAttempt.CreatedAt = time.Now().UTC()
 				notificationAttempt.UpdatedAt = time.Now().UTC()
 
-				if err := h.repository.UpsertNotificationAttempt(notificationAttempt); err != nil {
+				if err := repo.UpsertNotificationAttempt(notificationAttempt); err != nil {
+					log.Error("failed to create retry attempt", slog.Any("error", err))
 					return
 				}
 
-				acceptableCodes := []int{}
-				if subscription, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: notification.MerchantID, Type: notification.Type}); err == nil {
-					acceptableCodes = subscription.AcceptableStatusCodes
-				}
+				log.Info("retrying notification")
 
 				var resp interface{}
-				h.triggerNotification(notification, acceptableCodes, &resp)
+				if _, err := h.triggerNotification(ctx, notification, subscription, &resp); err != nil {
+					log.Error("failed to retry notification", slog.Any("error", err))
+				}
 			}
 		}(l, each)
 	}
 	pool.WaitAll()
 
+	h.log(cronCtx).Info("retried failed notifications", slog.Int("count", len(failedNotificationsToRetry)))
+
+	released, err := h.releaseHeldSubscriptions(cronCtx)
+	if err != nil {
+		h.log(cronCtx).Error("failed to find held notifications to release", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+	h.log(cronCtx).Info("released held notifications", slog.Int64("count", released))
+
+	if err := h.heartbeat.Beat(cronCtx, heartbeat.CronSendNotification); err != nil {
+		h.log(cronCtx).Error("failed to record heartbeat", slog.Any("error", err))
+	}
+
 	return nil
 
 }
+
+// CronRecoverNotification : fails attempts left pending by a delivery which never finished, and hands
+// their notifications back to the retry sweep
+func (h Handler) CronRecoverNotification(c echo.Context) error {
+	if !h.deliveries.begin() {
+		return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, errShuttingDown))
+	}
+	defer h.deliveries.end()
+
+	ctx := c.Request().Context()
+	repo := h.repository.WithContext(ctx)
+	cutoff := time.Now().UTC().Add(-1 * constant.StuckDeliveryTimeout)
+
+	var stuckNotifications []*model.Notification
+
+	cursor := ""
+	for {
+		notifications, newCursor, err := repo.FindStuckNotifications(cutoff, cursor)
+		if err != nil {
+			h.log(ctx).Error("failed to find stuck notifications", slog.Any("error", err))
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+
+		stuckNotifications = append(stuckNotifications, notifications...)
+
+		if newCursor != "" {
+			cursor = newCursor
+		} else {
+			break
+		}
+	}
+
+	var stuckAttempts []*model.NotificationAttempt
+
+	cursor = ""
+	for {
+		attempts, newCursor, err := repo.FindStuckNotificationAttempts(cutoff, cursor)
+		if err != nil {
+			h.log(ctx).Error("failed to find stuck notification attempts", slog.Any("error", err))
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+
+		stuckAttempts = append(stuckAttempts, attempts...)
+
+		if newCursor != "" {
+			cursor = newCursor
+		} else {
+			break
+		}
+	}
+
+	recoveredNotifications := 0
+	for _, notification := range stuckNotifications {
+		if h.recoverNotification(ctx, notification, cutoff) {
+			recoveredNotifications++
+		}
+	}
+
+	recoveredAttempts := 0
+	for _, attempt := range stuckAttempts {
+		if h.recoverNotificationAttempt(ctx, attempt, cutoff) {
+			recoveredAttempts++
+		}
+	}
+
+	h.log(ctx).Info("recovered stuck notifications",
+		slog.Int("notifications", recoveredNotifications),
+		slog.Int("attempts", recoveredAttempts),
+	)
+
+	if err := h.heartbeat.Beat(ctx, heartbeat.CronRecoverNotification); err != nil {
+		h.log(ctx).Error("failed to record heartbeat", slog.Any("error", err))
+	}
+
+	return c.JSON(http.StatusOK, response.Item{
+		Item: map[string]int{
+			"notifications": recoveredNotifications,
+			"attempts":      recoveredAttempts,
+		},
+	})
+}
+
+// recoverNotification : fails the orphaned attempt of a pending notification and reschedules it for retry
+func (h Handler) recoverNotification(ctx context.Context, notification *model.Notification, cutoff time.Time) bool {
+	repo := h.repository.WithContext(ctx)
+	log := h.notificationLog(ctx, notification, notification.AttemptNo)
+
+	// A running delivery holds this lock, so it cannot be reaped under its feet
+	notificationRequestLock, err := h.lock(ctx, notificationLockName(notification.Type, notification.RequestID, notification.Mode), constant.NotificationLockExpiry)
+	if err != nil {
+		log.Warn("skipping recovery, notification is locked", slog.Any("error", err))
+		return false
+	}
+	defer h.unlock(ctx, notificationRequestLock)
+
+	// Check again now that the lock is held
+	notification, err = repo.FindNotificationByID(notification.ID.Hex(), notification.MerchantID)
+	if err != nil {
+		log.Error("failed to find stuck notification", slog.Any("error", err))
+		return false
+	} else if notification.Status != types.NotificationStatusPending || notification.UpdatedAt.After(cutoff) {
+		return false
+	}
+
+	now := time.Now().UTC()
+
+	lastAttempt, err := repo.FindLastNotificationAttempt(notification.ID)
+	if err != nil && err != repository.ErrNotFound {
+		log.Error("failed to find last notification attempt", slog.Any("error", err))
+		return false
+	}
+
+	// Clearing attemptedAt makes the notification due for the next retry sweep
+	notification.Status = types.NotificationStatusFailed
+	notification.AttemptedAt = nil
+	notification.UpdatedAt = now
+
+	if lastAttempt != nil && lastAttempt.Status == types.NotificationStatusPending {
+		notification.AttemptNo = lastAttempt.AttemptNo
+		abandonNotificationAttempt(lastAttempt, now)
+		err = repo.SaveNotificationAttemptResult(notification, lastAttempt)
+	} else {
+		if lastAttempt != nil {
+			notification.AttemptNo = lastAttempt.AttemptNo
+		}
+		err = repo.UpsertNotification(notification)
+	}
+	if err != nil {
+		log.Error("failed to reschedule stuck notification", slog.Any("error", err))
+		return false
+	}
+
+	log.Warn("recovered stuck notification")
+
+	return true
+}
+
+// recoverNotificationAttempt : fails a pending attempt whose outcome was never recorded
+func (h Handler) recoverNotificationAttempt(ctx context.Context, attempt *model.NotificationAttempt, cutoff time.Time) bool {
+	repo := h.repository.WithContext(ctx)
+
+	notification, err := repo.FindNotificationByID(attempt.NotificationID.Hex(), attempt.MerchantID)
+	if err != nil {
+		h.log(ctx).Error("failed to find notification of stuck attempt",
+			slog.String("notification_id", attempt.NotificationID.Hex()),
+			slog.String("attempt_id", attempt.ID.Hex()),
+			slog.Any("error", err),
+		)
+		return false
+	}
+	log := h.notificationLog(ctx, notification, attempt.AttemptNo)
+
+	notificationRequestLock, err := h.lock(ctx, notificationLockName(notification.Type, notification.RequestID, notification.Mode), constant.NotificationLockExpiry)
+	if err != nil {
+		log.Warn("skipping recovery, notification is locked", slog.Any("error", err))
+		return false
+	}
+	defer h.unlock(ctx, notificationRequestLock)
+
+	lastAttempt, err := repo.FindLastNotificationAttempt(notification.ID)
+	if err != nil {
+		log.Error("failed to find last notification attempt", slog.Any("error", err))
+		return false
+	}
+
+	// Only the latest attempt can still be in flight, older ones were superseded
+	if lastAttempt.ID == attempt.ID {
+		attempt = lastAttempt
+	}
+	if attempt.Status != types.NotificationStatusPending || attempt.UpdatedAt.After(cutoff) {
+		return false
+	}
+
+	abandonNotificationAttempt(attempt, time.Now().UTC())
+	if err := repo.UpsertNotificationAttempt(attempt); err != nil {
+		log.Error("failed to fail stuck notification attempt", slog.Any("error", err))
+		return false
+	}
+
+	log.Warn("recovered stuck notification attempt")
+
+	return true
+}
+
+func abandonNotificationAttempt(attempt *model.NotificationAttempt, now time.Time) {
+	e := fmt.Sprintf("Delivery did not complete within %s and was abandoned", constant.StuckDeliveryTimeout)
+	attempt.Status = types.NotificationStatusFailed
+	attempt.Error = &e
+	attempt.UpdatedAt = now
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"xenotification/app/kit/heartbeat"
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCronSendNotification(t *testing.T) {
+	e := echo.New()
+	h := setupTest()
+
+	attemptedAt := time.Now().UTC().Add(-2 * time.Minute)
+
+	notification := &model.Notification{
+		ID:              primitive.NewObjectID(),
+		MerchantID:      "123456",
+		RequestID:       fmt.Sprintf("%d", time.Now().UnixNano()),
+		Type:            "TEST",
+		NotificationURL: fmt.Sprintf("%s/notify", TestClientServerURL),
+		AttemptNo:       1,
+		AttemptedAt:     &attemptedAt,
+		Status:          types.NotificationStatusFailed,
+	}
+	assert.NoError(t, h.repository.UpsertNotification(notification))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/cron/resend-notification", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, h.CronSendNotification(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		retried, err := h.repository.FindNotificationByID(notification.ID.Hex(), notification.MerchantID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, types.NotificationStatusSuccess, retried.Status)
+			assert.Equal(t, uint(2), retried.AttemptNo)
+		}
+
+		_, err = h.heartbeat.Last(req.Context(), heartbeat.CronSendNotification)
+		assert.NoError(t, err)
+	}
+}
+
+func TestCronReleaseHeldNotification(t *testing.T) {
+	e := echo.New()
+	h := setupTest()
+
+	// A resume whose release was interrupted left the notification held
+	subscribe(t, h, "123456", "TEST", fmt.Sprintf("%s/notify", TestClientServerURL))
+	subscribe(t, h, "123456", "PAUSED", fmt.Sprintf("%s/notify", TestClientServerURL))
+	assert.NoError(t, h.repository.UpdateNotificationSubscriptionStatus(model.SubscriptionKey{MerchantID: "123456", Type: "PAUSED"}, types.SubscriptionStatusPaused))
+
+	held := func(typ string) *model.Notification {
+		notification := &model.Notification{
+			ID:              primitive.NewObjectID(),
+			MerchantID:      "123456",
+			RequestID:       fmt.Sprintf("%d", time.Now().UnixNano()),
+			Type:            typ,
+			NotificationURL: fmt.Sprintf("%s/notify", TestClientServerURL),
+			Status:          types.NotificationStatusHeld,
+		}
+		attempt := &model.NotificationAttempt{
+			ID:             primitive.NewObjectID(),
+			NotificationID: notification.ID,
+			MerchantID:     notification.MerchantID,
+			AttemptNo:      1,
+			Status:         types.NotificationStatusHeld,
+		}
+		assert.NoError(t, h.repository.SaveNotificationAttemptResult(notification, attempt))
+		return notification
+	}
+	active, paused := held("TEST"), held("PAUSED")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/cron/resend-notification", nil)
+	rec := httptest.NewRecorder()
+
+	if assert.NoError(t, h.CronSendNotification(e.NewContext(req, rec))) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		released, err := h.repository.FindNotificationByID(active.ID.Hex(), active.MerchantID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, types.NotificationStatusSuccess, released.Status)
+		}
+
+		stillHeld, err := h.repository.FindNotificationByID(paused.ID.Hex(), paused.MerchantID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, types.NotificationStatusHeld, stillHeld.Status)
+		}
+	}
+}
+
+func TestCronRecoverNotification(t *testing.T) {
+	e := echo.New()
+	h := setupTest()
+
+	stuckAt := time.Now().UTC().Add(-10 * time.Minute)
+
+	notification := &model.Notification{
+		ID:         primitive.NewObjectID(),
+		MerchantID: "123456",
+		RequestID:  fmt.Sprintf("%d", time.Now().UnixNano()),
+		Type:       "TEST",
+		Status:     types.NotificationStatusPending,
+		Model:      model.Model{CreatedAt: stuckAt, UpdatedAt: stuckAt},
+	}
+	attempt := &model.NotificationAttempt{
+		ID:             primitive.NewObjectID(),
+		NotificationID: notification.ID,
+		MerchantID:     notification.MerchantID,
+		AttemptNo:      1,
+		Status:         types.NotificationStatusPending,
+		Model:          model.Model{CreatedAt: stuckAt, UpdatedAt: stuckAt},
+	}
+	assert.NoError(t, h.repository.SaveNotificationAttemptResult(notification, attempt))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/cron/recover-notification", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, h.CronRecoverNotification(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Item struct {
+				Notifications int `json:"notifications"`
+				Attempts      int `json:"attempts"`
+			} `json:"item"`
+		}
+
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response)) {
+			assert.Equal(t, 1, response.Item.Notifications)
+		}
+
+		recovered, err := h.repository.FindNotificationByID(notification.ID.Hex(), notification.MerchantID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, types.NotificationStatusFailed, recovered.Status)
+			assert.Nil(t, recovered.AttemptedAt)
+		}
+
+		lastAttempt, err := h.repository.FindLastNotificationAttempt(notification.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, types.NotificationStatusFailed, lastAttempt.Status)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"xenotification/app/constant"
+	"xenotification/app/model"
+	"xenotification/app/response"
+	"xenotification/app/response/errcode"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CronRotateEncryptionKey : wraps the data key of every record sealed with a retired key with the active key,
+// and seals the records stored before encryption was enabled. Retired keys must stay in the keyring until
+// a run reports nothing left to reseal.
+func (h Handler) CronRotateEncryptionKey(c echo.Context) error {
+	if h.cipher == nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.EncryptionDisabled, errors.New("no encryption key configured")))
+	}
+
+	if !h.deliveries.begin() {
+		return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, errShuttingDown))
+	}
+	defer h.deliveries.end()
+
+	ctx := c.Request().Context()
+
+	notifications, err := h.resealNotifications(ctx)
+	if err != nil {
+		h.log(ctx).Error("failed to reseal notifications", slog.Int64("resealed", notifications), slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	subscriptions, err := h.resealNotificationSubscriptions(ctx)
+	if err != nil {
+		h.log(ctx).Error("failed to reseal subscriptions", slog.Int64("resealed", subscriptions), slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	clientCertificates, err := h.resealClientCertificates(ctx)
+	if err != nil {
+		h.log(ctx).Error("failed to reseal client certificates", slog.Int64("resealed", clientCertificates), slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	attempts, err := h.resealNotificationAttempts(ctx)
+	if err != nil {
+		h.log(ctx).Error("failed to reseal attempts", slog.Int64("resealed", attempts), slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	h.log(ctx).Info("rotated encryption key",
+		slog.String("key_id", h.cipher.ActiveKeyID()),
+		slog.Int64("notifications", notifications),
+		slog.Int64("subscriptions", subscriptions),
+		slog.Int64("client_certificates", clientCertificates),
+		slog.Int64("attempts", attempts),
+	)
+
+	return c.JSON(http.StatusOK, response.Item{
+		Item: map[string]int64{
+			"notifications":      notifications,
+			"subscriptions":      subscriptions,
+			"clientCertificates": clientCertificates,
+			"attempts":           attempts,
+		},
+	})
+}
+
+// resealNotifications : works in batches until nothing is left, stopping early once shutdown starts. Batches
+// follow on from the last record seen, those with nothing to seal would otherwise come back in every batch.
+func (h Handler) resealNotifications(ctx context.Context) (resealed int64, err error) {
+	repo := h.repository.WithContext(ctx)
+
+	var after primitive.ObjectID
+	for !h.deliveries.isDraining() {
+		notifications, err := repo.FindNotificationsToReseal(h.cipher.ActiveKeyID(), after, constant.ResealBatchSize)
+		if err != nil {
+			return resealed, err
+		}
+
+		var batch int64
+		for _, each := range notifications {
+			after = each.ID
+
+			var sealed *model.Sealed
+			if each.Sealed != nil {
+				sealed, err = h.cipher.Rewrap(each.Sealed)
+			} else if each, err = h.cipher.SealNotification(each); err == nil {
+				sealed = each.Sealed
+			}
+			if err != nil {
+				return resealed, err
+			} else if sealed == nil {
+				// Nothing to seal
+				continue
+			}
+
+			if err := repo.ResealNotification(each, sealed); err != nil {
+				return resealed, err
+			}
+			batch++
+		}
+		resealed += batch
+
+		if len(notifications) < constant.ResealBatchSize {
+			break
+		}
+	}
+
+	return resealed, nil
+}
+
+// resealNotificationSubscriptions :
+func (h Handler) resealNotificationSubscriptions(ctx context.Context) (resealed int64, err error) {
+	repo := h.repository.WithContext(ctx)
+
+	var after model.SubscriptionKey
+	for !h.deliveries.isDraining() {
+		subscriptions, err := repo.FindNotificationSubscriptionsToReseal(h.cipher.ActiveKeyID(), after, constant.ResealBatchSize)
+		if err != nil {
+			return resealed, err
+		}
+
+		var batch int64
+		for _, each := range subscriptions {
+			after = each.ID
+
+			var sealed *model.Sealed
+			previous := each.Sealed
+			if each.Sealed != nil {
+				sealed, err = h.cipher.Rewrap(each.Sealed)
+			} else if each, err = h.cipher.SealNotificationSubscription(each); err == nil {
+				sealed = each.Sealed
+			}
+			if err != nil {
+				return resealed, err
+			} else if sealed == nil {
+				continue
+			}
+
+			if err := repo.ResealNotificationSubscription(each.ID, sealed); err != nil {
+				return resealed, err
+			}
+			h.auditSubscription(ctx, each.ID, types.AuditActionReseal, systemActor, []model.SubscriptionChange{keyChange(previous, sealed)})
+			batch++
+		}
+		resealed += batch
+
+		if len(subscriptions) < constant.ResealBatchSize {
+			break
+		}
+	}
+
+	return resealed, nil
+}
+
+// resealClientCertificates :
+func (h Handler) resealClientCertificates(ctx context.Context) (resealed int64, err error) {
+	repo := h.repository.WithContext(ctx)
+
+	var after primitive.ObjectID
+	for !h.deliveries.isDraining() {
+		certs, err := repo.FindClientCertificatesToReseal(h.cipher.ActiveKeyID(), after, constant.ResealBatchSize)
+		if err != nil {
+			return resealed, err
+		}
+
+		var batch int64
+		for _, each := range certs {
+			after = each.ID
+
+			var sealed *model.Sealed
+			if each.Sealed != nil {
+				sealed, err = h.cipher.Rewrap(each.Sealed)
+			} else if each, err = h.cipher.SealClientCertificate(each); err == nil {
+				sealed = each.Sealed
+			}
+			if err != nil {
+				return resealed, err
+			} else if sealed == nil {
+				continue
+			}
+
+			if err := repo.ResealClientCertificate(each.ID, sealed); err != nil {
+				return resealed, err
+			}
+			batch++
+		}
+		resealed += batch
+
+		if len(certs) < constant.ResealBatchSize {
+			break
+		}
+	}
+
+	return resealed, nil
+}
+
+// resealNotificationAttempts : a request body stored in plain text is sealed even when the attempt also
+// carries an older Sealed
+func (h Handler) resealNotificationAttempts(ctx context.Context) (resealed int64, err error) {
+	repo := h.repository.WithContext(ctx)
+
+	var after primitive.ObjectID
+	for !h.deliveries.isDraining() {
+		attempts, err := repo.FindNotificationAttemptsToReseal(h.cipher.ActiveKeyID(), after, constant.ResealBatchSize)
+		if err != nil {
+			return resealed, err
+		}
+
+		var batch int64
+		for _, each := range attempts {
+			after = each.ID
+
+			var sealed *model.Sealed
+			if each.RequestBody == "" && each.Sealed != nil {
+				sealed, err = h.cipher.Rewrap(each.Sealed)
+			} else if each, err = h.cipher.SealNotificationAttempt(each); err == nil {
+				sealed = each.Sealed
+			}
+			if err != nil {
+				return resealed, err
+			} else if sealed == nil {
+				continue
+			}
+
+			if err := repo.ResealNotificationAttempt(each.ID, sealed); err != nil {
+				return resealed, err
+			}
+			batch++
+		}
+		resealed += batch
+
+		if len(attempts) < constant.ResealBatchSize {
+			break
+		}
+	}
+
+	return resealed, nil
+}
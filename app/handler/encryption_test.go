@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/kit/validator"
+	"xenotification/app/model"
+	"xenotification/app/repository/encrypted"
+	"xenotification/app/repository/memory"
+	"xenotification/app/response/transformer"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCronRotateEncryptionKey(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	store := memory.New()
+	h.repository = encrypted.New(store, h.cipher)
+
+	newNotification := func() *model.Notification {
+		return &model.Notification{
+			ID:              primitive.NewObjectID(),
+			MerchantID:      "123456",
+			RequestID:       primitive.NewObjectID().Hex(),
+			Type:            "TEST",
+			Payload:         map[string]interface{}{"amount": float64(100)},
+			NotificationKey: "secret",
+			Status:          types.NotificationStatusSuccess,
+			Model:           model.Model{CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()},
+		}
+	}
+
+	sealed := newNotification()
+	assert.NoError(t, h.repository.CreateNotification(sealed))
+	assert.NoError(t, store.CreateNotification(newNotification())) // Stored before encryption was enabled
+	assert.NoError(t, h.repository.UpsertNotificationSubscription(&model.NotificationSubscription{
+		ID:              model.SubscriptionKey{MerchantID: "123456", Type: "TEST"},
+		NotificationURL: TestClientServerURL + "/success",
+		NotificationKey: "secret",
+	}))
+
+	// Nothing readable is left at rest
+	stored, err := store.FindNotification(sealed.Type, sealed.RequestID, "")
+	if assert.NoError(t, err) && assert.NotNil(t, stored.Sealed) {
+		assert.Nil(t, stored.Payload)
+		assert.Empty(t, stored.NotificationKey)
+		assert.Equal(t, "test-1", stored.Sealed.KeyID)
+	}
+
+	rotate := func() (notifications, subscriptions int) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/cron/rotate-encryption-key", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, h.CronRotateEncryptionKey(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var response struct {
+				Item struct {
+					Notifications int `json:"notifications"`
+					Subscriptions int `json:"subscriptions"`
+				} `json:"item"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			return response.Item.Notifications, response.Item.Subscriptions
+		}
+		return
+	}
+
+	h.cipher = newTestCipher("test-1", "test-2")
+	h.repository = encrypted.New(store, h.cipher)
+
+	notifications, subscriptions := rotate()
+	assert.Equal(t, 2, notifications)
+	assert.Equal(t, 1, subscriptions)
+
+	notifications, subscriptions = rotate()
+	assert.Equal(t, 0, notifications)
+	assert.Equal(t, 0, subscriptions)
+
+	// Resealing is audited as such, not as a rotation of the notification key
+	audits, _, err := store.FindSubscriptionAudits("123456", "", "TEST", "", 0)
+	if assert.NoError(t, err) && assert.Len(t, audits, 1) {
+		assert.Equal(t, types.AuditActionReseal, audits[0].Action)
+		assert.Equal(t, "system", audits[0].Actor)
+		if assert.Len(t, audits[0].Changes, 1) {
+			assert.Equal(t, "encryptionKeyId", audits[0].Changes[0].Field)
+		}
+	}
+
+	// The retired key is no longer needed
+	h.cipher = newTestCipher("test-2")
+	h.repository = encrypted.New(store, h.cipher)
+
+	list := func(token string) []transformer.Notification {
+		req := httptest.NewRequest(http.MethodGet, "/v1/notifys?merchantId=123456", nil)
+		if token != "" {
+			req.Header.Set(constant.HeaderReadToken, token)
+		}
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.GetNotifications(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Items []transformer.Notification `json:"items"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response.Items
+	}
+
+	// Only a caller with a read token gets them decrypted
+	for _, token := range []string{"", "wrong"} {
+		if items := list(token); assert.Len(t, items, 2) {
+			for _, each := range items {
+				assert.Nil(t, each.Payload)
+				assert.Empty(t, each.NotificationKey)
+			}
+		}
+	}
+
+	if items := list(testReadToken); assert.Len(t, items, 2) {
+		for _, each := range items {
+			assert.Equal(t, map[string]interface{}{"amount": float64(100)}, each.Payload)
+			assert.Equal(t, "secret", each.NotificationKey)
+		}
+	}
+
+	subscription, err := store.FindNotificationSubscription(model.SubscriptionKey{MerchantID: "123456", Type: "TEST"})
+	if assert.NoError(t, err) && assert.NotNil(t, subscription.Sealed) {
+		assert.Empty(t, subscription.NotificationKey)
+		assert.Equal(t, "test-2", subscription.Sealed.KeyID)
+	}
+}
+
+func TestCronRotateEncryptionKeyPastNothingToSeal(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	store := memory.New()
+	h.repository = encrypted.New(store, h.cipher)
+
+	newNotification := func(payload interface{}) *model.Notification {
+		return &model.Notification{
+			ID:         primitive.NewObjectID(),
+			MerchantID: "123456",
+			RequestID:  primitive.NewObjectID().Hex(),
+			Type:       "TEST",
+			Payload:    payload,
+			Status:     types.NotificationStatusSuccess,
+			Model:      model.Model{CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()},
+		}
+	}
+
+	// Batches of notifications with nothing to seal come first, then one stored in plaintext
+	for i := 0; i < 2*constant.ResealBatchSize; i++ {
+		assert.NoError(t, store.CreateNotification(newNotification(nil)))
+	}
+	plain := newNotification(map[string]interface{}{"amount": float64(100)})
+	assert.NoError(t, store.CreateNotification(plain))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/cron/rotate-encryption-key", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.CronRotateEncryptionKey(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Item struct {
+			Notifications int `json:"notifications"`
+		} `json:"item"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Item.Notifications)
+
+	stored, err := store.FindNotification(plain.Type, plain.RequestID, "")
+	if assert.NoError(t, err) && assert.NotNil(t, stored.Sealed) {
+		assert.Nil(t, stored.Payload)
+	}
+}
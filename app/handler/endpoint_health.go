@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/env"
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/types"
+)
+
+// trackEndpointHealth : records the delivery's outcome on the subscription and disables it once it has kept failing
+// past the configured threshold. Only a resume re-enables it.
+func (h Handler) trackEndpointHealth(ctx context.Context, id model.SubscriptionKey, succeeded bool, at time.Time) {
+	ctx = context.WithoutCancel(ctx)
+	repo := h.repository.WithContext(ctx)
+	log := h.log(ctx).With(slog.String("merchant_id", id.MerchantID), slog.String("type", id.Type))
+
+	subscription, err := repo.RecordNotificationSubscriptionDelivery(id, succeeded, at)
+	if err == repository.ErrNotFound {
+		return // Deleted since the delivery started
+	} else if err != nil {
+		log.Error("failed to record delivery on subscription", slog.Any("error", err))
+		return
+	}
+
+	if succeeded || !shouldAutoDisable(subscription, at) {
+		return
+	}
+
+	reason := fmt.Sprintf("%d consecutive failed deliveries since %s", subscription.ConsecutiveFailures, subscription.FailingSince.Format(time.RFC3339))
+	disabled, err := repo.AutoDisableNotificationSubscription(id, reason, at)
+	if err != nil {
+		log.Error("failed to disable failing subscription", slog.Any("error", err))
+		return
+	} else if !disabled {
+		return // Paused, disabled or already taken care of by another delivery
+	}
+
+	log.Warn("disabled failing subscription",
+		slog.Int("consecutive_failures", subscription.ConsecutiveFailures),
+		slog.Time("failing_since", *subscription.FailingSince),
+	)
+
+	before := *subscription
+	subscription.Status = types.SubscriptionStatusDisabled
+	subscription.DisabledAt = &at
+	subscription.DisabledReason = reason
+	h.auditSubscriptionChange(ctx, types.AuditActionAutoDisable, systemActor, &before, subscription)
+
+	if err := h.sendEndpointDisabled(ctx, subscription); err != nil {
+		log.Error("failed to alert merchant of disabled subscription", slog.Any("error", err))
+	}
+}
+
+// shouldAutoDisable : both the number of failures and how long they have gone on must reach the thresholds,
+// so neither a burst of failures nor a single failure a while ago disables the subscription
+func shouldAutoDisable(subscription *model.NotificationSubscription, at time.Time) bool {
+	config := env.Config.AutoDisable
+	if config.Failures <= 0 || subscription.FailingSince == nil {
+		return false
+	}
+	return subscription.ConsecutiveFailures >= config.Failures && at.Sub(*subscription.FailingSince) >= config.After
+}
+
+// sendEndpointDisabled : notifies the merchant's endpoint disabled subscription in the same mode, their fallback
+// channel, like any other notification. Nothing is sent when the merchant has none, or when it is the disabled subscription itself.
+func (h Handler) sendEndpointDisabled(ctx context.Context, disabled *model.NotificationSubscription) error {
+	repo := h.repository.WithContext(ctx)
+	log := h.log(ctx).With(slog.String("merchant_id", disabled.ID.MerchantID), slog.String("type", disabled.ID.Type))
+
+	if disabled.ID.Type == constant.EventTypeEndpointDisabled {
+		log.Warn("fallback subscription disabled, the merchant cannot be alerted")
+		return nil
+	}
+
+	fallback, err := repo.FindNotificationSubscription(model.SubscriptionKey{MerchantID: disabled.ID.MerchantID, Type: constant.EventTypeEndpointDisabled, Mode: disabled.ID.Mode})
+	if err == repository.ErrNotFound {
+		log.Warn("no fallback subscription to alert the merchant of the disabled subscription")
+		return nil
+	} else if err != nil {
+		return err
+	} else if fallback.Status == types.SubscriptionStatusDisabled || fallback.Status == types.SubscriptionStatusPendingVerification {
+		log.Warn("fallback subscription is not active, the merchant cannot be alerted", slog.String("status", string(fallback.Status)))
+		return nil
+	}
+
+	// The new notification needs the plaintext key to seal it again
+	if fallback, err = h.cipher.OpenNotificationSubscription(fallback); err != nil {
+		return err
+	}
+
+	// Request IDs are unique per type, not per merchant
+	requestID := fmt.Sprintf("%s-%s-%d", disabled.ID.MerchantID, disabled.ID.Type, disabled.DisabledAt.UnixNano())
+	notification := newNotification(ctx, fallback, requestID, map[string]interface{}{
+		"merchantId":          disabled.ID.MerchantID,
+		"type":                disabled.ID.Type,
+		"notificationUrl":     disabled.NotificationURL,
+		"consecutiveFailures": disabled.ConsecutiveFailures,
+		"failingSince":        disabled.FailingSince,
+		"lastSuccessAt":       disabled.LastSuccessAt,
+		"disabledAt":          disabled.DisabledAt,
+		"reason":              disabled.DisabledReason,
+	})
+
+	if err := repo.CreateNotification(notification); err != nil {
+		return err
+	} else if notification.Status == types.NotificationStatusHeld {
+		return nil // Delivered when the fallback subscription resumes
+	}
+
+	// A failure is retried by the cron like any other notification
+	var resp interface{}
+	_, err = h.triggerNotification(ctx, notification, fallback, &resp)
+	return err
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/env"
+	"xenotification/app/kit/validator"
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionAutoDisable(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	config := env.Config.AutoDisable
+	defer func() { env.Config.AutoDisable = config }()
+	env.Config.AutoDisable.Failures = 3
+	env.Config.AutoDisable.After = time.Hour
+
+	failing := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})))
+	defer failing.Close()
+
+	var (
+		mu     sync.Mutex
+		alerts []map[string]interface{}
+	)
+	fallback := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var alert map[string]interface{}
+		json.Unmarshal(data, &alert)
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+	})))
+	defer fallback.Close()
+
+	call := func(handler echo.HandlerFunc, input map[string]interface{}) map[string]interface{} {
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return response
+	}
+	send := func(requestID string) interface{} {
+		response := call(h.SendNotification, map[string]interface{}{
+			"merchantId": "123456",
+			"requestId":  requestID,
+			"type":       "TEST",
+			"payload":    requestID,
+		})
+		if item, ok := response["item"].(map[string]interface{}); ok {
+			return item["status"]
+		}
+		return nil
+	}
+
+	call(h.UpsertSubscription, map[string]interface{}{"merchantId": "123456", "type": "TEST", "notificationUrl": failing.URL})
+	call(h.UpsertSubscription, map[string]interface{}{"merchantId": "123456", "type": constant.EventTypeEndpointDisabled, "notificationUrl": fallback.URL})
+
+	id := model.SubscriptionKey{MerchantID: "123456", Type: "TEST"}
+	stored := func() *model.NotificationSubscription {
+		subscription, err := h.repository.FindNotificationSubscription(id)
+		assert.NoError(t, err)
+		return subscription
+	}
+
+	// Enough failures, but not for long enough
+	for _, requestID := range []string{"req-1", "req-2", "req-3"} {
+		assert.Equal(t, string(types.NotificationStatusFailed), send(requestID))
+	}
+	subscription := stored()
+	assert.Equal(t, types.SubscriptionStatusActive, subscription.Status)
+	assert.Equal(t, 3, subscription.ConsecutiveFailures)
+	assert.Empty(t, alerts)
+
+	// Saving the settings again keeps the streak
+	call(h.UpsertSubscription, map[string]interface{}{"merchantId": "123456", "type": "TEST", "notificationUrl": failing.URL})
+	subscription, err := h.cipher.OpenNotificationSubscription(stored())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, subscription.ConsecutiveFailures)
+
+	failingSince := time.Now().UTC().Add(-2 * time.Hour)
+	subscription.FailingSince = &failingSince
+	assert.NoError(t, h.repository.UpsertNotificationSubscription(subscription))
+
+	assert.Equal(t, string(types.NotificationStatusFailed), send("req-4"))
+	subscription = stored()
+	assert.Equal(t, types.SubscriptionStatusDisabled, subscription.Status)
+	assert.NotNil(t, subscription.DisabledAt)
+	assert.Contains(t, subscription.DisabledReason, "4 consecutive failed deliveries")
+
+	// The merchant hears about it on the fallback subscription, once
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, "TEST", alerts[0]["type"])
+		assert.Equal(t, failing.URL, alerts[0]["notificationUrl"])
+		assert.Equal(t, float64(4), alerts[0]["consecutiveFailures"])
+	}
+	assert.Nil(t, send("req-5"))
+	assert.Len(t, alerts, 1)
+
+	// Only resuming re-enables it, with a clean slate
+	call(h.UpsertSubscription, map[string]interface{}{"merchantId": "123456", "type": "TEST", "notificationUrl": failing.URL})
+	assert.Equal(t, types.SubscriptionStatusDisabled, stored().Status)
+
+	call(h.ResumeSubscription, map[string]interface{}{"merchantId": "123456", "type": "TEST"})
+	subscription = stored()
+	assert.Equal(t, types.SubscriptionStatusActive, subscription.Status)
+	assert.Zero(t, subscription.ConsecutiveFailures)
+	assert.Nil(t, subscription.FailingSince)
+	assert.Nil(t, subscription.DisabledAt)
+	assert.Empty(t, subscription.DisabledReason)
+
+	fallbackSubscription, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: "123456", Type: constant.EventTypeEndpointDisabled})
+	if assert.NoError(t, err) {
+		assert.Zero(t, fallbackSubscription.ConsecutiveFailures)
+		assert.NotNil(t, fallbackSubscription.LastSuccessAt)
+	}
+}
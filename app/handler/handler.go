@@ -1,28 +1,58 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"xenotification/app/bootstrap"
+	"xenotification/app/constant"
 	"xenotification/app/env"
+	"xenotification/app/kit/encryption"
+	"xenotification/app/kit/health"
+	"xenotification/app/kit/heartbeat"
+	httprequest "xenotification/app/kit/httpRequest"
+	"xenotification/app/kit/locker"
+	"xenotification/app/kit/logger"
+	"xenotification/app/kit/tracing"
+	"xenotification/app/kit/webhookauth"
+	"xenotification/app/model"
 	"xenotification/app/repository"
+	"xenotification/app/response/transformer"
 
-	"github.com/go-redsync/redsync"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Handler :
 type Handler struct {
-	repository *repository.Repository
-	redsync    *redsync.Redsync
+	repository   repository.Repository
+	cipher       *encryption.Cipher
+	locker       locker.Locker
+	logger       *slog.Logger
+	heartbeat    heartbeat.Store
+	healthChecks []health.Check
+	deliveries   *deliveryTracker
+	httpClient   *httprequest.Client
+	webhookAuth  *webhookauth.Provider
 }
 
 // New :
 func New(bs *bootstrap.Bootstrap) *Handler {
 	return &Handler{
-		repository: bs.Repository,
-		redsync:    bs.Redsync,
+		repository:   bs.Repository,
+		cipher:       bs.Cipher,
+		locker:       bs.Locker,
+		logger:       bs.Logger,
+		heartbeat:    bs.Heartbeat,
+		healthChecks: bs.HealthChecks,
+		deliveries:   newDeliveryTracker(),
+		httpClient:   bs.HTTPClient,
+		webhookAuth:  webhookauth.NewProvider(bs.HTTPClient),
 	}
 }
 
@@ -32,3 +62,89 @@ func (h Handler) APIHealthCheck(c echo.Context) error {
 		"message": fmt.Sprintf("Your server version %s is running", env.Config.App.Version),
 	})
 }
+
+// APILiveness : the process is up and serving requests, dependencies are not checked
+func (h Handler) APILiveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":  health.ReportOK,
+		"version": env.Config.App.Version,
+	})
+}
+
+// APIReadiness : checks every dependency needed to serve traffic
+func (h Handler) APIReadiness(c echo.Context) error {
+	checks := append([]health.Check{{
+		Name:     "server",
+		Critical: true,
+		Run: func(ctx context.Context) error {
+			if h.deliveries.isDraining() {
+				return errShuttingDown
+			}
+			return nil
+		},
+	}}, h.healthChecks...)
+
+	report := health.Run(c.Request().Context(), env.Config.Health.CheckTimeout, checks)
+
+	if !report.Ready() {
+		h.log(c.Request().Context()).Warn("readiness check failed", slog.Any("report", report))
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// lock : acquires the named mutex, recording the wait in a span
+func (h Handler) lock(ctx context.Context, name string, expiry time.Duration) (locker.Mutex, error) {
+	_, span := tracing.Start(ctx, "lock.Lock", trace.WithAttributes(attribute.String("lock.name", name)))
+	defer span.End()
+
+	mutex := h.locker.NewMutex(name, expiry)
+	if err := mutex.Lock(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	h.deliveries.held(mutex)
+
+	return mutex, nil
+}
+
+// unlock :
+func (h Handler) unlock(ctx context.Context, mutex locker.Mutex) {
+	_, span := tracing.Start(ctx, "lock.Unlock")
+	defer span.End()
+	defer h.deliveries.released(mutex)
+
+	if ok, err := mutex.Unlock(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if !ok {
+		span.SetStatus(codes.Error, "lock was not held")
+	}
+}
+
+// opener : decrypts the sealed fields for the response when the caller presents a read token, nil redacts
+// them otherwise. The token is required whether or not encryption at rest is enabled.
+func (h Handler) opener(c echo.Context) transformer.Opener {
+	if !env.CanReadSecrets(c.Request().Header.Get(constant.HeaderReadToken)) {
+		return nil
+	}
+	return h.cipher
+}
+
+// log : returns the request scoped logger
+func (h Handler) log(ctx context.Context) *slog.Logger {
+	return logger.FromContext(ctx, h.logger)
+}
+
+// notificationLog : returns the request scoped logger annotated with the notification being delivered
+func (h Handler) notificationLog(ctx context.Context, notification *model.Notification, attemptNo uint) *slog.Logger {
+	return h.log(ctx).With(
+		slog.String("notification_id", notification.ID.Hex()),
+		slog.String("notification_request_id", notification.RequestID),
+		slog.String("merchant_id", notification.MerchantID),
+		slog.String("type", notification.Type),
+		slog.Uint64("attempt_no", uint64(attemptNo)),
+	)
+}
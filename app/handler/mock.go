@@ -2,7 +2,7 @@ package handler
 
 import (
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"xenotification/app/response"
@@ -15,15 +15,20 @@ import (
 func (h Handler) SendMockRequest(c echo.Context) error {
 	action := c.Param("action")
 
+	log := h.log(c.Request().Context())
+
 	body, err := ioutil.ReadAll(c.Request().Body)
 	if err != nil {
-		log.Printf("Error: %+v\n", err)
+		log.Error("failed to read mock request", slog.Any("error", err))
 		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
 	}
 
-	log.Printf("URL: %+v\n", c.Request().URL.Path)
-	log.Printf("HEADER: %+v\n", c.Request().Header)
-	log.Printf("REQUEST: %+v\n", string(body))
+	log.Info("mock request received",
+		slog.String("action", action),
+		slog.String("url", c.Request().URL.Path),
+		slog.Any("header", c.Request().Header),
+		slog.String("body", string(body)),
+	)
 
 	switch action {
 	case "fail":
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"fmt"
+
+	"xenotification/app/types"
+)
+
+// storedModes : every mode as stored, for the crons which handle each mode under its own policy
+var storedModes = []types.Mode{storedMode(types.ModeLive), types.ModeTest}
+
+// storedMode : live is stored empty so that live keys match the subscriptions from before modes, the API
+// defaults to it too
+func storedMode(mode types.Mode) types.Mode {
+	if mode == types.ModeLive {
+		return ""
+	}
+	return mode
+}
+
+// notificationLockName : the lock on a notification's request ID, which is only unique within its type and
+// mode. Live locks keep their name from before modes, so instances on either version exclude each other.
+func notificationLockName(typ, requestID string, mode types.Mode) string {
+	if mode == "" {
+		return fmt.Sprintf("%s-%s", typ, requestID)
+	}
+	return fmt.Sprintf("%s-%s-%s", typ, requestID, mode)
+}
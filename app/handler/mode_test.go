@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/kit/validator"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionModes(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	var (
+		mu   sync.Mutex
+		keys = make(map[string][]string)
+	)
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys[r.URL.Path] = append(keys[r.URL.Path], r.Header.Get(constant.HeaderWebhookKey))
+		mu.Unlock()
+	})))
+	defer merchant.Close()
+
+	call := func(handler echo.HandlerFunc, method, target string, input map[string]interface{}) (int, map[string]interface{}) {
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(method, target, strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(constant.HeaderReadToken, testReadToken)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+
+		var response map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response
+	}
+	item := func(response map[string]interface{}) map[string]interface{} {
+		item, _ := response["item"].(map[string]interface{})
+		return item
+	}
+	items := func(response map[string]interface{}) []interface{} {
+		items, _ := response["items"].([]interface{})
+		return items
+	}
+
+	// Same merchant and type, a subscription for each mode
+	_, live := call(h.UpsertSubscription, http.MethodPost, "/", map[string]interface{}{"merchantId": "123456", "type": "TEST", "notificationUrl": merchant.URL + "/live"})
+	_, test := call(h.UpsertSubscription, http.MethodPost, "/", map[string]interface{}{"merchantId": "123456", "type": "TEST", "mode": "TEST", "notificationUrl": merchant.URL + "/test"})
+	assert.Equal(t, string(types.ModeLive), item(live)["mode"])
+	assert.Equal(t, string(types.ModeTest), item(test)["mode"])
+	assert.NotEqual(t, item(live)["notificationKey"], item(test)["notificationKey"])
+
+	code, _ := call(h.UpsertSubscription, http.MethodPost, "/", map[string]interface{}{"merchantId": "123456", "type": "TEST", "mode": "STAGING", "notificationUrl": merchant.URL})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	// The same request ID goes to each mode's own endpoint, with its own key, neither waiting on the other's lock
+	liveLock, err := h.lock(context.Background(), notificationLockName("TEST", "req-1", ""), time.Minute)
+	assert.NoError(t, err)
+	_, sent := call(h.SendNotification, http.MethodPost, "/", map[string]interface{}{"merchantId": "123456", "requestId": "req-1", "type": "TEST", "mode": "TEST", "payload": "test"})
+	assert.Equal(t, string(types.NotificationStatusSuccess), item(sent)["status"])
+	assert.Equal(t, string(types.ModeTest), item(sent)["mode"])
+	h.unlock(context.Background(), liveLock)
+
+	_, sent = call(h.SendNotification, http.MethodPost, "/", map[string]interface{}{"merchantId": "123456", "requestId": "req-1", "type": "TEST", "payload": "live"})
+	assert.Equal(t, string(types.NotificationStatusSuccess), item(sent)["status"])
+	assert.Equal(t, string(types.ModeLive), item(sent)["mode"])
+
+	assert.Equal(t, []string{item(live)["notificationKey"].(string)}, keys["/live"])
+	assert.Equal(t, []string{item(test)["notificationKey"].(string)}, keys["/test"])
+
+	// Lists only ever show one mode
+	_, response := call(h.GetNotifications, http.MethodGet, "/v1/notifications?merchantId=123456&mode=TEST", nil)
+	if assert.Len(t, items(response), 1) {
+		assert.Equal(t, string(types.ModeTest), items(response)[0].(map[string]interface{})["mode"])
+	}
+	_, response = call(h.GetSubscriptions, http.MethodGet, "/v1/subscriptions?merchantId=123456", nil)
+	if assert.Len(t, items(response), 1) {
+		assert.Equal(t, merchant.URL+"/live", items(response)[0].(map[string]interface{})["notificationUrl"])
+	}
+
+	// Deleting the test subscription leaves the live one
+	code, _ = call(h.DeleteSubscription, http.MethodPost, "/", map[string]interface{}{"merchantId": "123456", "type": "TEST", "mode": "TEST"})
+	assert.Equal(t, http.StatusOK, code)
+	_, response = call(h.GetSubscriptions, http.MethodGet, "/v1/subscriptions?merchantId=123456&mode=TEST", nil)
+	assert.Empty(t, items(response))
+	_, response = call(h.GetSubscriptions, http.MethodGet, "/v1/subscriptions?merchantId=123456&mode=LIVE", nil)
+	assert.Len(t, items(response), 1)
+}
@@ -1,35 +1,47 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	"xenotification/app/constant"
+	"xenotification/app/kit/bodyencoding"
+	"xenotification/app/kit/filter"
 	"xenotification/app/kit/helper"
 	httprequest "xenotification/app/kit/httpRequest"
+	"xenotification/app/kit/tracing"
+	"xenotification/app/kit/transform"
 	"xenotification/app/model"
+	"xenotification/app/repository"
 	"xenotification/app/response"
 	"xenotification/app/response/errcode"
 	"xenotification/app/response/transformer"
 	"xenotification/app/types"
 
-	"github.com/go-redsync/redsync"
 	"github.com/ivpusic/grpool"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// SimulateNotification :
+// SimulateNotification : sends a sample notification through the merchant's subscription, with its URL, key,
+// authentication and transform, and returns the exchange. Nothing is stored and the subscription's delivery
+// health is left as it is.
 func (h Handler) SimulateNotification(c echo.Context) error {
 
 	var input struct {
-		MerchantID            string `json:"merchantId" validate:"required"`
-		NotificationURL       string `json:"notificationURL" validate:"required"`
-		NotificationKey       string `json:"notificationKey"`
-		AcceptableStatusCodes []int  `json:"acceptableStatusCodes"`
+		MerchantID string      `json:"merchantId" validate:"required"`
+		Type       string      `json:"type" validate:"required"`
+		Mode       types.Mode  `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
+		Payload    interface{} `json:"payload"`
 	}
 
 	if err := c.Bind(&input); err != nil {
@@ -40,26 +52,56 @@ func (h Handler) SimulateNotification(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
 	}
 
-	notification := new(model.Notification)
-	notification.ID = primitive.NewObjectID()
-	notification.MerchantID = input.MerchantID
-	notification.NotificationKey = input.NotificationKey
-	notification.Payload = "This is test from Xendit"
-	notification.NotificationURL = input.NotificationURL
+	if !h.deliveries.begin() {
+		return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, errShuttingDown))
+	}
+	defer h.deliveries.end()
+
+	ctx := c.Request().Context()
+
+	subscription, err := h.repository.WithContext(ctx).FindNotificationSubscription(model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type, Mode: storedMode(input.Mode)})
+	if err == repository.ErrNotFound {
+		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	} else if subscription.Status == types.SubscriptionStatusPendingVerification {
+		// Not proven to be the merchant's endpoint yet
+		return c.JSON(http.StatusConflict, response.NewException(c, errcode.SubscriptionNotVerified, errSubscriptionNotVerified))
+	} else if subscription.Status == types.SubscriptionStatusDisabled {
+		// Whatever disabled it, the endpoint is not sent to until it is resumed. A paused one can still be tried out.
+		return c.JSON(http.StatusConflict, response.NewException(c, errcode.SubscriptionNotActive, fmt.Errorf("subscription is %s", subscription.Status)))
+	}
+
+	// The notification is never sealed, it needs the plaintext key
+	if subscription, err = h.cipher.OpenNotificationSubscription(subscription); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	payload := input.Payload
+	if payload == nil {
+		payload = samplePayload(subscription.ID, time.Now().UTC())
+	}
+
+	notification := newNotification(ctx, subscription, "", payload)
+	notification.Status = types.NotificationStatusPending
 	notification.IsSimulation = true
-	notification.CreatedAt = time.Now().UTC()
-	notification.UpdatedAt = time.Now().UTC()
 
+	exchange := new(httprequest.Exchange)
 	var resp interface{}
-	lastAttempt, err := h.triggerNotification(notification, input.AcceptableStatusCodes, &resp)
+	lastAttempt, err := h.triggerNotification(httprequest.WithExchange(ctx, exchange), notification, subscription, &resp)
 	if err != nil {
 		return c.JSON(http.StatusBadGateway, response.NewException(c, errcode.NotificationError, err))
 	}
 
+	item, err := transformer.ToNotificationWithAttempt(notification, lastAttempt, h.opener(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
 	return c.JSON(http.StatusOK,
 		map[string]interface{}{
-			"item":     transformer.ToNotificationWithAttempt(notification, lastAttempt),
-			"response": resp,
+			"item":     item,
+			"exchange": transformer.ToWebhookExchange(exchange, subscription.Auth, lastAttempt, h.opener(c)),
 		})
 }
 
@@ -70,6 +112,7 @@ func (h Handler) SendNotification(c echo.Context) error {
 		MerchantID string      `json:"merchantId" validate:"required"`
 		RequestID  string      `json:"requestId" validate:"required"`
 		Type       string      `json:"type" validate:"required"`
+		Mode       types.Mode  `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
 		Payload    interface{} `json:"payload" validate:"required"`
 	}
 
@@ -81,13 +124,27 @@ func (h Handler) SendNotification(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
 	}
 
+	if !h.deliveries.begin() {
+		return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, errShuttingDown))
+	}
+	defer h.deliveries.end()
+
+	ctx := c.Request().Context()
+	repo := h.repository.WithContext(ctx)
+	mode := storedMode(input.Mode)
+
 	type notificationWithAttempt struct {
 		notification *model.Notification
 		lastAttempt  *model.NotificationAttempt
 	}
 
 	getNotificationWithAttempt := func(notification *model.Notification) (*notificationWithAttempt, error) {
-		lastAttempt, err := h.repository.FindLastNotificationAttempt(notification.ID)
+		// Archived attempts are not looked up, the notification has the outcome
+		if notification.ArchivedAt != nil {
+			return &notificationWithAttempt{notification: notification}, nil
+		}
+
+		lastAttempt, err := repo.FindLastNotificationAttempt(notification.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -99,36 +156,47 @@ func (h Handler) SendNotification(c echo.Context) error {
 	}
 
 	// Lock based on the request ID first
-	notificationRequestLock := h.redsync.NewMutex(fmt.Sprintf("%s-%s", input.Type, input.RequestID), redsync.SetExpiry(120*time.Second))
-	if err := notificationRequestLock.Lock(); err != nil {
+	notificationRequestLock, err := h.lock(ctx, notificationLockName(input.Type, input.RequestID, mode), constant.NotificationLockExpiry)
+	if err != nil {
 		// Try to get the notification if there is
-		notification, err := h.repository.FindNotification(input.Type, input.RequestID)
+		notification, err := findSentNotification(repo, input.Type, input.RequestID, mode)
 		if notification != nil {
 			notify, err := getNotificationWithAttempt(notification)
 			if err != nil {
 				return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotificationAttemptNotFound, err))
 			}
 
-			return c.JSON(http.StatusOK, response.Item{
-				Item: transformer.ToNotificationWithAttempt(notify.notification, notify.lastAttempt),
-			})
+			item, err := transformer.ToNotificationWithAttempt(notify.notification, notify.lastAttempt, h.opener(c))
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+			}
+
+			return c.JSON(http.StatusOK, response.Item{Item: item})
 		}
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
-	defer notificationRequestLock.Unlock()
+	defer h.unlock(ctx, notificationRequestLock)
 
 	// Check if the merchant has subscribe to the notification
-	subscription, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type})
+	subscription, err := repo.FindNotificationSubscription(model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type, Mode: mode})
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == repository.ErrNotFound {
 			return c.JSON(http.StatusOK, response.Item{Item: nil})
 		}
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	} else if subscription.Status == types.SubscriptionStatusDisabled || subscription.Status == types.SubscriptionStatusPendingVerification {
+		return c.JSON(http.StatusOK, response.Item{Item: nil})
+	}
+
+	// The subscription's key is sealed at rest, the new notification needs the plaintext to seal it again
+	subscription, err = h.cipher.OpenNotificationSubscription(subscription)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
 
 	// Check if there is notification for the request id
-	notification, err := h.repository.FindNotification(input.Type, input.RequestID)
-	if err != nil && err != mongo.ErrNoDocuments {
+	notification, err := findSentNotification(repo, input.Type, input.RequestID, mode)
+	if err != nil && err != repository.ErrNotFound {
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	} else if notification != nil {
 		notify, err := getNotificationWithAttempt(notification)
@@ -136,49 +204,112 @@ func (h Handler) SendNotification(c echo.Context) error {
 			return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotificationAttemptNotFound, err))
 		}
 
-		return c.JSON(http.StatusOK, response.Item{
-			Item: transformer.ToNotificationWithAttempt(notify.notification, notify.lastAttempt),
-		})
+		item, err := transformer.ToNotificationWithAttempt(notify.notification, notify.lastAttempt, h.opener(c))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+
+		return c.JSON(http.StatusOK, response.Item{Item: item})
 	}
 
 	// Create notification
-	notification = new(model.Notification)
-	notification.ID = primitive.NewObjectID()
-	notification.MerchantID = input.MerchantID
-	notification.RequestID = input.RequestID
-	notification.Type = input.Type
-	notification.Payload = input.Payload
-	notification.NotificationKey = subscription.NotificationKey
-	notification.NotificationURL = subscription.NotificationURL
-	notification.Status = types.NotificationStatusPending
-	notification.CreatedAt = time.Now().UTC()
-	notification.UpdatedAt = time.Now().UTC()
+	notification = newNotification(ctx, subscription, input.RequestID, input.Payload)
+
+	if err := repo.CreateNotification(notification); err == repository.ErrDuplicate {
+		// Another instance created it since the lookup above, e.g. after the lock expired
+		existing, err := repo.FindNotification(input.Type, input.RequestID, mode)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+		notify, err := getNotificationWithAttempt(existing)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotificationAttemptNotFound, err))
+		}
 
-	if err := h.repository.CreateNotification(notification); err != nil {
+		item, err := transformer.ToNotificationWithAttempt(notify.notification, notify.lastAttempt, h.opener(c))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+
+		return c.JSON(http.StatusOK, response.Item{Item: item})
+	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
 
+	// Delivered when the subscription resumes
+	if notification.Status == types.NotificationStatusHeld {
+		notify, err := getNotificationWithAttempt(notification)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotificationAttemptNotFound, err))
+		}
+
+		item, err := transformer.ToNotificationWithAttempt(notify.notification, notify.lastAttempt, h.opener(c))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+
+		return c.JSON(http.StatusOK, response.Item{Item: item})
+	}
+
 	var resp interface{}
-	lastAttempt, err := h.triggerNotification(notification, subscription.AcceptableStatusCodes, &resp)
+	lastAttempt, err := h.triggerNotification(ctx, notification, subscription, &resp)
 	if err != nil {
 		return c.JSON(http.StatusBadGateway, response.NewException(c, errcode.NotificationError, err))
 	}
 
+	item, err := transformer.ToNotificationWithAttempt(notification, lastAttempt, h.opener(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
 	return c.JSON(http.StatusOK,
 		map[string]interface{}{
-			"item":     transformer.ToNotificationWithAttempt(notification, lastAttempt),
+			"item":     item,
 			"response": resp,
 		})
 }
 
+// findSentNotification : the notification sent before with the request ID, looked up in the archive too so a
+// replay after retention moved it does not send it again
+func findSentNotification(repo repository.Repository, typ, requestID string, mode types.Mode) (*model.Notification, error) {
+	notification, err := repo.FindNotification(typ, requestID, mode)
+	if err != repository.ErrNotFound {
+		return notification, err
+	}
+	return repo.FindArchivedNotification(typ, requestID, mode)
+}
+
+// newNotification : a notification to deliver with the subscription's settings, held while it is paused
+func newNotification(ctx context.Context, subscription *model.NotificationSubscription, requestID string, payload interface{}) *model.Notification {
+	notification := new(model.Notification)
+	notification.ID = primitive.NewObjectID()
+	notification.MerchantID = subscription.ID.MerchantID
+	notification.RequestID = requestID
+	notification.Type = subscription.ID.Type
+	notification.Mode = subscription.ID.Mode
+	notification.Payload = payload
+	notification.NotificationKey = subscription.NotificationKey
+	notification.NotificationURL = subscription.NotificationURL
+	notification.PayloadFormat = subscription.PayloadFormat
+	notification.Status = types.NotificationStatusPending
+	if subscription.Status == types.SubscriptionStatusPaused {
+		notification.Status = types.NotificationStatusHeld
+	}
+	notification.TraceParent = tracing.TraceParent(ctx)
+	notification.CreatedAt = time.Now().UTC()
+	notification.UpdatedAt = time.Now().UTC()
+	return notification
+}
+
 // ResendNotification :
 func (h Handler) ResendNotification(c echo.Context) error {
 
 	var input struct {
-		MerchantID      string `json:"merchantId" validate:"required"`
-		Type            string `json:"type" validate:"required"`
-		RequestID       string `json:"requestId" validate:"required"`
-		NotificationURL string `json:"notificationUrl" validate:"omitempty"`
+		MerchantID      string     `json:"merchantId" validate:"required"`
+		Type            string     `json:"type" validate:"required"`
+		Mode            types.Mode `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
+		RequestID       string     `json:"requestId" validate:"required"`
+		NotificationURL string     `json:"notificationUrl" validate:"omitempty"`
 	}
 
 	if err := c.Bind(&input); err != nil {
@@ -189,14 +320,22 @@ func (h Handler) ResendNotification(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
 	}
 
+	if !h.deliveries.begin() {
+		return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, errShuttingDown))
+	}
+	defer h.deliveries.end()
+
+	ctx := c.Request().Context()
+	repo := h.repository.WithContext(ctx)
+
 	// Lock based on the request ID first
-	notificationRequestLock := h.redsync.NewMutex(fmt.Sprintf("%s-%s", input.Type, input.RequestID), redsync.SetExpiry(30*time.Second))
-	if err := notificationRequestLock.Lock(); err != nil {
+	notificationRequestLock, err := h.lock(ctx, notificationLockName(input.Type, input.RequestID, storedMode(input.Mode)), constant.NotificationLockExpiry)
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
-	defer notificationRequestLock.Unlock()
+	defer h.unlock(ctx, notificationRequestLock)
 
-	notification, err := h.repository.FindNotification(input.Type, input.RequestID)
+	notification, err := repo.FindNotification(input.Type, input.RequestID, storedMode(input.Mode))
 	if err != nil {
 		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
 	} else if notification.MerchantID != input.MerchantID {
@@ -205,6 +344,18 @@ func (h Handler) ResendNotification(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.OnlyFailedNotificationCanRetry, errors.New("Only failed notification can be retried")))
 	}
 
+	// Like the retry cron, only an active subscription is sent to
+	subscription := currentSubscription(repo, notification)
+	if subscription != nil {
+		switch subscription.Status {
+		case "", types.SubscriptionStatusActive:
+		case types.SubscriptionStatusPendingVerification:
+			return c.JSON(http.StatusConflict, response.NewException(c, errcode.SubscriptionNotVerified, errSubscriptionNotVerified))
+		default:
+			return c.JSON(http.StatusConflict, response.NewException(c, errcode.SubscriptionNotActive, fmt.Errorf("subscription is %s", subscription.Status)))
+		}
+	}
+
 	// Check if it's a valid url
 	if input.NotificationURL != "" {
 		if _, err := url.ParseRequestURI(input.NotificationURL); err != nil {
@@ -219,53 +370,120 @@ func (h Handler) ResendNotification(c echo.Context) error {
 	notificationAttempt.MerchantID = notification.MerchantID
 	notificationAttempt.AttemptNo = notification.AttemptNo + 1
 	notificationAttempt.Status = types.NotificationStatusPending
+	notificationAttempt.TraceParent = tracing.TraceParent(ctx)
 	notificationAttempt.CreatedAt = time.Now().UTC()
 	notificationAttempt.UpdatedAt = time.Now().UTC()
 
-	if err := h.repository.UpsertNotificationAttempt(notificationAttempt); err != nil {
+	if err := repo.UpsertNotificationAttempt(notificationAttempt); err != nil {
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
 
-	acceptableCodes := []int{}
-	if subscription, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: notification.MerchantID, Type: notification.Type}); err == nil {
-		acceptableCodes = subscription.AcceptableStatusCodes
-	}
-
 	var resp interface{}
-	lastAttempt, err := h.triggerNotification(notification, acceptableCodes, &resp)
+	lastAttempt, err := h.triggerNotification(ctx, notification, subscription, &resp)
 	if err != nil {
 		return c.JSON(http.StatusBadGateway, response.NewException(c, errcode.NotificationError, err))
 	}
 
+	item, err := transformer.ToNotificationWithAttempt(notification, lastAttempt, h.opener(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
 	return c.JSON(http.StatusOK,
 		map[string]interface{}{
-			"item":     transformer.ToNotificationWithAttempt(notification, lastAttempt),
+			"item":     item,
 			"response": resp,
 		})
 }
 
-func (h Handler) triggerNotification(notification *model.Notification, acceptableStatusCodes []int, resp interface{}) (*model.NotificationAttempt, error) {
-	headers := map[string]string{
-		"X-Xendit-Key": notification.NotificationKey,
+// triggerNotification : delivers the notification with the subscription's acceptable status codes and HTTP options,
+// the defaults apply when subscription is nil
+func (h Handler) triggerNotification(ctx context.Context, notification *model.Notification, subscription *model.NotificationSubscription, resp interface{}) (*model.NotificationAttempt, error) {
+	ctx, span := tracing.Start(ctx, "notification.deliver", trace.WithAttributes(
+		attribute.String("notification.id", notification.ID.Hex()),
+		attribute.String("notification.merchant_id", notification.MerchantID),
+		attribute.String("notification.type", notification.Type),
+		attribute.Bool("notification.simulation", notification.IsSimulation),
+	))
+	defer span.End()
+
+	repo := h.repository.WithContext(ctx)
+
+	// Stored notifications are sealed, only the outgoing request carries the plaintext
+	opened, err := h.cipher.OpenNotification(notification)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		h.notificationLog(ctx, notification, notification.AttemptNo).Error("failed to open notification", slog.Any("error", err))
+		return nil, err
 	}
-	statusCode, notificationErr := httprequest.HttpAPI(http.MethodPost, notification.NotificationURL, headers, notification.Payload, &resp)
 
-	// time.Sleep(60 * time.Second)
+	if subscription != nil {
+		if subscription, err = h.cipher.OpenNotificationSubscription(subscription); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			h.notificationLog(ctx, notification, notification.AttemptNo).Error("failed to open subscription", slog.Any("error", err))
+			return nil, err
+		}
+	}
 
 	var lastAttempt *model.NotificationAttempt
 	if !notification.IsSimulation {
-		var err error
-		lastAttempt, err = h.repository.FindLastNotificationAttempt(notification.ID)
+		lastAttempt, err = repo.FindLastNotificationAttempt(notification.ID)
 		if err != nil {
+			h.notificationLog(ctx, notification, notification.AttemptNo).Error("failed to find last notification attempt", slog.Any("error", err))
 			return nil, err
 		}
 	} else {
 		lastAttempt = new(model.NotificationAttempt)
+		lastAttempt.ID = primitive.NewObjectID()
 		lastAttempt.NotificationID = notification.ID
 		lastAttempt.MerchantID = notification.MerchantID
+		lastAttempt.AttemptNo = 1
 	}
 
+	// The event ID stays the same across retries, the delivery ID changes with every attempt
+	headers := map[string]string{
+		constant.HeaderWebhookKey:        opened.NotificationKey,
+		constant.HeaderWebhookEventID:    opened.ID.Hex(),
+		constant.HeaderWebhookDeliveryID: lastAttempt.ID.Hex(),
+		constant.HeaderWebhookAttempt:    strconv.FormatUint(uint64(lastAttempt.AttemptNo), 10),
+		constant.HeaderWebhookEventType:  opened.Type,
+		constant.HeaderWebhookCreatedAt:  opened.CreatedAt.Format(time.RFC3339),
+	}
+
+	// A payload the subscription's filters reject is recorded as filtered rather than sent
+	filtered := false
+	if subscription != nil {
+		matched, err := filter.Match(subscription.Filters, opened.Payload)
+		if err != nil {
+			h.notificationLog(ctx, notification, lastAttempt.AttemptNo).Error("failed to evaluate subscription filters", slog.Any("error", err))
+			return nil, err
+		}
+		filtered = !matched
+	}
+
+	var body interface{} = opened.Payload
+	if opened.PayloadFormat == types.PayloadFormatEnvelope {
+		body = transformer.ToWebhookEnvelope(opened)
+	}
+
+	var (
+		statusCode      int
+		notificationErr error
+	)
+	if !filtered {
+		statusCode, notificationErr = h.deliver(ctx, repo, subscription, lastAttempt, opened.NotificationURL, headers, body, &resp)
+	}
+
+	// time.Sleep(60 * time.Second)
+
 	now := time.Now().UTC()
+	var acceptableStatusCodes []int
+	if subscription != nil {
+		acceptableStatusCodes = subscription.AcceptableStatusCodes
+	}
+
 	isSuccess := false
 	if len(acceptableStatusCodes) > 0 {
 		isSuccess = helper.Contains(acceptableStatusCodes, statusCode)
@@ -273,7 +491,9 @@ func (h Handler) triggerNotification(notification *model.Notification, acceptabl
 		isSuccess = statusCode < 400 && statusCode >= 200
 	}
 
-	if isSuccess {
+	if filtered {
+		lastAttempt.Status = types.NotificationStatusFiltered
+	} else if isSuccess {
 		lastAttempt.Status = types.NotificationStatusSuccess
 		lastAttempt.StatusCode = statusCode
 		lastAttempt.SentAt = &now
@@ -286,6 +506,24 @@ func (h Handler) triggerNotification(notification *model.Notification, acceptabl
 		}
 	}
 
+	span.SetAttributes(
+		attribute.Int("notification.attempt_no", int(lastAttempt.AttemptNo)),
+		attribute.Int("notification.status_code", statusCode),
+	)
+	log := h.notificationLog(ctx, notification, lastAttempt.AttemptNo).With(
+		slog.Int("status_code", statusCode),
+		slog.Bool("simulation", notification.IsSimulation),
+	)
+	if filtered {
+		log.Info("notification filtered")
+	} else if isSuccess {
+		log.Info("notification delivered")
+	} else {
+		span.SetStatus(codes.Error, "notification was not accepted")
+		log.Warn("notification delivery failed", slog.Any("error", notificationErr))
+	}
+
+	lastAttempt.TraceParent = tracing.TraceParent(ctx)
 	lastAttempt.UpdatedAt = time.Now().UTC()
 	notification.AttemptNo = lastAttempt.AttemptNo
 	notification.AttemptedAt = &now
@@ -293,45 +531,235 @@ func (h Handler) triggerNotification(notification *model.Notification, acceptabl
 	notification.UpdatedAt = time.Now().UTC()
 
 	if !notification.IsSimulation {
-		go h.repository.UpsertNotification(notification)
-		go h.repository.UpsertNotificationAttempt(lastAttempt)
+		// Detach from the request so a client hanging up does not abort the write halfway
+		if err := h.repository.WithContext(context.WithoutCancel(ctx)).SaveNotificationAttemptResult(notification, lastAttempt); err != nil {
+			log.Error("failed to save notification attempt result", slog.Any("error", err))
+			return nil, err
+		}
+
+		if subscription != nil && !filtered {
+			h.trackEndpointHealth(ctx, subscription.ID, isSuccess, now)
+		}
 	}
 
 	return lastAttempt, nil
 }
 
+// deliver : sends the webhook. A body which cannot be encoded or a client certificate which cannot be loaded
+// fails the attempt without contacting the endpoint.
+func (h Handler) deliver(ctx context.Context, repo repository.Repository, subscription *model.NotificationSubscription, attempt *model.NotificationAttempt, url string, headers map[string]string, body interface{}, resp interface{}) (int, error) {
+	method, rendered, data, err := encodeWebhook(subscription, body, headers)
+	if subscription != nil && subscription.Transform != nil {
+		// What the endpoint received is no longer derivable from the payload
+		attempt.RequestBody = string(rendered)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	opts := h.httpOptions(subscription)
+	if err := h.withClientCertificate(repo, subscription, &opts); err != nil {
+		return 0, err
+	}
+
+	return h.send(ctx, subscription, opts, method, url, headers, data, resp)
+}
+
+// encodeWebhook : the method and body the subscription asks for, setting the content headers. The rendered
+// body is the one before compression.
+func encodeWebhook(subscription *model.NotificationSubscription, body interface{}, headers map[string]string) (method string, rendered, data []byte, err error) {
+	if method, rendered, err = renderWebhook(subscription, body, headers); err != nil {
+		return "", nil, nil, err
+	}
+
+	data = rendered
+	if subscription != nil && subscription.Gzip {
+		if data, err = bodyencoding.Gzip(data); err != nil {
+			return "", nil, nil, err
+		}
+		headers["Content-Encoding"] = "gzip"
+	}
+
+	return method, rendered, data, nil
+}
+
+// renderWebhook : the body reshaped by the subscription's transform and encoded, setting the Content-Type
+func renderWebhook(subscription *model.NotificationSubscription, body interface{}, headers map[string]string) (string, []byte, error) {
+	method := http.MethodPost
+	if subscription == nil {
+		subscription = new(model.NotificationSubscription)
+	} else if subscription.Method != "" {
+		method = subscription.Method
+	}
+
+	if subscription.Transform != nil {
+		transformed, err := transform.Apply(subscription.Transform, body)
+		if err != nil {
+			return "", nil, fmt.Errorf("transform: %w", err)
+		}
+		body = transformed
+	}
+
+	data, contentType, err := bodyencoding.Encode(subscription.BodyEncoding, body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	headers["Content-Type"] = contentType
+	if subscription.ContentType != "" {
+		headers["Content-Type"] = subscription.ContentType
+	}
+
+	return method, data, nil
+}
+
+// send : sends the webhook with the subscription's credentials, and once more with refreshed ones
+// when the endpoint answers 401
+func (h Handler) send(ctx context.Context, subscription *model.NotificationSubscription, opts httprequest.Options, method, url string, headers map[string]string, body []byte, resp interface{}) (int, error) {
+	var auth *model.SubscriptionAuth
+	if subscription != nil {
+		auth = subscription.Auth
+	}
+
+	// The pinned server CA is for the webhook endpoint, the token URL is often hosted elsewhere
+	tokenOpts := opts
+	tokenOpts.RootCAs = ""
+
+	authenticator, err := h.webhookAuth.Authenticator(auth, tokenOpts)
+	if err != nil {
+		return 0, err
+	}
+
+	for retried := false; ; retried = true {
+		outgoing := make(map[string]string, len(headers))
+		for name, value := range headers {
+			outgoing[name] = value
+		}
+		// A token request is not the webhook's exchange, and carries the client secret
+		if err := authenticator.Apply(httprequest.WithExchange(ctx, nil), outgoing); err != nil {
+			return 0, err
+		}
+
+		statusCode, err := h.httpClient.HttpAPI(ctx, opts, method, url, outgoing, body, resp)
+		if err != nil || statusCode != http.StatusUnauthorized || retried || !authenticator.Refresh() {
+			return statusCode, err
+		}
+	}
+}
+
+// currentSubscription : the notification's subscription as it is now, nil when it has been deleted since
+func currentSubscription(repo repository.Repository, notification *model.Notification) *model.NotificationSubscription {
+	subscription, err := repo.FindNotificationSubscription(model.SubscriptionKey{MerchantID: notification.MerchantID, Type: notification.Type, Mode: notification.Mode})
+	if err != nil {
+		return nil
+	}
+	return subscription
+}
+
+// httpOptions : the client defaults with the subscription's overrides applied
+func (h Handler) httpOptions(subscription *model.NotificationSubscription) httprequest.Options {
+	opts := h.httpClient.Defaults()
+	if subscription == nil || subscription.HTTPOptions == nil {
+		return opts
+	}
+
+	override := subscription.HTTPOptions
+	if override.Timeout > 0 {
+		opts.Timeout = override.Timeout
+	}
+	if override.MaxResponseSize > 0 {
+		opts.MaxResponseSize = override.MaxResponseSize
+	}
+	if override.MaxRedirects != nil {
+		opts.MaxRedirects = *override.MaxRedirects
+	}
+	if override.ProxyURL != "" {
+		opts.ProxyURL = override.ProxyURL
+	}
+	if override.CABundle != "" {
+		opts.CABundle = override.CABundle
+	}
+	if override.ServerCA != "" {
+		opts.RootCAs = override.ServerCA
+	}
+
+	return opts
+}
+
+// withClientCertificate : adds the certificate the subscription presents to opts, its key is only opened here
+func (h Handler) withClientCertificate(repo repository.Repository, subscription *model.NotificationSubscription, opts *httprequest.Options) error {
+	if subscription == nil || subscription.ClientCertificateID == nil {
+		return nil
+	}
+
+	cert, err := repo.FindClientCertificate(*subscription.ClientCertificateID, subscription.ID.MerchantID)
+	if err != nil {
+		return fmt.Errorf("client certificate %s: %w", subscription.ClientCertificateID.Hex(), err)
+	}
+
+	opened, err := h.cipher.OpenClientCertificate(cert)
+	if err != nil {
+		return fmt.Errorf("client certificate %s: %w", subscription.ClientCertificateID.Hex(), err)
+	}
+
+	opts.ClientCertificate = opened.Certificate
+	opts.ClientKey = opened.PrivateKey
+	return nil
+}
+
 // GetNotifications :
 func (h Handler) GetNotifications(c echo.Context) error {
 	var input struct {
-		MerchantID string `query:"merchantId"`
-		Cursor     string `query:"cursor"`
-		Limit      int64  `query:"limit"`
+		MerchantID string     `query:"merchantId"`
+		Mode       types.Mode `query:"mode" validate:"omitempty,oneof=LIVE TEST"`
+		Cursor     string     `query:"cursor"`
+		Limit      int64      `query:"limit"`
+		Archived   bool       `query:"archived"`
 	}
 
 	if err := c.Bind(&input); err != nil {
 		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
 	}
 
-	notifications, cursor, err := h.repository.FindNotifications(input.MerchantID, input.Cursor, input.Limit)
-	if err != nil && err != mongo.ErrNoDocuments {
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	repo := h.repository.WithContext(c.Request().Context())
+	findNotifications := repo.FindNotifications
+	if input.Archived {
+		findNotifications = repo.FindArchivedNotifications
+	}
+
+	notifications, cursor, err := findNotifications(input.MerchantID, storedMode(input.Mode), input.Cursor, input.Limit)
+	if err != nil && err != repository.ErrNotFound {
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
 
 	pool := grpool.NewPool(20, 20)
 	defer pool.Release()
 
+	opener := h.opener(c)
+
 	pool.WaitCount(len(notifications))
 	formattedNotifications := make([]transformer.Notification, len(notifications))
+	errs := make([]error, len(notifications))
 	for l, each := range notifications {
 		pool.JobQueue <- func(i int, not *model.Notification) func() {
 			return func() {
 				defer pool.JobDone()
-				formattedNotifications[i] = transformer.ToNotification(not)
+				formattedNotifications[i], errs[i] = transformer.ToNotification(not, opener)
 			}
 		}(l, each)
 	}
 	pool.WaitAll()
 
+	for _, err := range errs {
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+	}
+
 	return c.JSON(http.StatusOK, response.Items{
 		Items:  formattedNotifications,
 		Count:  len(formattedNotifications),
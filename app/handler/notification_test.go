@@ -3,17 +3,22 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"xenotification/app/constant"
 	"xenotification/app/kit/validator"
+	"xenotification/app/model"
 	"xenotification/app/response/transformer"
+	"xenotification/app/types"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestSimulateSuccessfulNotification(t *testing.T) {
@@ -21,19 +26,21 @@ func TestSimulateSuccessfulNotification(t *testing.T) {
 	e.Validator = validator.New()
 	h := setupTest()
 
+	subscribe(t, h, "123456", "TEST", fmt.Sprintf("%s/notify", TestClientServerURL))
+
 	var input struct {
-		MerchantID      string `json:"merchantId"`
-		NotificationURL string `json:"notificationURL"`
-		NotificationKey string `json:"notificationKey"`
+		MerchantID string `json:"merchantId"`
+		Type       string `json:"type"`
 	}
 
 	input.MerchantID = "123456"
-	input.NotificationURL = fmt.Sprintf("%s/notify", TestClientServerURL)
+	input.Type = "TEST"
 
 	data, _ := json.Marshal(input)
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/notify/simulate", strings.NewReader(string(data)))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(constant.HeaderReadToken, testReadToken)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -46,12 +53,25 @@ func TestSimulateSuccessfulNotification(t *testing.T) {
 			Item struct {
 				StatusCode int `json:"statusCode"`
 			} `json:"item"`
+			Exchange transformer.WebhookExchange `json:"exchange"`
 		}
 
 		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response)) {
 			assert.Equal(t, http.StatusOK, response.Item.StatusCode)
+			if assert.NotNil(t, response.Exchange.Request) && assert.NotNil(t, response.Exchange.Response) {
+				assert.Equal(t, fmt.Sprintf("%s/notify", TestClientServerURL), response.Exchange.Request.URL)
+				assert.Equal(t, "TEST", response.Exchange.Request.Headers[constant.HeaderWebhookEventType])
+				assert.Contains(t, response.Exchange.Request.Body, `"type":"TEST"`)
+				assert.Equal(t, http.StatusOK, response.Exchange.Response.StatusCode)
+				assert.Contains(t, response.Exchange.Response.Body, "This is success message")
+			}
 		}
 	}
+
+	// Nothing is stored
+	notifications, _, err := h.repository.FindNotifications("123456", "", "", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, notifications)
 }
 
 func TestSimulateFailedNotification(t *testing.T) {
@@ -59,19 +79,23 @@ func TestSimulateFailedNotification(t *testing.T) {
 	e.Validator = validator.New()
 	h := setupTest()
 
+	subscribe(t, h, "123456", "TEST", fmt.Sprintf("%s/fail", TestClientServerURL))
+
 	var input struct {
-		MerchantID      string `json:"merchantId"`
-		NotificationURL string `json:"notificationURL"`
-		NotificationKey string `json:"notificationKey"`
+		MerchantID string      `json:"merchantId"`
+		Type       string      `json:"type"`
+		Payload    interface{} `json:"payload"`
 	}
 
 	input.MerchantID = "123456"
-	input.NotificationURL = fmt.Sprintf("%s/fail", TestClientServerURL)
+	input.Type = "TEST"
+	input.Payload = map[string]interface{}{"id": "inv-1"}
 
 	data, _ := json.Marshal(input)
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/notify/simulate", strings.NewReader(string(data)))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(constant.HeaderReadToken, testReadToken)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -84,11 +108,118 @@ func TestSimulateFailedNotification(t *testing.T) {
 			Item struct {
 				StatusCode int `json:"statusCode"`
 			} `json:"item"`
+			Exchange transformer.WebhookExchange `json:"exchange"`
 		}
 
 		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response)) {
 			assert.Equal(t, http.StatusMethodNotAllowed, response.Item.StatusCode)
+			if assert.NotNil(t, response.Exchange.Request) && assert.NotNil(t, response.Exchange.Response) {
+				assert.Equal(t, `{"id":"inv-1"}`, response.Exchange.Request.Body)
+				assert.Equal(t, http.StatusMethodNotAllowed, response.Exchange.Response.StatusCode)
+			}
+		}
+	}
+
+	// The failure does not count against the subscription
+	subscription, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: "123456", Type: "TEST"})
+	if assert.NoError(t, err) {
+		assert.Zero(t, subscription.ConsecutiveFailures)
+	}
+}
+
+func TestSimulateUnsubscribedNotification(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	data, _ := json.Marshal(map[string]interface{}{"merchantId": "123456", "type": "TEST"})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/notify/simulate", strings.NewReader(string(data)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if assert.NoError(t, h.SimulateNotification(e.NewContext(req, rec))) {
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestSimulateDisabledNotification(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	sent := 0
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+	}))
+	defer merchant.Close()
+
+	assert.NoError(t, h.repository.UpsertNotificationSubscription(&model.NotificationSubscription{
+		ID:              model.SubscriptionKey{MerchantID: "123456", Type: "TEST"},
+		NotificationURL: merchant.URL,
+		Status:          types.SubscriptionStatusDisabled,
+	}))
+
+	data, _ := json.Marshal(map[string]interface{}{"merchantId": "123456", "type": "TEST"})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/notify/simulate", strings.NewReader(string(data)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if assert.NoError(t, h.SimulateNotification(e.NewContext(req, rec))) {
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), "SUBSCRIPTION_NOT_ACTIVE")
+	}
+	assert.Zero(t, sent)
+}
+
+func TestSimulateSampleNotification(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	var (
+		received     http.Header
+		receivedBody []byte
+	)
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		receivedBody, _ = io.ReadAll(r.Body)
+	}))
+	defer merchant.Close()
+
+	err := h.repository.UpsertNotificationSubscription(&model.NotificationSubscription{
+		ID:              model.SubscriptionKey{MerchantID: "123456", Type: constant.EventTypeEndpointDisabled, Mode: types.ModeTest},
+		NotificationURL: merchant.URL,
+		NotificationKey: "secret-key",
+		Auth:            &model.SubscriptionAuth{Type: types.AuthTypeHeaders, Headers: map[string]string{"X-Api-Key": "merchant-secret"}},
+	})
+	assert.NoError(t, err)
+
+	data, _ := json.Marshal(map[string]interface{}{"merchantId": "123456", "type": constant.EventTypeEndpointDisabled, "mode": "TEST"})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/notify/simulate", strings.NewReader(string(data)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if assert.NoError(t, h.SimulateNotification(e.NewContext(req, rec))) && assert.Equal(t, http.StatusOK, rec.Code) {
+		var response struct {
+			Exchange transformer.WebhookExchange `json:"exchange"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+
+		// The registered sample is sent with the subscription's credentials, which the exchange masks, along with
+		// the key and body for a caller without a read token
+		assert.Equal(t, "merchant-secret", received.Get("X-Api-Key"))
+		assert.Equal(t, "secret-key", received.Get(constant.HeaderWebhookKey))
+		assert.Contains(t, string(receivedBody), `"consecutiveFailures"`)
+		if assert.NotNil(t, response.Exchange.Request) {
+			assert.Equal(t, "********", response.Exchange.Request.Body)
+			assert.Equal(t, "********", response.Exchange.Request.Headers["X-Api-Key"])
+			assert.Equal(t, "********", response.Exchange.Request.Headers[constant.HeaderWebhookKey])
 		}
+		assert.NotContains(t, rec.Body.String(), "merchant-secret")
+		assert.NotContains(t, rec.Body.String(), "secret-key")
 	}
 }
 
@@ -107,6 +238,7 @@ func TestSendSubscibedNotification(t *testing.T) {
 	input.MerchantID = "123456"
 	input.RequestID = fmt.Sprintf("%d", time.Now().Unix())
 	input.Type = "TEST"
+	subscribe(t, h, input.MerchantID, input.Type, fmt.Sprintf("%s/notify", TestClientServerURL))
 
 	type d struct {
 		Amount      uint64 `json:"amount"`
@@ -201,6 +333,15 @@ func TestGetNotifications(t *testing.T) {
 
 	input.MerchantID = "123456"
 
+	notification := &model.Notification{
+		ID:         primitive.NewObjectID(),
+		MerchantID: input.MerchantID,
+		RequestID:  fmt.Sprintf("%d", time.Now().Unix()),
+		Type:       "TEST",
+		Status:     types.NotificationStatusPending,
+	}
+	assert.NoError(t, h.repository.CreateNotification(notification))
+
 	data, _ := json.Marshal(input)
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/notifys", strings.NewReader(string(data)))
@@ -327,3 +468,122 @@ func TestResendNotification(t *testing.T) {
 
 	}
 }
+
+func TestResendNotificationToInactiveSubscription(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	id := model.SubscriptionKey{MerchantID: "123456", Type: "TEST"}
+	subscribe(t, h, id.MerchantID, id.Type, fmt.Sprintf("%s/notify", TestClientServerURL))
+
+	attemptedAt := time.Now().UTC()
+	notification := &model.Notification{
+		ID:              primitive.NewObjectID(),
+		MerchantID:      id.MerchantID,
+		RequestID:       "req-1",
+		Type:            id.Type,
+		NotificationURL: fmt.Sprintf("%s/notify", TestClientServerURL),
+		AttemptNo:       1,
+		AttemptedAt:     &attemptedAt,
+		Status:          types.NotificationStatusFailed,
+	}
+	assert.NoError(t, h.repository.UpsertNotification(notification))
+
+	resend := func() *httptest.ResponseRecorder {
+		data, _ := json.Marshal(map[string]interface{}{"merchantId": id.MerchantID, "type": id.Type, "requestId": "req-1"})
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify/resend", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.ResendNotification(e.NewContext(req, rec)))
+		return rec
+	}
+
+	for _, status := range []types.SubscriptionStatus{types.SubscriptionStatusPaused, types.SubscriptionStatusDisabled} {
+		assert.NoError(t, h.repository.UpdateNotificationSubscriptionStatus(id, status))
+
+		rec := resend()
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), "SUBSCRIPTION_NOT_ACTIVE")
+	}
+
+	stored, err := h.repository.FindNotificationByID(notification.ID.Hex(), notification.MerchantID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NotificationStatusFailed, stored.Status)
+		assert.Equal(t, uint(1), stored.AttemptNo)
+	}
+
+	assert.NoError(t, h.repository.UpdateNotificationSubscriptionStatus(id, types.SubscriptionStatusActive))
+	assert.Equal(t, http.StatusOK, resend().Code)
+}
+
+func TestNotificationWebhookHeaders(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	type delivery struct {
+		header http.Header
+		body   map[string]interface{}
+	}
+	var deliveries []delivery
+
+	// Fails the first delivery so it can be resent
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := delivery{header: r.Header.Clone()}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&d.body))
+		deliveries = append(deliveries, d)
+
+		if len(deliveries) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(`{}`))
+	})))
+	defer merchant.Close()
+
+	assert.NoError(t, h.repository.UpsertNotificationSubscription(&model.NotificationSubscription{
+		ID:              model.SubscriptionKey{MerchantID: "123456", Type: "TEST"},
+		NotificationURL: merchant.URL,
+		PayloadFormat:   types.PayloadFormatEnvelope,
+	}))
+
+	post := func(fn echo.HandlerFunc, path string, input interface{}) {
+		data, _ := json.Marshal(input)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if assert.NoError(t, fn(e.NewContext(req, rec))) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	}
+
+	post(h.SendNotification, "/v1/notify", map[string]interface{}{
+		"merchantId": "123456",
+		"requestId":  "1",
+		"type":       "TEST",
+		"payload":    map[string]interface{}{"amount": 100},
+	})
+	post(h.ResendNotification, "/v1/notify/resend", map[string]interface{}{
+		"merchantId": "123456",
+		"requestId":  "1",
+		"type":       "TEST",
+	})
+
+	notification, err := h.repository.FindNotification("TEST", "1", "")
+	if !assert.NoError(t, err) || !assert.Len(t, deliveries, 2) {
+		return
+	}
+
+	for i, each := range deliveries {
+		assert.Equal(t, notification.ID.Hex(), each.header.Get("X-Xendit-Event-Id"))
+		assert.Equal(t, "TEST", each.header.Get("X-Xendit-Event-Type"))
+		assert.Equal(t, fmt.Sprint(i+1), each.header.Get("X-Xendit-Attempt"))
+		assert.Equal(t, notification.CreatedAt.Format(time.RFC3339), each.header.Get("X-Xendit-Created-At"))
+
+		assert.Equal(t, notification.ID.Hex(), each.body["id"])
+		assert.Equal(t, "TEST", each.body["type"])
+		assert.Equal(t, map[string]interface{}{"amount": float64(100)}, each.body["data"])
+	}
+	assert.NotEmpty(t, deliveries[0].header.Get("X-Xendit-Delivery-Id"))
+	assert.NotEqual(t, deliveries[0].header.Get("X-Xendit-Delivery-Id"), deliveries[1].header.Get("X-Xendit-Delivery-Id"))
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/env"
+	"xenotification/app/kit/heartbeat"
+	"xenotification/app/repository"
+	"xenotification/app/response"
+	"xenotification/app/response/errcode"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CronArchiveNotification : moves delivered notifications past their retention to the archive, and purges
+// archived ones past the purge period. Merchants with their own retention are handled first, the global
+// retention covers everyone else's live notifications, and the test retention everyone's test ones.
+func (h Handler) CronArchiveNotification(c echo.Context) error {
+	if !h.deliveries.begin() {
+		return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, errShuttingDown))
+	}
+	defer h.deliveries.end()
+
+	ctx := c.Request().Context()
+	now := time.Now().UTC()
+
+	var archived, purged int64
+
+	overrides := make([]string, 0, len(env.Config.Retention.Merchants))
+	for _, each := range env.Config.Retention.Merchants {
+		overrides = append(overrides, each.MerchantID)
+
+		a, p, err := h.applyRetention(ctx, repository.MerchantScope{MerchantIDs: []string{each.MerchantID}}, now, each.ArchiveAfter, each.PurgeAfter)
+		archived, purged = archived+a, purged+p
+		if err != nil {
+			h.log(ctx).Error("failed to apply retention", slog.String("merchant_id", each.MerchantID), slog.Any("error", err))
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+	}
+
+	a, p, err := h.applyRetention(ctx, repository.MerchantScope{ExcludeMerchantIDs: overrides}, now, env.Config.Retention.ArchiveAfter, env.Config.Retention.PurgeAfter)
+	archived, purged = archived+a, purged+p
+	if err != nil {
+		h.log(ctx).Error("failed to apply retention", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	a, p, err = h.applyRetention(ctx, repository.MerchantScope{Mode: types.ModeTest}, now, env.Config.Retention.TestArchiveAfter, env.Config.Retention.TestPurgeAfter)
+	archived, purged = archived+a, purged+p
+	if err != nil {
+		h.log(ctx).Error("failed to apply retention", slog.String("mode", string(types.ModeTest)), slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	h.log(ctx).Info("applied retention", slog.Int64("archived", archived), slog.Int64("purged", purged))
+
+	if err := h.heartbeat.Beat(ctx, heartbeat.CronArchiveNotification); err != nil {
+		h.log(ctx).Error("failed to record heartbeat", slog.Any("error", err))
+	}
+
+	return c.JSON(http.StatusOK, response.Item{
+		Item: map[string]int64{
+			"archived": archived,
+			"purged":   purged,
+		},
+	})
+}
+
+// applyRetention : works in batches until nothing is due, stopping early once shutdown starts
+func (h Handler) applyRetention(ctx context.Context, scope repository.MerchantScope, now time.Time, archiveAfter, purgeAfter time.Duration) (archived, purged int64, err error) {
+	repo := h.repository.WithContext(ctx)
+
+	// Failed notifications are archived once the retry cron is done with them
+	retryAttempts, _ := env.RetryFor(scope.Mode)
+
+	for !h.deliveries.isDraining() {
+		n, err := repo.ArchiveNotifications(scope, now.Add(-1*archiveAfter), retryAttempts, constant.RetentionBatchSize)
+		archived += n
+		if err != nil {
+			return archived, purged, err
+		} else if n < constant.RetentionBatchSize {
+			break
+		}
+	}
+
+	for !h.deliveries.isDraining() {
+		n, err := repo.PurgeArchivedNotifications(scope, now.Add(-1*purgeAfter), constant.RetentionBatchSize)
+		purged += n
+		if err != nil {
+			return archived, purged, err
+		} else if n < constant.RetentionBatchSize {
+			break
+		}
+	}
+
+	return archived, purged, nil
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"xenotification/app/env"
+	"xenotification/app/kit/validator"
+	"xenotification/app/model"
+	"xenotification/app/response/transformer"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCronArchiveNotification(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	day := 24 * time.Hour
+	defer func(merchants []env.MerchantRetention) { env.Config.Retention.Merchants = merchants }(env.Config.Retention.Merchants)
+	env.Config.Retention.Merchants = []env.MerchantRetention{{MerchantID: "654321", ArchiveAfter: day, PurgeAfter: 2 * day}}
+
+	retryAttempts, _ := env.RetryFor("")
+	deliveredAgo := func(merchantID string, status types.NotificationStatus, age time.Duration) *model.Notification {
+		notification := &model.Notification{
+			ID:         primitive.NewObjectID(),
+			MerchantID: merchantID,
+			RequestID:  primitive.NewObjectID().Hex(),
+			Type:       "TEST",
+			Status:     status,
+			AttemptNo:  1,
+			Model:      model.Model{CreatedAt: time.Now().UTC().Add(-age), UpdatedAt: time.Now().UTC().Add(-age)},
+		}
+		assert.NoError(t, h.repository.CreateNotification(notification))
+		return notification
+	}
+
+	archived := deliveredAgo("123456", types.NotificationStatusSuccess, env.Config.Retention.ArchiveAfter+day)
+	deliveredAgo("123456", types.NotificationStatusSuccess, day)                                  // Still within retention
+	deliveredAgo("123456", types.NotificationStatusFailed, env.Config.Retention.ArchiveAfter+day) // Still being retried
+	deliveredAgo("123456", types.NotificationStatusSuccess, env.Config.Retention.PurgeAfter+day)  // Archived then purged
+	deliveredAgo("654321", types.NotificationStatusSuccess, 3*day)                                // Purged by the merchant's retention
+
+	// Failed for good once the retry cron is done with it
+	exhausted := deliveredAgo("123456", types.NotificationStatusFailed, env.Config.Retention.ArchiveAfter+day)
+	exhausted.AttemptNo = retryAttempts
+	assert.NoError(t, h.repository.UpsertNotification(exhausted))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/cron/archive-notification", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, h.CronArchiveNotification(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Item struct {
+				Archived int `json:"archived"`
+				Purged   int `json:"purged"`
+			} `json:"item"`
+		}
+
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response)) {
+			assert.Equal(t, 4, response.Item.Archived)
+			assert.Equal(t, 2, response.Item.Purged)
+		}
+	}
+
+	// Only the archived notifications are listed from the archive, their attempts went with them
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/notifys?merchantId=%s&archived=true", archived.MerchantID), nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+
+	if assert.NoError(t, h.GetNotifications(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Items []transformer.Notification `json:"items"`
+		}
+
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response)) && assert.Len(t, response.Items, 2) {
+			assert.ElementsMatch(t, []string{archived.ID.Hex(), exhausted.ID.Hex()}, []string{response.Items[0].ID, response.Items[1].ID})
+			assert.NotNil(t, response.Items[0].ArchivedAt)
+		}
+	}
+
+	_, err := h.repository.FindLastNotificationAttempt(archived.ID)
+	assert.Error(t, err)
+
+	live, _, err := h.repository.FindNotifications("123456", "", "", 0)
+	if assert.NoError(t, err) {
+		assert.Len(t, live, 2)
+	}
+
+	// Replaying an archived request ID returns the archived notification instead of sending it again
+	sent := 0
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+	}))
+	defer merchant.Close()
+	assert.NoError(t, h.repository.UpsertNotificationSubscription(&model.NotificationSubscription{
+		ID:              model.SubscriptionKey{MerchantID: "123456", Type: "TEST"},
+		NotificationURL: merchant.URL,
+	}))
+
+	data, _ := json.Marshal(map[string]interface{}{"merchantId": "123456", "type": "TEST", "requestId": archived.RequestID, "payload": "again"})
+	req = httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(string(data)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+
+	if assert.NoError(t, h.SendNotification(e.NewContext(req, rec))) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Item transformer.NotificationWithAttempt `json:"item"`
+		}
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response)) {
+			assert.Equal(t, archived.ID.Hex(), response.Item.ID)
+			assert.Equal(t, types.NotificationStatusSuccess, response.Item.Status)
+			assert.NotNil(t, response.Item.ArchivedAt)
+		}
+	}
+	assert.Zero(t, sent)
+}
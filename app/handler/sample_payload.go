@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// samplePayloads : what a notification of each event type the service sends itself looks like, simulated when
+// the caller gives no payload. Register a new event type here along with its sender.
+var samplePayloads = map[string]func(id model.SubscriptionKey, now time.Time) interface{}{
+	constant.EventTypeEndpointDisabled: func(id model.SubscriptionKey, now time.Time) interface{} {
+		failingSince := now.Add(-2 * time.Hour)
+		lastSuccessAt := failingSince.Add(-time.Minute)
+		return map[string]interface{}{
+			"merchantId":          id.MerchantID,
+			"type":                "invoice.paid",
+			"notificationUrl":     "https://example.com/webhooks/invoice",
+			"consecutiveFailures": 25,
+			"failingSince":        failingSince,
+			"lastSuccessAt":       lastSuccessAt,
+			"disabledAt":          now,
+			"reason":              "25 consecutive failed deliveries since " + failingSince.Format(time.RFC3339),
+		}
+	},
+}
+
+// samplePayload : the registered sample of the subscription's event type, or a generic one naming the type
+// for the types merchants' notifications are sent with
+func samplePayload(id model.SubscriptionKey, now time.Time) interface{} {
+	if sample, ok := samplePayloads[id.Type]; ok {
+		return sample(id, now)
+	}
+	return map[string]interface{}{
+		"id":         primitive.NewObjectIDFromTimestamp(now).Hex(),
+		"merchantId": id.MerchantID,
+		"type":       id.Type,
+		"message":    "This is test from Xendit",
+		"createdAt":  now,
+	}
+}
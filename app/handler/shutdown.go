@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"xenotification/app/kit/locker"
+)
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// deliveryTracker : keeps count of in-flight deliveries and the locks they hold so shutdown can drain them
+type deliveryTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+	locks    map[locker.Mutex]struct{}
+}
+
+func newDeliveryTracker() *deliveryTracker {
+	return &deliveryTracker{
+		locks: make(map[locker.Mutex]struct{}),
+	}
+}
+
+// begin : registers a new delivery, false once draining has started
+func (t *deliveryTracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+// end :
+func (t *deliveryTracker) end() {
+	t.wg.Done()
+}
+
+func (t *deliveryTracker) isDraining() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.draining
+}
+
+func (t *deliveryTracker) drain() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.draining = true
+}
+
+func (t *deliveryTracker) held(mutex locker.Mutex) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.locks[mutex] = struct{}{}
+}
+
+func (t *deliveryTracker) released(mutex locker.Mutex) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.locks, mutex)
+}
+
+// heldLocks :
+func (t *deliveryTracker) heldLocks() []locker.Mutex {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	locks := make([]locker.Mutex, 0, len(t.locks))
+	for mutex := range t.locks {
+		locks = append(locks, mutex)
+	}
+	return locks
+}
+
+// Drain : stops accepting new deliveries, requests arriving afterwards get a 503
+func (h Handler) Drain() {
+	h.deliveries.drain()
+}
+
+// Shutdown : drains and waits for in-flight deliveries until ctx is done.
+// Locks still held at that point are released so another instance can pick the notifications up.
+func (h Handler) Shutdown(ctx context.Context) error {
+	h.deliveries.drain()
+
+	done := make(chan struct{})
+	go func() {
+		h.deliveries.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		h.log(ctx).Warn("shutdown deadline reached with deliveries still running", slog.Any("error", err))
+	}
+
+	for _, mutex := range h.deliveries.heldLocks() {
+		if _, unlockErr := mutex.Unlock(); unlockErr != nil {
+			h.log(ctx).Error("failed to release lock", slog.Any("error", unlockErr))
+		}
+		h.deliveries.released(mutex)
+	}
+
+	return err
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownWaitsForInFlightDeliveries(t *testing.T) {
+	h := Handler{deliveries: newDeliveryTracker()}
+
+	if !assert.True(t, h.deliveries.begin()) {
+		return
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+		h.deliveries.end()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, h.Shutdown(ctx))
+	select {
+	case <-finished:
+	default:
+		t.Fatal("shutdown returned before the delivery finished")
+	}
+
+	// New deliveries are refused once draining
+	assert.False(t, h.deliveries.begin())
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	h := Handler{deliveries: newDeliveryTracker()}
+	assert.True(t, h.deliveries.begin())
+	defer h.deliveries.end()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, h.Shutdown(ctx), context.DeadlineExceeded)
+}
+
+func TestCronRefusedWhileDraining(t *testing.T) {
+	e := echo.New()
+	h := Handler{deliveries: newDeliveryTracker()}
+	h.Drain()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/cron/resend-notification", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, h.CronSendNotification(c)) {
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	}
+}
@@ -1,53 +1,87 @@
 package handler
 
 import (
+	"mime"
 	"net/http"
 	"net/url"
 	"time"
 
+	"xenotification/app/env"
+	"xenotification/app/kit/filter"
 	"xenotification/app/kit/helper"
+	"xenotification/app/kit/transform"
+	"xenotification/app/kit/webhookauth"
 	"xenotification/app/model"
+	"xenotification/app/repository"
 	"xenotification/app/response"
 	"xenotification/app/response/errcode"
 	"xenotification/app/response/transformer"
+	"xenotification/app/types"
 
 	"github.com/ivpusic/grpool"
 	"github.com/labstack/echo/v4"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // GetSubscriptions :
 func (h Handler) GetSubscriptions(c echo.Context) error {
 	var input struct {
-		MerchantID string `query:"merchantId"`
-		Cursor     string `query:"cursor"`
-		Limit      int64  `query:"limit"`
+		MerchantID string     `query:"merchantId"`
+		Mode       types.Mode `query:"mode" validate:"omitempty,oneof=LIVE TEST"`
+		Cursor     string     `query:"cursor"`
+		Limit      int64      `query:"limit"`
 	}
 
 	if err := c.Bind(&input); err != nil {
 		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
 	}
 
-	subscriptions, cursor, err := h.repository.FindNotificationSubscriptions(input.MerchantID, input.Cursor, input.Limit)
-	if err != nil && err != mongo.ErrNoDocuments {
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	subscriptions, cursor, err := h.repository.FindNotificationSubscriptions(input.MerchantID, storedMode(input.Mode), input.Cursor, input.Limit)
+	if err != nil && err != repository.ErrNotFound {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	certs, err := h.repository.FindClientCertificates(input.MerchantID)
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
 
+	certsByID := make(map[primitive.ObjectID]*model.ClientCertificate, len(certs))
+	for _, each := range certs {
+		certsByID[each.ID] = each
+	}
+
 	pool := grpool.NewPool(20, 20)
 	defer pool.Release()
 
+	opener := h.opener(c)
+
 	pool.WaitCount(len(subscriptions))
 	formattedSubscriptions := make([]transformer.NotificationSubscription, len(subscriptions))
+	errs := make([]error, len(subscriptions))
 	for l, each := range subscriptions {
 		pool.JobQueue <- func(i int, sub *model.NotificationSubscription) func() {
 			return func() {
 				defer pool.JobDone()
-				formattedSubscriptions[i] = transformer.ToNotificationSubscription(sub)
+				formattedSubscriptions[i], errs[i] = transformer.ToNotificationSubscription(sub, opener)
+				if sub.ClientCertificateID != nil {
+					formattedSubscriptions[i].WithClientCertificate(sub, certsByID[*sub.ClientCertificateID], env.Config.ClientCertificate.ExpiryWarning)
+				}
 			}
 		}(l, each)
 	}
 	pool.WaitAll()
 
+	for _, err := range errs {
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+	}
+
 	return c.JSON(http.StatusOK, response.Items{
 		Items:  formattedSubscriptions,
 		Count:  len(formattedSubscriptions),
@@ -59,10 +93,46 @@ func (h Handler) GetSubscriptions(c echo.Context) error {
 func (h Handler) UpsertSubscription(c echo.Context) error {
 
 	var input struct {
-		MerchantID            string `json:"merchantId" validate:"required"`
-		Type                  string `json:"type" validate:"required"`
-		NotificationURL       string `json:"notificationUrl" validate:"required"`
-		AcceptableStatusCodes []int  `json:"acceptableStatusCodes"`
+		MerchantID            string              `json:"merchantId" validate:"required"`
+		Type                  string              `json:"type" validate:"required"`
+		Mode                  types.Mode          `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
+		NotificationURL       string              `json:"notificationUrl" validate:"required"`
+		AcceptableStatusCodes []int               `json:"acceptableStatusCodes"`
+		PayloadFormat         types.PayloadFormat `json:"payloadFormat" validate:"omitempty,oneof=RAW ENVELOPE"`
+		Method                string              `json:"method" validate:"omitempty,oneof=POST PUT PATCH"`
+		BodyEncoding          types.BodyEncoding  `json:"bodyEncoding" validate:"omitempty,oneof=JSON FORM XML RAW"`
+		ContentType           string              `json:"contentType" validate:"max=255"`
+		Gzip                  bool                `json:"gzip"`
+		HTTPOptions           *struct {
+			TimeoutMs       int64  `json:"timeoutMs" validate:"omitempty,min=1,max=60000"`
+			MaxResponseSize int64  `json:"maxResponseSize" validate:"omitempty,min=1"`
+			MaxRedirects    *int   `json:"maxRedirects" validate:"omitempty,min=0,max=10"`
+			ProxyURL        string `json:"proxyUrl" validate:"omitempty,url"`
+			CABundle        string `json:"caBundle"`
+			ServerCA        string `json:"serverCa"`
+		} `json:"httpOptions"`
+		ClientCertificateID string `json:"clientCertificateId"`
+		Auth                *struct {
+			Type         types.AuthType    `json:"type" validate:"required,oneof=BASIC BEARER HEADERS OAUTH2_CLIENT_CREDENTIALS"`
+			Username     string            `json:"username"`
+			Password     string            `json:"password"`
+			Token        string            `json:"token"`
+			Headers      map[string]string `json:"headers"`
+			TokenURL     string            `json:"tokenUrl"`
+			ClientID     string            `json:"clientId"`
+			ClientSecret string            `json:"clientSecret"`
+			Scopes       []string          `json:"scopes"`
+		} `json:"auth"`
+		Transform *struct {
+			Type       types.TransformType `json:"type" validate:"required,oneof=TEMPLATE PROJECTION"`
+			Template   string              `json:"template"`
+			Projection map[string]string   `json:"projection"`
+		} `json:"transform"`
+		Filters []struct {
+			Field    string               `json:"field" validate:"required"`
+			Operator types.FilterOperator `json:"operator" validate:"required,oneof=EQ NE IN NOT_IN GT GTE LT LTE EXISTS NOT_EXISTS"`
+			Value    interface{}          `json:"value"`
+		} `json:"filters" validate:"max=20,dive"`
 	}
 
 	if err := c.Bind(&input); err != nil {
@@ -81,9 +151,123 @@ func (h Handler) UpsertSubscription(c echo.Context) error {
 	subscription := new(model.NotificationSubscription)
 	subscription.ID.MerchantID = input.MerchantID
 	subscription.ID.Type = input.Type
+	subscription.ID.Mode = storedMode(input.Mode)
 	subscription.NotificationURL = input.NotificationURL
 	subscription.NotificationKey = helper.RandomString(24)
 	subscription.AcceptableStatusCodes = input.AcceptableStatusCodes
+	subscription.PayloadFormat = input.PayloadFormat
+	subscription.Method = input.Method
+	subscription.BodyEncoding = input.BodyEncoding
+	subscription.ContentType = input.ContentType
+	subscription.Gzip = input.Gzip
+	if subscription.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(subscription.ContentType); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+		}
+	}
+	if input.HTTPOptions != nil {
+		subscription.HTTPOptions = &model.HTTPOptions{
+			Timeout:         time.Duration(input.HTTPOptions.TimeoutMs) * time.Millisecond,
+			MaxResponseSize: input.HTTPOptions.MaxResponseSize,
+			MaxRedirects:    input.HTTPOptions.MaxRedirects,
+			ProxyURL:        input.HTTPOptions.ProxyURL,
+			CABundle:        input.HTTPOptions.CABundle,
+			ServerCA:        input.HTTPOptions.ServerCA,
+		}
+
+		// e.g. a CA bundle without a certificate
+		if err := h.httpOptions(subscription).Validate(); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+		}
+	}
+	if input.Auth != nil {
+		subscription.Auth = &model.SubscriptionAuth{
+			Type:         input.Auth.Type,
+			Username:     input.Auth.Username,
+			Password:     input.Auth.Password,
+			Token:        input.Auth.Token,
+			Headers:      input.Auth.Headers,
+			TokenURL:     input.Auth.TokenURL,
+			ClientID:     input.Auth.ClientID,
+			ClientSecret: input.Auth.ClientSecret,
+			Scopes:       input.Auth.Scopes,
+		}
+
+		if err := webhookauth.Validate(subscription.Auth); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+		}
+	}
+
+	if input.Transform != nil {
+		subscription.Transform = &model.PayloadTransform{
+			Type:       input.Transform.Type,
+			Template:   input.Transform.Template,
+			Projection: input.Transform.Projection,
+		}
+
+		if err := transform.Validate(subscription.Transform); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+		}
+	}
+
+	for _, each := range input.Filters {
+		subscription.Filters = append(subscription.Filters, model.SubscriptionFilter{
+			Field:    each.Field,
+			Operator: each.Operator,
+			Value:    each.Value,
+		})
+	}
+	if err := filter.Validate(subscription.Filters); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	var cert *model.ClientCertificate
+	if input.ClientCertificateID != "" {
+		id, err := primitive.ObjectIDFromHex(input.ClientCertificateID)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+		}
+
+		cert, err = h.repository.FindClientCertificate(id, input.MerchantID)
+		if err == repository.ErrNotFound {
+			return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ClientCertificateNotFound, err))
+		} else if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+		subscription.ClientCertificateID = &id
+	}
+
+	// A new endpoint is only activated once it answers the verification challenge. Saving the settings again
+	// otherwise neither resumes nor pauses the subscription, nor resets its failure streak.
+	existing, err := h.repository.FindNotificationSubscription(subscription.ID)
+	if err != nil && err != repository.ErrNotFound {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	// Saving keeps the notification key, only RotateSubscriptionKey replaces it
+	if existing != nil {
+		opened, err := h.cipher.OpenNotificationSubscription(existing)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		} else if opened.NotificationKey != "" {
+			subscription.NotificationKey = opened.NotificationKey
+		}
+	}
+
+	subscription.Status = types.SubscriptionStatusPendingVerification
+	if existing != nil && existing.NotificationURL == subscription.NotificationURL {
+		subscription.Status = types.SubscriptionStatusActive
+		if existing.Status != "" {
+			subscription.Status = existing.Status
+		}
+		subscription.VerifiedAt = existing.VerifiedAt
+		subscription.ConsecutiveFailures = existing.ConsecutiveFailures
+		subscription.FailingSince = existing.FailingSince
+		subscription.LastSuccessAt = existing.LastSuccessAt
+		subscription.DisabledAt = existing.DisabledAt
+		subscription.DisabledReason = existing.DisabledReason
+	}
+
 	subscription.CreatedAt = time.Now().UTC()
 	subscription.UpdatedAt = time.Now().UTC()
 
@@ -91,8 +275,111 @@ func (h Handler) UpsertSubscription(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
 
+	var verificationErr error
+	if subscription.Status == types.SubscriptionStatusPendingVerification {
+		verificationErr = h.verifyEndpoint(c.Request().Context(), subscription)
+	}
+
+	action := types.AuditActionCreate
+	if existing != nil {
+		action = types.AuditActionUpdate
+	}
+	h.auditSubscriptionChange(c.Request().Context(), action, requestActor(c), existing, subscription)
+
+	item, err := transformer.ToNotificationSubscription(subscription, h.opener(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+	item.WithClientCertificate(subscription, cert, env.Config.ClientCertificate.ExpiryWarning)
+	item.WithVerificationError(verificationErr)
+
+	return c.JSON(http.StatusOK, response.Item{Item: item})
+}
+
+// PreviewSubscription : renders a payload the way it would be sent, without sending it. The stored subscription
+// is the starting point when type is given, the other fields override it so a transform can be tried before saving.
+func (h Handler) PreviewSubscription(c echo.Context) error {
+
+	var input struct {
+		MerchantID    string              `json:"merchantId" validate:"required"`
+		Type          string              `json:"type"`
+		Mode          types.Mode          `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
+		PayloadFormat types.PayloadFormat `json:"payloadFormat" validate:"omitempty,oneof=RAW ENVELOPE"`
+		BodyEncoding  types.BodyEncoding  `json:"bodyEncoding" validate:"omitempty,oneof=JSON FORM XML RAW"`
+		ContentType   string              `json:"contentType" validate:"max=255"`
+		Transform     *struct {
+			Type       types.TransformType `json:"type" validate:"required,oneof=TEMPLATE PROJECTION"`
+			Template   string              `json:"template"`
+			Projection map[string]string   `json:"projection"`
+		} `json:"transform"`
+		Payload interface{} `json:"payload" validate:"required"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	subscription := new(model.NotificationSubscription)
+	subscription.ID.MerchantID = input.MerchantID
+	if input.Type != "" {
+		stored, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type, Mode: storedMode(input.Mode)})
+		if err == repository.ErrNotFound {
+			return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
+		} else if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+		subscription = stored
+	}
+
+	if input.PayloadFormat != "" {
+		subscription.PayloadFormat = input.PayloadFormat
+	}
+	if input.BodyEncoding != "" {
+		subscription.BodyEncoding = input.BodyEncoding
+	}
+	if input.ContentType != "" {
+		subscription.ContentType = input.ContentType
+	}
+	if input.Transform != nil {
+		subscription.Transform = &model.PayloadTransform{
+			Type:       input.Transform.Type,
+			Template:   input.Transform.Template,
+			Projection: input.Transform.Projection,
+		}
+
+		if err := transform.Validate(subscription.Transform); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+		}
+	}
+
+	notification := new(model.Notification)
+	notification.ID = primitive.NewObjectID()
+	notification.MerchantID = input.MerchantID
+	notification.Type = input.Type
+	notification.Payload = input.Payload
+	notification.CreatedAt = time.Now().UTC()
+
+	var body interface{} = notification.Payload
+	if subscription.PayloadFormat == types.PayloadFormatEnvelope {
+		body = transformer.ToWebhookEnvelope(notification)
+	}
+
+	headers := make(map[string]string)
+	method, data, err := renderWebhook(subscription, body, headers)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.TransformError, err))
+	}
+
 	return c.JSON(http.StatusOK, response.Item{
-		Item: transformer.ToNotificationSubscription(subscription),
+		Item: map[string]interface{}{
+			"method":      method,
+			"contentType": headers["Content-Type"],
+			"body":        string(data),
+		},
 	})
 }
 
@@ -100,8 +387,9 @@ func (h Handler) UpsertSubscription(c echo.Context) error {
 func (h Handler) DeleteSubscription(c echo.Context) error {
 
 	var input struct {
-		MerchantID string `json:"merchantId" validate:"required"`
-		Type       string `json:"type" validate:"required"`
+		MerchantID string     `json:"merchantId" validate:"required"`
+		Type       string     `json:"type" validate:"required"`
+		Mode       types.Mode `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
 	}
 
 	if err := c.Bind(&input); err != nil {
@@ -112,11 +400,64 @@ func (h Handler) DeleteSubscription(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
 	}
 
-	if err := h.repository.DeleteNotificationSubscription(model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type}); err != nil {
+	id := model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type, Mode: storedMode(input.Mode)}
+	existing, err := h.repository.FindNotificationSubscription(id)
+	if err == repository.ErrNotFound {
+		return c.JSON(http.StatusOK, response.Item{Item: true})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	if err := h.repository.DeleteNotificationSubscription(id); err != nil {
 		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 	}
+	h.auditSubscriptionChange(c.Request().Context(), types.AuditActionDelete, requestActor(c), existing, nil)
 
 	return c.JSON(http.StatusOK, response.Item{
 		Item: true,
 	})
 }
+
+// RotateSubscriptionKey : replaces the subscription's notification key, the new one is in the response for callers
+// presenting a read token. Notifications already stored are retried with the key they were created with.
+func (h Handler) RotateSubscriptionKey(c echo.Context) error {
+
+	var input struct {
+		MerchantID string     `json:"merchantId" validate:"required"`
+		Type       string     `json:"type" validate:"required"`
+		Mode       types.Mode `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	repo := h.repository.WithContext(c.Request().Context())
+	id := model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type, Mode: storedMode(input.Mode)}
+
+	existing, err := repo.FindNotificationSubscription(id)
+	if err == repository.ErrNotFound {
+		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	opened, err := h.cipher.OpenNotificationSubscription(existing)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	// A copy, with encryption disabled the opened subscription is the one the audit compares against
+	rotated := *opened
+	rotated.NotificationKey = helper.RandomString(24)
+	rotated.UpdatedAt = time.Now().UTC()
+	if err := repo.UpsertNotificationSubscription(&rotated); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	return h.subscriptionResponse(c, repo, types.AuditActionRotate, existing, nil)
+}
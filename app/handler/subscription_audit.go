@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/model"
+	"xenotification/app/response"
+	"xenotification/app/response/errcode"
+	"xenotification/app/response/transformer"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetSubscriptionAudits : the changes to the merchant's subscriptions, newest first
+func (h Handler) GetSubscriptionAudits(c echo.Context) error {
+	var input struct {
+		MerchantID string     `query:"merchantId" validate:"required"`
+		Mode       types.Mode `query:"mode" validate:"omitempty,oneof=LIVE TEST"`
+		Type       string     `query:"type"`
+		Cursor     string     `query:"cursor"`
+		Limit      int64      `query:"limit"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	audits, cursor, err := h.repository.WithContext(c.Request().Context()).FindSubscriptionAudits(input.MerchantID, storedMode(input.Mode), input.Type, input.Cursor, input.Limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	formattedAudits := make([]transformer.SubscriptionAudit, len(audits))
+	for i, each := range audits {
+		formattedAudits[i] = transformer.ToSubscriptionAudit(each)
+	}
+
+	return c.JSON(http.StatusOK, response.Items{
+		Items:  formattedAudits,
+		Count:  len(formattedAudits),
+		Cursor: cursor,
+	})
+}
+
+// auditActor : who changed a subscription, and from where
+type auditActor struct {
+	name     string
+	sourceIP string
+}
+
+// systemActor : changes the service makes on its own
+var systemActor = auditActor{name: "system"}
+
+// requestActor : named by the caller with the X-Actor header
+func requestActor(c echo.Context) auditActor {
+	name := c.Request().Header.Get(constant.HeaderActor)
+	if name == "" {
+		name = "api"
+	}
+	return auditActor{name: name, sourceIP: c.RealIP()}
+}
+
+// auditSubscriptionChange : records what differs between the subscriptions, sealed or not. before is nil for a
+// created subscription, after for a deleted one.
+func (h Handler) auditSubscriptionChange(ctx context.Context, action types.AuditAction, actor auditActor, before, after *model.NotificationSubscription) {
+	log := h.log(ctx).With(slog.String("action", string(action)))
+
+	// Secrets are compared in plaintext, so a changed one is recorded even though it is masked
+	var (
+		id  model.SubscriptionKey
+		err error
+	)
+	if before != nil {
+		id = before.ID
+		if before, err = h.cipher.OpenNotificationSubscription(before); err != nil {
+			log.Error("failed to audit subscription change", slog.Any("error", err))
+			return
+		}
+	}
+	if after != nil {
+		id = after.ID
+		if after, err = h.cipher.OpenNotificationSubscription(after); err != nil {
+			log.Error("failed to audit subscription change", slog.Any("error", err))
+			return
+		}
+	}
+
+	changes, err := transformer.SubscriptionChanges(before, after)
+	if err != nil {
+		log.Error("failed to audit subscription change", slog.Any("error", err))
+		return
+	}
+
+	h.auditSubscription(ctx, id, action, actor, changes)
+}
+
+// auditSubscription : appends to the audit log. The change has already been made, so failing to record it is
+// logged rather than failing the request.
+func (h Handler) auditSubscription(ctx context.Context, id model.SubscriptionKey, action types.AuditAction, actor auditActor, changes []model.SubscriptionChange) {
+	audit := &model.SubscriptionAudit{
+		ID:         primitive.NewObjectID(),
+		MerchantID: id.MerchantID,
+		Type:       id.Type,
+		Mode:       id.Mode,
+		Action:     action,
+		Actor:      actor.name,
+		SourceIP:   actor.sourceIP,
+		Changes:    changes,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	if err := h.repository.WithContext(context.WithoutCancel(ctx)).CreateSubscriptionAudit(audit); err != nil {
+		h.log(ctx).Error("failed to audit subscription change",
+			slog.String("merchant_id", id.MerchantID),
+			slog.String("type", id.Type),
+			slog.String("action", string(action)),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// keyChange : the encryption key a subscription's secrets are sealed with, none when they were stored in plaintext
+func keyChange(before, after *model.Sealed) model.SubscriptionChange {
+	change := model.SubscriptionChange{Field: "encryptionKeyId"}
+	if before != nil {
+		data, _ := json.Marshal(before.KeyID)
+		change.Before = string(data)
+	}
+	if after != nil {
+		data, _ := json.Marshal(after.KeyID)
+		change.After = string(data)
+	}
+	return change
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xenotification/app/constant"
+	"xenotification/app/kit/validator"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionAudit(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	// Also the subscription's proxy, plain HTTP requests are sent to it as they are
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer merchant.Close()
+
+	call := func(handler echo.HandlerFunc, actor string, input map[string]interface{}) {
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if actor != "" {
+			req.Header.Set(constant.HeaderActor, actor)
+		}
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	subscription := map[string]interface{}{"merchantId": "123456", "type": "TEST"}
+	call(h.UpsertSubscription, "alice", map[string]interface{}{
+		"merchantId":      "123456",
+		"type":            "TEST",
+		"notificationUrl": merchant.URL,
+		"auth":            map[string]interface{}{"type": "BASIC", "username": "merchant", "password": "first-secret"},
+		"httpOptions":     map[string]interface{}{"proxyUrl": "http://proxy:first-secret@" + strings.TrimPrefix(merchant.URL, "http://")},
+	})
+	call(h.UpsertSubscription, "bob", map[string]interface{}{
+		"merchantId":      "123456",
+		"type":            "TEST",
+		"notificationUrl": merchant.URL,
+		"auth":            map[string]interface{}{"type": "BASIC", "username": "merchant", "password": "second-secret"},
+		"httpOptions":     map[string]interface{}{"proxyUrl": "http://proxy:second-secret@" + strings.TrimPrefix(merchant.URL, "http://")},
+	})
+	call(h.PauseSubscription, "", subscription)
+	call(h.RotateSubscriptionKey, "carol", subscription)
+	call(h.DeleteSubscription, "alice", subscription)
+	call(h.UpsertSubscription, "alice", map[string]interface{}{"merchantId": "654321", "type": "TEST", "notificationUrl": merchant.URL})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/subscription/audits?merchantId=123456&type=TEST", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.GetSubscriptionAudits(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	var response struct {
+		Count int `json:"count"`
+		Items []struct {
+			Action   types.AuditAction `json:"action"`
+			Actor    string            `json:"actor"`
+			SourceIP string            `json:"sourceIp"`
+			Changes  []struct {
+				Field  string      `json:"field"`
+				Before interface{} `json:"before"`
+				After  interface{} `json:"after"`
+			} `json:"changes"`
+		} `json:"items"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	if !assert.Equal(t, 5, response.Count) {
+		return
+	}
+
+	changes := func(i int) map[string][2]interface{} {
+		v := make(map[string][2]interface{})
+		for _, each := range response.Items[i].Changes {
+			v[each.Field] = [2]interface{}{each.Before, each.After}
+		}
+		return v
+	}
+
+	// Newest first
+	deleted, rotated, paused, updated, created := 0, 1, 2, 3, 4
+	assert.Equal(t, types.AuditActionDelete, response.Items[deleted].Action)
+	assert.Equal(t, [2]interface{}{merchant.URL, nil}, changes(deleted)["notificationUrl"])
+
+	assert.Equal(t, types.AuditActionPause, response.Items[paused].Action)
+	assert.Equal(t, "api", response.Items[paused].Actor)
+	assert.Equal(t, map[string][2]interface{}{"status": {"ACTIVE", "PAUSED"}}, changes(paused))
+
+	// Only the key changed, and only that it did shows
+	assert.Equal(t, types.AuditActionRotate, response.Items[rotated].Action)
+	assert.Equal(t, "carol", response.Items[rotated].Actor)
+	assert.Equal(t, map[string][2]interface{}{"notificationKey": {"********", "********"}}, changes(rotated))
+
+	// The passwords changed, which shows though they are masked. Saving keeps the key.
+	assert.Equal(t, types.AuditActionUpdate, response.Items[updated].Action)
+	assert.Equal(t, "bob", response.Items[updated].Actor)
+	assert.Contains(t, changes(updated), "auth")
+	if assert.Contains(t, changes(updated), "httpOptions") {
+		assert.Equal(t, map[string]interface{}{"proxyUrl": "http://********@" + strings.TrimPrefix(merchant.URL, "http://")}, changes(updated)["httpOptions"][1])
+	}
+	assert.NotContains(t, changes(updated), "notificationKey")
+	assert.NotContains(t, changes(updated), "notificationUrl")
+
+	assert.Equal(t, types.AuditActionCreate, response.Items[created].Action)
+	assert.Equal(t, "alice", response.Items[created].Actor)
+	assert.Equal(t, "192.0.2.1", response.Items[created].SourceIP)
+	assert.Equal(t, [2]interface{}{nil, merchant.URL}, changes(created)["notificationUrl"])
+	assert.Equal(t, [2]interface{}{nil, "ACTIVE"}, changes(created)["status"])
+}
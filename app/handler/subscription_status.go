@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/response"
+	"xenotification/app/response/errcode"
+	"xenotification/app/response/transformer"
+	"xenotification/app/types"
+
+	"github.com/ivpusic/grpool"
+	"github.com/labstack/echo/v4"
+)
+
+// PauseSubscription : notifications are held, not delivered, until the subscription resumes
+func (h Handler) PauseSubscription(c echo.Context) error {
+	return h.updateSubscriptionStatus(c, types.SubscriptionStatusPaused, types.AuditActionPause)
+}
+
+// DisableSubscription : stops the notifications without deleting the subscription's settings
+func (h Handler) DisableSubscription(c echo.Context) error {
+	return h.updateSubscriptionStatus(c, types.SubscriptionStatusDisabled, types.AuditActionDisable)
+}
+
+func (h Handler) updateSubscriptionStatus(c echo.Context, status types.SubscriptionStatus, action types.AuditAction) error {
+
+	var input struct {
+		MerchantID string     `json:"merchantId" validate:"required"`
+		Type       string     `json:"type" validate:"required"`
+		Mode       types.Mode `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	repo := h.repository.WithContext(c.Request().Context())
+	id := model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type, Mode: storedMode(input.Mode)}
+
+	// Only verifying the endpoint activates a subscription pending verification
+	before, err := repo.FindNotificationSubscription(id)
+	if err == repository.ErrNotFound {
+		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	} else if before.Status == types.SubscriptionStatusPendingVerification {
+		return c.JSON(http.StatusConflict, response.NewException(c, errcode.SubscriptionNotVerified, errSubscriptionNotVerified))
+	}
+
+	if err := repo.UpdateNotificationSubscriptionStatus(id, status); err == repository.ErrNotFound {
+		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	return h.subscriptionResponse(c, repo, action, before, nil)
+}
+
+// ResumeSubscription : reactivates the subscription. The notifications held while it was paused are delivered
+// in the background oldest first, or dropped before it is reactivated. Resuming an active subscription releases
+// whatever is still held.
+func (h Handler) ResumeSubscription(c echo.Context) error {
+
+	var input struct {
+		MerchantID string     `json:"merchantId" validate:"required"`
+		Type       string     `json:"type" validate:"required"`
+		Mode       types.Mode `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
+		DropHeld   bool       `json:"dropHeld"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	if !h.deliveries.begin() {
+		return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, errShuttingDown))
+	}
+	defer h.deliveries.end()
+
+	ctx := c.Request().Context()
+	repo := h.repository.WithContext(ctx)
+	id := model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type, Mode: storedMode(input.Mode)}
+	log := h.log(ctx).With(slog.String("merchant_id", id.MerchantID), slog.String("type", id.Type))
+
+	// Only verifying the endpoint activates a subscription pending verification
+	before, err := repo.FindNotificationSubscription(id)
+	if err == repository.ErrNotFound {
+		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	} else if before.Status == types.SubscriptionStatusPendingVerification {
+		return c.JSON(http.StatusConflict, response.NewException(c, errcode.SubscriptionNotVerified, errSubscriptionNotVerified))
+	}
+
+	// Dropped while the subscription is still paused, so an interrupted drop delivers none of them
+	var counts map[string]int64
+	if input.DropHeld {
+		dropped, err := h.releaseHeldNotifications(ctx, id, true)
+		switch err {
+		case nil:
+		case errShuttingDown:
+			return c.JSON(http.StatusServiceUnavailable, response.NewException(c, errcode.ServerShuttingDown, err))
+		case errNotificationLocked:
+			return c.JSON(http.StatusConflict, response.NewException(c, errcode.NotificationLocked, err))
+		default:
+			log.Error("failed to drop held notifications", slog.Int64("dropped", dropped), slog.Any("error", err))
+			return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+		}
+		counts = map[string]int64{"dropped": dropped}
+	}
+
+	if err := repo.UpdateNotificationSubscriptionStatus(id, types.SubscriptionStatusActive); err == repository.ErrNotFound {
+		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	log.Info("resumed subscription", slog.Bool("dropped", input.DropHeld))
+	if !input.DropHeld {
+		h.releaseHeldInBackground(ctx, id)
+	}
+
+	return h.subscriptionResponse(c, repo, types.AuditActionResume, before, counts)
+}
+
+// subscriptionResponse : audits the status change, then responds with the subscription as it is now next to the
+// counts of what the change did
+func (h Handler) subscriptionResponse(c echo.Context, repo repository.Repository, action types.AuditAction, before *model.NotificationSubscription, counts map[string]int64) error {
+	subscription, err := repo.FindNotificationSubscription(before.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+	h.auditSubscriptionChange(c.Request().Context(), action, requestActor(c), before, subscription)
+
+	item, err := transformer.ToNotificationSubscription(subscription, h.opener(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	body := map[string]interface{}{"item": item}
+	for name, count := range counts {
+		body[name] = count
+	}
+	return c.JSON(http.StatusOK, body)
+}
+
+// releaseHeldInBackground : delivers the subscription's held notifications without keeping the caller waiting.
+// Whatever it leaves held, e.g. when shutdown starts, is released by the retry cron.
+func (h Handler) releaseHeldInBackground(ctx context.Context, id model.SubscriptionKey) {
+	if !h.deliveries.begin() {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer h.deliveries.end()
+
+		released, err := h.releaseHeldNotifications(ctx, id, false)
+		log := h.log(ctx).With(slog.String("merchant_id", id.MerchantID), slog.String("type", id.Type), slog.Int64("released", released))
+		if err != nil && err != errShuttingDown && err != errNotificationLocked && err != errSubscriptionNotActive {
+			log.Error("failed to release held notifications", slog.Any("error", err))
+			return
+		}
+		log.Info("released held notifications", slog.Any("stopped", err))
+	}()
+}
+
+// releaseHeldSubscriptions : releases the notifications still held for active subscriptions, e.g. after a
+// release was interrupted, one subscription at a time per worker so each keeps its order
+func (h Handler) releaseHeldSubscriptions(ctx context.Context) (released int64, err error) {
+	repo := h.repository.WithContext(ctx)
+
+	keys, err := repo.FindHeldSubscriptionKeys()
+	if err != nil {
+		return 0, err
+	}
+
+	pool := grpool.NewPool(20, 20)
+	defer pool.Release()
+
+	var mu sync.Mutex
+	pool.WaitCount(len(keys))
+	for _, each := range keys {
+		pool.JobQueue <- func(id model.SubscriptionKey) func() {
+			return func() {
+				defer pool.JobDone()
+
+				count, err := h.releaseHeldNotifications(ctx, id, false)
+				if err != nil && err != errShuttingDown && err != errNotificationLocked && err != errSubscriptionNotActive {
+					h.log(ctx).Error("failed to release held notifications",
+						slog.String("merchant_id", id.MerchantID),
+						slog.String("type", id.Type),
+						slog.Any("error", err),
+					)
+				}
+
+				mu.Lock()
+				released += count
+				mu.Unlock()
+			}
+		}(each)
+	}
+	pool.WaitAll()
+
+	return released, nil
+}
+
+// releaseHeldNotifications : works through the held notifications oldest first, stopping with errShuttingDown
+// once shutdown starts. A notification it cannot lock stops it with errNotificationLocked, so none is delivered
+// ahead of an older one. Delivering stops with errSubscriptionNotActive once the subscription is paused, disabled
+// or deleted, leaving the rest held.
+func (h Handler) releaseHeldNotifications(ctx context.Context, id model.SubscriptionKey, drop bool) (released int64, err error) {
+	repo := h.repository.WithContext(ctx)
+
+	for {
+		if h.deliveries.isDraining() {
+			return released, errShuttingDown
+		}
+
+		if !drop {
+			if subscription, err := repo.FindNotificationSubscription(id); err == repository.ErrNotFound || (err == nil && !subscriptionActive(subscription)) {
+				return released, errSubscriptionNotActive
+			} else if err != nil {
+				return released, err
+			}
+		}
+
+		notifications, err := repo.FindHeldNotifications(id, constant.ReleaseBatchSize)
+		if err != nil || len(notifications) == 0 {
+			return released, err
+		}
+
+		for _, each := range notifications {
+			if h.deliveries.isDraining() {
+				return released, errShuttingDown
+			}
+
+			ok, err := h.releaseHeldNotification(ctx, each, drop)
+			if err != nil {
+				return released, err
+			} else if ok {
+				released++
+			}
+		}
+	}
+}
+
+// errSubscriptionNotVerified :
+var errSubscriptionNotVerified = errors.New("Subscription endpoint is not verified")
+
+// errNotificationLocked : another request, e.g. a second resume, is working on the notification
+var errNotificationLocked = errors.New("notification is locked")
+
+// errSubscriptionNotActive : the subscription was paused, disabled or deleted while its notifications were released
+var errSubscriptionNotActive = errors.New("subscription is not active")
+
+// subscriptionActive : subscriptions from before statuses are active
+func subscriptionActive(subscription *model.NotificationSubscription) bool {
+	return subscription.Status == "" || subscription.Status == types.SubscriptionStatusActive
+}
+
+// releaseHeldNotification : false when the notification was no longer held
+func (h Handler) releaseHeldNotification(ctx context.Context, notification *model.Notification, drop bool) (bool, error) {
+	repo := h.repository.WithContext(ctx)
+	log := h.notificationLog(ctx, notification, notification.AttemptNo)
+
+	notificationRequestLock, err := h.lock(ctx, notificationLockName(notification.Type, notification.RequestID, notification.Mode), constant.NotificationLockExpiry)
+	if err != nil {
+		log.Warn("stopped releasing held notifications, notification is locked", slog.Any("error", err))
+		return false, errNotificationLocked
+	}
+	defer h.unlock(ctx, notificationRequestLock)
+
+	// Check again now that the lock is held
+	notification, err = repo.FindNotificationByID(notification.ID.Hex(), notification.MerchantID)
+	if err != nil {
+		return false, err
+	} else if notification.Status != types.NotificationStatusHeld {
+		return false, nil
+	}
+
+	if !drop {
+		// Delivered with the subscription as it is now, a failure goes to the retry sweep like any other
+		subscription := currentSubscription(repo, notification)
+		if subscription == nil || !subscriptionActive(subscription) {
+			return false, errSubscriptionNotActive
+		}
+
+		var resp interface{}
+		_, err := h.triggerNotification(ctx, notification, subscription, &resp)
+		return err == nil, err
+	}
+
+	lastAttempt, err := repo.FindLastNotificationAttempt(notification.ID)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	lastAttempt.Status = types.NotificationStatusDropped
+	lastAttempt.UpdatedAt = now
+	notification.Status = types.NotificationStatusDropped
+	notification.UpdatedAt = now
+
+	if err := h.repository.WithContext(context.WithoutCancel(ctx)).SaveNotificationAttemptResult(notification, lastAttempt); err != nil {
+		return false, err
+	}
+
+	log.Info("dropped held notification")
+	return true, nil
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xenotification/app/kit/validator"
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionPauseAndResume(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(data))
+		mu.Unlock()
+	})))
+	defer merchant.Close()
+
+	call := func(handler echo.HandlerFunc, path string, input map[string]interface{}) (int, map[string]interface{}) {
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+
+		var response map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response
+	}
+
+	subscription := map[string]interface{}{"merchantId": "123456", "type": "TEST"}
+	status := func(response map[string]interface{}) interface{} {
+		if item, ok := response["item"].(map[string]interface{}); ok {
+			return item["status"]
+		}
+		return nil
+	}
+	send := func(requestID string) interface{} {
+		_, response := call(h.SendNotification, "/v1/notify", map[string]interface{}{
+			"merchantId": "123456",
+			"requestId":  requestID,
+			"type":       "TEST",
+			"payload":    requestID,
+		})
+		return status(response)
+	}
+	upsert := func() interface{} {
+		code, response := call(h.UpsertSubscription, "/v1/subscription", map[string]interface{}{
+			"merchantId":      "123456",
+			"type":            "TEST",
+			"notificationUrl": merchant.URL,
+		})
+		assert.Equal(t, http.StatusOK, code)
+		return status(response)
+	}
+
+	code, _ := call(h.PauseSubscription, "/v1/subscription/pause", subscription)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	assert.Equal(t, string(types.SubscriptionStatusActive), upsert())
+
+	code, response := call(h.PauseSubscription, "/v1/subscription/pause", subscription)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, string(types.SubscriptionStatusPaused), status(response))
+
+	// Held while paused, saving the settings again does not resume it
+	assert.Equal(t, string(types.NotificationStatusHeld), send("req-1"))
+	assert.Equal(t, string(types.SubscriptionStatusPaused), upsert())
+	assert.Equal(t, string(types.NotificationStatusHeld), send("req-2"))
+	assert.Equal(t, string(types.NotificationStatusHeld), send("req-3"))
+	assert.Empty(t, received)
+
+	// Released oldest first, after the resume has answered
+	code, response = call(h.ResumeSubscription, "/v1/subscription/resume", subscription)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, string(types.SubscriptionStatusActive), status(response))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{`"req-1"`, `"req-2"`, `"req-3"`}, received)
+
+	notification, err := h.repository.FindNotification("TEST", "req-1", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NotificationStatusSuccess, notification.Status)
+		assert.Equal(t, uint(1), notification.AttemptNo)
+	}
+
+	// Or dropped
+	call(h.PauseSubscription, "/v1/subscription/pause", subscription)
+	assert.Equal(t, string(types.NotificationStatusHeld), send("req-4"))
+
+	code, response = call(h.ResumeSubscription, "/v1/subscription/resume", map[string]interface{}{"merchantId": "123456", "type": "TEST", "dropHeld": true})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), response["dropped"])
+	assert.Len(t, received, 3)
+
+	notification, err = h.repository.FindNotification("TEST", "req-4", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NotificationStatusDropped, notification.Status)
+		attempt, err := h.repository.FindLastNotificationAttempt(notification.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, types.NotificationStatusDropped, attempt.Status)
+		}
+	}
+
+	// A disabled subscription receives nothing and keeps its settings
+	code, response = call(h.DisableSubscription, "/v1/subscription/disable", subscription)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, string(types.SubscriptionStatusDisabled), status(response))
+	assert.Nil(t, send("req-5"))
+	_, err = h.repository.FindNotification("TEST", "req-5", "")
+	assert.Error(t, err)
+
+	code, _ = call(h.ResumeSubscription, "/v1/subscription/resume", subscription)
+	assert.Equal(t, http.StatusOK, code)
+
+	stored, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: "123456", Type: "TEST"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.SubscriptionStatusActive, stored.Status)
+		assert.Equal(t, merchant.URL, stored.NotificationURL)
+	}
+	assert.Equal(t, string(types.NotificationStatusSuccess), send("req-5"))
+	assert.Len(t, received, 4)
+}
+
+func TestReleaseHeldStopsWhenPaused(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	id := model.SubscriptionKey{MerchantID: "123456", Type: "RELEASE"}
+
+	// The merchant's endpoint is paused as the first released notification reaches it
+	var (
+		mu       sync.Mutex
+		received int
+	)
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received++
+		assert.NoError(t, h.repository.UpdateNotificationSubscriptionStatus(id, types.SubscriptionStatusPaused))
+	})))
+	defer merchant.Close()
+
+	call := func(handler echo.HandlerFunc, input map[string]interface{}) int {
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call(h.UpsertSubscription, map[string]interface{}{"merchantId": id.MerchantID, "type": id.Type, "notificationUrl": merchant.URL}))
+	assert.Equal(t, http.StatusOK, call(h.PauseSubscription, map[string]interface{}{"merchantId": id.MerchantID, "type": id.Type}))
+	for _, requestID := range []string{"release-1", "release-2", "release-3"} {
+		call(h.SendNotification, map[string]interface{}{"merchantId": id.MerchantID, "requestId": requestID, "type": id.Type, "payload": requestID})
+	}
+
+	assert.NoError(t, h.repository.UpdateNotificationSubscriptionStatus(id, types.SubscriptionStatusActive))
+	released, err := h.releaseHeldNotifications(context.Background(), id, false)
+	assert.Equal(t, errSubscriptionNotActive, err)
+	assert.Equal(t, int64(1), released)
+	assert.Equal(t, 1, received)
+
+	held, err := h.repository.FindHeldNotifications(id, 10)
+	if assert.NoError(t, err) {
+		assert.Len(t, held, 2)
+	}
+}
@@ -1,36 +1,118 @@
 package handler
 
 import (
+	"compress/gzip"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
+	"sync"
 	"testing"
-
-	"xenotification/app/bootstrap"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/env"
+	"xenotification/app/kit/encryption"
+	"xenotification/app/kit/heartbeat"
+	httprequest "xenotification/app/kit/httpRequest"
+	"xenotification/app/kit/locker"
 	"xenotification/app/kit/validator"
+	"xenotification/app/kit/webhookauth"
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/repository/encrypted"
+	"xenotification/app/repository/memory"
 	"xenotification/app/response/transformer"
+	"xenotification/app/types"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-const (
-	//TestClientServerURL = "https://xenotification.free.beeceptor.com"
-	TestClientServerURL = "http://localhost:7000/v1/mock"
-)
+// TestClientServerURL : the merchant's endpoint, served by SendMockRequest
+var TestClientServerURL string
+
+// testReadToken : lets a request read the decrypted payloads and notification keys
+const testReadToken = "test-reader"
 
+// testEnvironment : the required variables, so the tests run without a .env file
+var testEnvironment = map[string]string{
+	"APP_NAME":       "xenotification",
+	"APP_VERSION":    "test",
+	"ENV":            "test",
+	"SYSTEM_PATH":    "http://localhost",
+	"REDIS_HOST":     "localhost:6379",
+	"REDIS_PASSWORD": "",
+}
+
+func TestMain(m *testing.M) {
+	if err := env.LoadWith(testEnvironment); err != nil {
+		panic(err)
+	}
+	env.Config.Encryption.ReadTokens = []string{testReadToken}
+
+	e := echo.New()
+	e.POST("/v1/mock/:action", Handler{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}.SendMockRequest)
+
+	server := httptest.NewServer(answeringChallenge(e))
+	TestClientServerURL = server.URL + "/v1/mock"
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// setupTest : a handler running against in-memory storage, each test starts empty
 func setupTest() Handler {
-	bs := bootstrap.New()
+	cipher := newTestCipher("test-1")
+	httpClient, err := httprequest.New(httprequest.Options{Timeout: 5 * time.Second, MaxResponseSize: 1 << 20})
+	if err != nil {
+		panic(err)
+	}
+
 	h := Handler{
-		repository: bs.Repository,
-		redsync:    bs.Redsync,
+		repository:  encrypted.New(memory.New(), cipher),
+		cipher:      cipher,
+		locker:      locker.NewMemory(),
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		heartbeat:   heartbeat.NewMemory(),
+		deliveries:  newDeliveryTracker(),
+		httpClient:  httpClient,
+		webhookAuth: webhookauth.NewProvider(httpClient),
 	}
 	return h
 }
 
+// newTestCipher : the keys are derived from their IDs, the last one is active
+func newTestCipher(keyIDs ...string) *encryption.Cipher {
+	keys := make(map[string][]byte, len(keyIDs))
+	for _, id := range keyIDs {
+		key := sha256.Sum256([]byte(id))
+		keys[id] = key[:]
+	}
+
+	keyring, err := encryption.NewKeyring(keyIDs[len(keyIDs)-1], keys)
+	if err != nil {
+		panic(err)
+	}
+	return encryption.New(keyring)
+}
+
+// subscribe : registers the merchant's endpoint for the notification type
+func subscribe(t *testing.T, h Handler, merchantID, typ, notificationURL string) {
+	err := h.repository.UpsertNotificationSubscription(&model.NotificationSubscription{
+		ID:              model.SubscriptionKey{MerchantID: merchantID, Type: typ},
+		NotificationURL: notificationURL,
+	})
+	assert.NoError(t, err)
+}
+
 func TestUpsertSubscription(t *testing.T) {
 	e := echo.New()
 	e.Validator = validator.New()
@@ -84,6 +166,7 @@ func TestGetSubscriptions(t *testing.T) {
 	}
 
 	input.MerchantID = "123456"
+	subscribe(t, h, input.MerchantID, "TEST", fmt.Sprintf("%s/notify", TestClientServerURL))
 
 	data, _ := json.Marshal(input)
 
@@ -151,8 +234,652 @@ func TestDeleteSubscription(t *testing.T) {
 			assert.Equal(t, true, response.Item)
 
 			// Check in the db if there is still record
-			_, err := h.repository.FindNotification(input.Type, input.MerchantID)
-			assert.Equal(t, mongo.ErrNoDocuments, err)
+			_, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type})
+			assert.Equal(t, repository.ErrNotFound, err)
+		}
+	}
+}
+
+func TestRotateSubscriptionKey(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	call := func(handler echo.HandlerFunc, input map[string]interface{}) (int, string) {
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(constant.HeaderReadToken, testReadToken)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+
+		var response struct {
+			Item struct {
+				NotificationKey string `json:"notificationKey"`
+			} `json:"item"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response.Item.NotificationKey
+	}
+
+	subscription := map[string]interface{}{"merchantId": "123456", "type": "ROTATE", "notificationUrl": fmt.Sprintf("%s/notify", TestClientServerURL)}
+	_, created := call(h.UpsertSubscription, subscription)
+	assert.NotEmpty(t, created)
+
+	// Saving the subscription again keeps its key
+	subscription["acceptableStatusCodes"] = []int{200}
+	_, saved := call(h.UpsertSubscription, subscription)
+	assert.Equal(t, created, saved)
+
+	code, rotated := call(h.RotateSubscriptionKey, map[string]interface{}{"merchantId": "123456", "type": "ROTATE"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, rotated)
+	assert.NotEqual(t, created, rotated)
+
+	_, saved = call(h.UpsertSubscription, subscription)
+	assert.Equal(t, rotated, saved)
+
+	code, _ = call(h.RotateSubscriptionKey, map[string]interface{}{"merchantId": "123456", "type": "MISSING"})
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestSubscriptionHTTPOptions(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	// Answers slowly with a body over 128 bytes
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte(`{"message":"` + strings.Repeat("This is success message. ", 8) + `"}`))
+	})))
+	defer merchant.Close()
+
+	upsert := func(typ, path string, httpOptions map[string]interface{}) int {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId":      "123456",
+			"type":            typ,
+			"notificationUrl": merchant.URL + path,
+			"httpOptions":     httpOptions,
+		})
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/subscription", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.UpsertSubscription(e.NewContext(req, rec)))
+		return rec.Code
+	}
+
+	send := func(typ string) (statusCode int) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId": "123456",
+			"requestId":  typ,
+			"type":       typ,
+			"payload":    map[string]interface{}{"amount": 100},
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if assert.NoError(t, h.SendNotification(e.NewContext(req, rec))) && assert.Equal(t, http.StatusOK, rec.Code) {
+			var response struct {
+				Item struct {
+					StatusCode int `json:"statusCode"`
+				} `json:"item"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			statusCode = response.Item.StatusCode
+		}
+		return
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("INVALID", "/", map[string]interface{}{"caBundle": "not a certificate"}))
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("INVALID", "/", map[string]interface{}{"timeoutMs": 120000}))
+
+	assert.Equal(t, http.StatusOK, upsert("DEFAULT", "/slow", nil))
+	assert.Equal(t, http.StatusOK, upsert("TIMEOUT", "/slow", map[string]interface{}{"timeoutMs": 50}))
+	assert.Equal(t, http.StatusOK, upsert("SIZE", "/", map[string]interface{}{"maxResponseSize": 128}))
+
+	assert.Equal(t, http.StatusOK, send("DEFAULT"))
+	assert.Equal(t, 0, send("TIMEOUT"))
+	// A larger response is cut short, it is still the endpoint accepting the notification
+	assert.Equal(t, http.StatusOK, send("SIZE"))
+}
+
+func TestSubscriptionAuth(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	var (
+		mu          sync.Mutex
+		issued      int
+		validToken  string
+		tokenScopes string
+	)
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		authorized := false
+		switch r.URL.Path {
+		case "/token":
+			clientID, clientSecret, _ := r.BasicAuth()
+			if clientID != "client" || clientSecret != "client-secret" || r.PostFormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"invalid_client"}`))
+				return
+			}
+			issued++
+			validToken = fmt.Sprintf("token-%d", issued)
+			tokenScopes = r.PostFormValue("scope")
+			w.Write([]byte(fmt.Sprintf(`{"access_token":%q,"token_type":"Bearer","expires_in":3600}`, validToken)))
+			return
+
+		case "/oauth2":
+			authorized = r.Header.Get("Authorization") == "Bearer "+validToken
+		case "/basic":
+			username, password, _ := r.BasicAuth()
+			authorized = username == "merchant" && password == "secret"
+		case "/bearer":
+			authorized = r.Header.Get("Authorization") == "Bearer static-token"
+		case "/headers":
+			authorized = r.Header.Get("X-Api-Key") == "api-key"
+		}
+
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"unauthorized"}`))
+			return
+		}
+		w.Write([]byte(`{"message":"This is success message"}`))
+	})))
+	defer merchant.Close()
+
+	upsert := func(typ string, auth map[string]interface{}) (int, map[string]interface{}) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId":      "123456",
+			"type":            typ,
+			"notificationUrl": merchant.URL + "/" + strings.ToLower(typ),
+			"auth":            auth,
+		})
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/subscription", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.UpsertSubscription(e.NewContext(req, rec)))
+
+		var response struct {
+			Item map[string]interface{} `json:"item"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response.Item
+	}
+
+	send := func(typ, requestID string) (statusCode int) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId": "123456",
+			"requestId":  requestID,
+			"type":       typ,
+			"payload":    map[string]interface{}{"amount": 100},
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if assert.NoError(t, h.SendNotification(e.NewContext(req, rec))) && assert.Equal(t, http.StatusOK, rec.Code) {
+			var response struct {
+				Item struct {
+					StatusCode int `json:"statusCode"`
+				} `json:"item"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			statusCode = response.Item.StatusCode
+		}
+		return
+	}
+
+	code, _ := upsert("BASIC", map[string]interface{}{"type": "BASIC", "username": "merchant"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code, "a password is needed")
+	code, _ = upsert("HEADERS", map[string]interface{}{"type": "HEADERS", "headers": map[string]string{"x-xendit-key": "spoofed"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, code, "reserved headers cannot be replaced")
+	code, _ = upsert("UNKNOWN", map[string]interface{}{"type": "DIGEST"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	code, subscription := upsert("BASIC", map[string]interface{}{"type": "BASIC", "username": "merchant", "password": "secret"})
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, map[string]interface{}{"type": "BASIC", "username": "merchant", "password": "********"}, subscription["auth"])
+	}
+	code, _ = upsert("BEARER", map[string]interface{}{"type": "BEARER", "token": "static-token"})
+	assert.Equal(t, http.StatusOK, code)
+	code, subscription = upsert("HEADERS", map[string]interface{}{"type": "HEADERS", "headers": map[string]string{"X-Api-Key": "api-key"}})
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, map[string]interface{}{"X-Api-Key": "********"}, subscription["auth"].(map[string]interface{})["headers"])
+	}
+	code, subscription = upsert("OAUTH2", map[string]interface{}{
+		"type":         "OAUTH2_CLIENT_CREDENTIALS",
+		"tokenUrl":     merchant.URL + "/token",
+		"clientId":     "client",
+		"clientSecret": "client-secret",
+		"scopes":       []string{"webhooks:write", "webhooks:read"},
+	})
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, "********", subscription["auth"].(map[string]interface{})["clientSecret"])
+	}
+
+	// The credentials are only stored sealed
+	stored, err := h.repository.FindNotificationSubscription(model.SubscriptionKey{MerchantID: "123456", Type: "OAUTH2"})
+	if assert.NoError(t, err) {
+		assert.Nil(t, stored.Auth)
+		assert.NotEmpty(t, stored.Sealed.Auth)
+	}
+
+	assert.Equal(t, http.StatusOK, send("BASIC", "BASIC-1"))
+	assert.Equal(t, http.StatusOK, send("BEARER", "BEARER-1"))
+	assert.Equal(t, http.StatusOK, send("HEADERS", "HEADERS-1"))
+
+	// The token is fetched once and reused
+	assert.Equal(t, http.StatusOK, send("OAUTH2", "OAUTH2-1"))
+	assert.Equal(t, http.StatusOK, send("OAUTH2", "OAUTH2-2"))
+	assert.Equal(t, 1, issued)
+	assert.Equal(t, "webhooks:write webhooks:read", tokenScopes)
+
+	// A revoked token is refreshed when the endpoint answers 401
+	mu.Lock()
+	validToken = "revoked"
+	mu.Unlock()
+	assert.Equal(t, http.StatusOK, send("OAUTH2", "OAUTH2-3"))
+	assert.Equal(t, 2, issued)
+}
+
+func TestSubscriptionRequestOptions(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	type received struct {
+		method, contentType, contentEncoding, body string
+	}
+	var (
+		mu   sync.Mutex
+		last *received
+	)
+	// lastRequest : the request received since the previous call, if any
+	lastRequest := func() *received {
+		mu.Lock()
+		defer mu.Unlock()
+		r := last
+		last = nil
+		return r
+	}
+
+	// Answers in XML like the legacy systems these options are for
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		data, _ := io.ReadAll(body)
+
+		mu.Lock()
+		last = &received{r.Method, r.Header.Get("Content-Type"), r.Header.Get("Content-Encoding"), string(data)}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<response>OK</response>`))
+	})))
+	defer merchant.Close()
+
+	upsert := func(typ string, options map[string]interface{}) int {
+		input := map[string]interface{}{
+			"merchantId":      "123456",
+			"type":            typ,
+			"notificationUrl": merchant.URL,
+		}
+		for k, v := range options {
+			input[k] = v
+		}
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/subscription", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.UpsertSubscription(e.NewContext(req, rec)))
+		return rec.Code
+	}
+
+	send := func(typ string, payload interface{}) (statusCode int) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId": "123456",
+			"requestId":  typ,
+			"type":       typ,
+			"payload":    payload,
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if assert.NoError(t, h.SendNotification(e.NewContext(req, rec))) && assert.Equal(t, http.StatusOK, rec.Code) {
+			var response struct {
+				Item struct {
+					StatusCode int `json:"statusCode"`
+				} `json:"item"`
+				Response interface{} `json:"response"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, `<response>OK</response>`, response.Response)
+			statusCode = response.Item.StatusCode
+		}
+		return
+	}
+
+	payload := map[string]interface{}{"id": "inv-1", "amount": 100, "items": []string{"a", "b"}}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("INVALID", map[string]interface{}{"method": "GET"}))
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("INVALID", map[string]interface{}{"bodyEncoding": "YAML"}))
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("INVALID", map[string]interface{}{"contentType": "not a/media/type"}))
+
+	assert.Equal(t, http.StatusOK, upsert("FORM", map[string]interface{}{"method": "PUT", "bodyEncoding": "FORM"}))
+	if assert.Equal(t, http.StatusOK, send("FORM", payload)) {
+		assert.Equal(t, &received{
+			method:      http.MethodPut,
+			contentType: "application/x-www-form-urlencoded",
+			body:        "amount=100&id=inv-1&items%5B0%5D=a&items%5B1%5D=b",
+		}, lastRequest())
+	}
+
+	assert.Equal(t, http.StatusOK, upsert("XML", map[string]interface{}{"bodyEncoding": "XML", "gzip": true}))
+	if assert.Equal(t, http.StatusOK, send("XML", payload)) {
+		assert.Equal(t, &received{
+			method:          http.MethodPost,
+			contentType:     "application/xml",
+			contentEncoding: "gzip",
+			body:            `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<notification><amount>100</amount><id>inv-1</id><items><item>a</item><item>b</item></items></notification>`,
+		}, lastRequest())
+	}
+
+	assert.Equal(t, http.StatusOK, upsert("RAW", map[string]interface{}{"method": "PATCH", "bodyEncoding": "RAW", "contentType": "application/soap+xml"}))
+	if assert.Equal(t, http.StatusOK, send("RAW", `<Invoice id="inv-1"/>`)) {
+		assert.Equal(t, &received{
+			method:      http.MethodPatch,
+			contentType: "application/soap+xml",
+			body:        `<Invoice id="inv-1"/>`,
+		}, lastRequest())
+	}
+
+	// A payload the encoding cannot represent fails the attempt without a request
+	assert.Equal(t, http.StatusOK, upsert("RAW-OBJECT", map[string]interface{}{"bodyEncoding": "RAW"}))
+	data, _ := json.Marshal(map[string]interface{}{"merchantId": "123456", "requestId": "RAW-OBJECT", "type": "RAW-OBJECT", "payload": payload})
+	req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(string(data)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if assert.NoError(t, h.SendNotification(e.NewContext(req, rec))) {
+		var response struct {
+			Item struct {
+				ID         string `json:"id"`
+				StatusCode int    `json:"statusCode"`
+			} `json:"item"`
 		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 0, response.Item.StatusCode)
+
+		id, _ := primitive.ObjectIDFromHex(response.Item.ID)
+		attempt, err := h.repository.FindLastNotificationAttempt(id)
+		if assert.NoError(t, err) && assert.NotNil(t, attempt.Error) {
+			assert.Contains(t, *attempt.Error, "raw encoding needs a string payload")
+		}
+	}
+	assert.Nil(t, lastRequest())
+
+	// Simulate uses the subscription's options, and shows the body before compression
+	assert.Equal(t, http.StatusOK, upsert("SIMULATE", map[string]interface{}{"method": "PUT", "bodyEncoding": "FORM", "gzip": true}))
+	data, _ = json.Marshal(map[string]interface{}{
+		"merchantId": "123456",
+		"type":       "SIMULATE",
+		"payload":    map[string]interface{}{"id": "inv-1"},
+	})
+	req = httptest.NewRequest(http.MethodPost, "/v1/notify/simulate", strings.NewReader(string(data)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(constant.HeaderReadToken, testReadToken)
+	rec = httptest.NewRecorder()
+	if assert.NoError(t, h.SimulateNotification(e.NewContext(req, rec))) && assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Equal(t, &received{
+			method:          http.MethodPut,
+			contentType:     "application/x-www-form-urlencoded",
+			contentEncoding: "gzip",
+			body:            "id=inv-1",
+		}, lastRequest())
+
+		var response struct {
+			Exchange transformer.WebhookExchange `json:"exchange"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		if assert.NotNil(t, response.Exchange.Request) && assert.NotNil(t, response.Exchange.Response) {
+			assert.Equal(t, http.MethodPut, response.Exchange.Request.Method)
+			assert.Equal(t, "id=inv-1", response.Exchange.Request.Body)
+			assert.Equal(t, "application/xml", response.Exchange.Response.Headers["Content-Type"])
+			assert.Equal(t, `<response>OK</response>`, response.Exchange.Response.Body)
+		}
+	}
+}
+
+func TestSubscriptionPayloadTransform(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(data))
+		mu.Unlock()
+	})))
+	defer merchant.Close()
+
+	upsert := func(typ string, transform map[string]interface{}) int {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId":      "123456",
+			"type":            typ,
+			"notificationUrl": merchant.URL,
+			"transform":       transform,
+		})
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/subscription", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.UpsertSubscription(e.NewContext(req, rec)))
+		return rec.Code
+	}
+
+	preview := func(input map[string]interface{}) (int, map[string]string) {
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/subscription/preview", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.PreviewSubscription(e.NewContext(req, rec)))
+
+		var response struct {
+			Item map[string]string `json:"item"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response.Item
+	}
+
+	payload := map[string]interface{}{
+		"id":       "inv-1",
+		"amount":   100,
+		"customer": map[string]interface{}{"name": "Budi"},
+		"items":    []interface{}{map[string]interface{}{"sku": "A-1"}},
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("INVALID", map[string]interface{}{"type": "TEMPLATE", "template": "{{.id"}))
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("INVALID", map[string]interface{}{"type": "PROJECTION", "projection": map[string]string{"id": "$.items[first]"}}))
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("INVALID", map[string]interface{}{"type": "JQ"}))
+
+	assert.Equal(t, http.StatusOK, upsert("PROJECTION", map[string]interface{}{
+		"type": "PROJECTION",
+		"projection": map[string]string{
+			"ref":           "$.id",
+			"customer.name": "$.customer.name",
+			"firstSku":      "$.items[0].sku",
+		},
+	}))
+
+	data, _ := json.Marshal(map[string]interface{}{"merchantId": "123456", "requestId": "PROJECTION", "type": "PROJECTION", "payload": payload})
+	req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(string(data)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(constant.HeaderReadToken, testReadToken)
+	rec := httptest.NewRecorder()
+	expected := `{"customer":{"name":"Budi"},"firstSku":"A-1","ref":"inv-1"}`
+	if assert.NoError(t, h.SendNotification(e.NewContext(req, rec))) && assert.Equal(t, http.StatusOK, rec.Code) {
+		var response struct {
+			Item struct {
+				ID          string `json:"id"`
+				RequestBody string `json:"requestBody"`
+			} `json:"item"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, expected, response.Item.RequestBody)
+		assert.Equal(t, []string{expected}, received)
+
+		// The rendered body is sealed at rest like the payload
+		id, _ := primitive.ObjectIDFromHex(response.Item.ID)
+		attempt, err := h.repository.FindLastNotificationAttempt(id)
+		if assert.NoError(t, err) {
+			assert.Empty(t, attempt.RequestBody)
+			opened, err := h.cipher.OpenNotificationAttempt(attempt)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, opened.RequestBody)
+			}
+		}
+	}
+
+	// The stored subscription is the base of the preview, its transform can be overridden
+	code, item := preview(map[string]interface{}{"merchantId": "123456", "type": "PROJECTION", "payload": payload})
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, map[string]string{"method": http.MethodPost, "contentType": "application/json", "body": expected}, item)
+	}
+
+	code, item = preview(map[string]interface{}{
+		"merchantId":    "123456",
+		"type":          "PROJECTION",
+		"payloadFormat": "ENVELOPE",
+		"transform":     map[string]interface{}{"type": "TEMPLATE", "template": `{"event": {{json .type}}, "total": {{.data.amount}}}`},
+		"payload":       payload,
+	})
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, `{"event":"PROJECTION","total":100}`, item["body"])
+	}
+
+	code, item = preview(map[string]interface{}{
+		"merchantId":   "123456",
+		"bodyEncoding": "RAW",
+		"contentType":  "text/plain",
+		"transform":    map[string]interface{}{"type": "TEMPLATE", "template": `Invoice {{.id}} paid by {{.customer.name}}`},
+		"payload":      payload,
+	})
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, map[string]string{"method": http.MethodPost, "contentType": "text/plain", "body": "Invoice inv-1 paid by Budi"}, item)
+	}
+
+	code, _ = preview(map[string]interface{}{"merchantId": "123456", "type": "UNKNOWN", "payload": payload})
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = preview(map[string]interface{}{
+		"merchantId": "123456",
+		"transform":  map[string]interface{}{"type": "TEMPLATE", "template": `{{index .items 5}}`},
+		"payload":    payload,
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+}
+
+func TestSubscriptionFilters(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	var (
+		mu       sync.Mutex
+		received int
+	)
+	merchant := httptest.NewServer(answeringChallenge(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received++
+		mu.Unlock()
+	})))
+	defer merchant.Close()
+
+	upsert := func(typ string, filters []map[string]interface{}) int {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId":      "123456",
+			"type":            typ,
+			"notificationUrl": merchant.URL,
+			"filters":         filters,
+		})
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/subscription", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, h.UpsertSubscription(e.NewContext(req, rec)))
+		return rec.Code
+	}
+
+	send := func(requestID string, payload interface{}) (status types.NotificationStatus) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"merchantId": "123456",
+			"requestId":  requestID,
+			"type":       "payment.updated",
+			"payload":    payload,
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if assert.NoError(t, h.SendNotification(e.NewContext(req, rec))) && assert.Equal(t, http.StatusOK, rec.Code) {
+			var response struct {
+				Item struct {
+					Status types.NotificationStatus `json:"status"`
+				} `json:"item"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			status = response.Item.Status
+		}
+		return
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("payment.updated", []map[string]interface{}{{"field": "$.amount", "operator": "BETWEEN", "value": 1}}))
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("payment.updated", []map[string]interface{}{{"field": "$.amount", "operator": "GT", "value": "100"}}))
+	assert.Equal(t, http.StatusUnprocessableEntity, upsert("payment.updated", []map[string]interface{}{{"operator": "EXISTS"}}))
+
+	assert.Equal(t, http.StatusOK, upsert("payment.updated", []map[string]interface{}{
+		{"field": "$.currency", "operator": "IN", "value": []string{"IDR", "USD"}},
+		{"field": "$.amount", "operator": "GTE", "value": 100000},
+	}))
+
+	assert.Equal(t, types.NotificationStatusSuccess, send("pay-1", map[string]interface{}{"currency": "IDR", "amount": 150000}))
+	assert.Equal(t, types.NotificationStatusFiltered, send("pay-2", map[string]interface{}{"currency": "IDR", "amount": 50000}))
+	assert.Equal(t, types.NotificationStatusFiltered, send("pay-3", map[string]interface{}{"currency": "SGD", "amount": 150000}))
+	assert.Equal(t, types.NotificationStatusFiltered, send("pay-4", "not an object"))
+	assert.Equal(t, 1, received)
+
+	// A filtered notification is kept, a retry of the same request gets the recorded outcome
+	assert.Equal(t, types.NotificationStatusFiltered, send("pay-2", map[string]interface{}{"currency": "IDR", "amount": 150000}))
+	assert.Equal(t, 1, received)
+
+	notification, err := h.repository.FindNotification("payment.updated", "pay-2", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NotificationStatusFiltered, notification.Status)
 	}
 }
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/response"
+	"xenotification/app/response/errcode"
+	"xenotification/app/response/transformer"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// VerifySubscription : sends the verification challenge again, to a subscription still pending verification
+func (h Handler) VerifySubscription(c echo.Context) error {
+
+	var input struct {
+		MerchantID string     `json:"merchantId" validate:"required"`
+		Type       string     `json:"type" validate:"required"`
+		Mode       types.Mode `json:"mode" validate:"omitempty,oneof=LIVE TEST"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, err))
+	}
+
+	ctx := c.Request().Context()
+	repo := h.repository.WithContext(ctx)
+
+	subscription, err := repo.FindNotificationSubscription(model.SubscriptionKey{MerchantID: input.MerchantID, Type: input.Type, Mode: storedMode(input.Mode)})
+	if err == repository.ErrNotFound {
+		return c.JSON(http.StatusNotFound, response.NewException(c, errcode.NotFoundError, err))
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	// Signed answers are checked against the plaintext key
+	if subscription, err = h.cipher.OpenNotificationSubscription(subscription); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+
+	var verificationErr error
+	if subscription.Status == types.SubscriptionStatusPendingVerification {
+		before := *subscription
+		if verificationErr = h.verifyEndpoint(ctx, subscription); verificationErr == nil {
+			h.auditSubscriptionChange(ctx, types.AuditActionVerify, requestActor(c), &before, subscription)
+		}
+	}
+
+	item, err := transformer.ToNotificationSubscription(subscription, h.opener(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+	}
+	item.WithVerificationError(verificationErr)
+
+	return c.JSON(http.StatusOK, response.Item{Item: item})
+}
+
+// verifyEndpoint : challenges the opened subscription's endpoint and activates the subscription when the endpoint
+// answers with the challenge token, or with its HMAC-SHA256 under the notification key, in a 2xx response.
+// Neither the key nor the subscription's auth is sent, the endpoint is yet to prove it is the merchant's. The
+// error is why the endpoint was not verified.
+func (h Handler) verifyEndpoint(ctx context.Context, subscription *model.NotificationSubscription) error {
+	repo := h.repository.WithContext(ctx)
+	log := h.log(ctx).With(
+		slog.String("merchant_id", subscription.ID.MerchantID),
+		slog.String("type", subscription.ID.Type),
+	)
+
+	token, err := newChallengeToken()
+	if err != nil {
+		return err
+	}
+
+	// Always JSON, whatever the subscription's body encoding and transform
+	body, err := json.Marshal(map[string]string{
+		"type":      constant.EventTypeVerification,
+		"challenge": token,
+	})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{
+		echo.HeaderContentType:          echo.MIMEApplicationJSON,
+		constant.HeaderWebhookEventType: constant.EventTypeVerification,
+	}
+
+	opts := h.httpOptions(subscription)
+	if err := h.withClientCertificate(repo, subscription, &opts); err != nil {
+		return err
+	}
+
+	var resp interface{}
+	statusCode, err := h.httpClient.HttpAPI(ctx, opts, http.MethodPost, subscription.NotificationURL, headers, body, &resp)
+	if err != nil {
+		log.Warn("endpoint verification failed", slog.Any("error", err))
+		return err
+	} else if statusCode < 200 || statusCode >= 300 {
+		log.Warn("endpoint verification failed", slog.Int("status_code", statusCode))
+		return fmt.Errorf("endpoint answered with status %d", statusCode)
+	} else if !answersChallenge(resp, token, subscription.NotificationKey) {
+		log.Warn("endpoint verification failed, wrong answer", slog.Int("status_code", statusCode))
+		return errors.New("endpoint answered with neither the challenge nor its signature")
+	}
+
+	now := time.Now().UTC()
+	verified, err := repo.VerifyNotificationSubscription(subscription.ID, subscription.NotificationURL, now)
+	if err != nil {
+		return err
+	} else if !verified {
+		return errors.New("subscription changed during verification")
+	}
+
+	log.Info("endpoint verified")
+	subscription.Status = types.SubscriptionStatusActive
+	subscription.VerifiedAt = &now
+	return nil
+}
+
+// answersChallenge : the answer is the response body, the token itself or its signature, or the signature field
+// of a JSON object. A JSON object echoing the challenge does not answer it, any endpoint echoing what it is sent
+// would.
+func answersChallenge(resp interface{}, token, key string) bool {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(token))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	switch v := resp.(type) {
+	case string:
+		answer := strings.TrimSpace(v)
+		return hmac.Equal([]byte(answer), []byte(token)) || hmac.Equal([]byte(strings.ToLower(answer)), []byte(signature))
+	case map[string]interface{}:
+		answer, _ := v["signature"].(string)
+		return hmac.Equal([]byte(strings.ToLower(strings.TrimSpace(answer))), []byte(signature))
+	}
+	return false
+}
+
+func newChallengeToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"xenotification/app/constant"
+	"xenotification/app/kit/validator"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// answeringChallenge : a merchant endpoint which echoes the verification challenge and passes anything else on
+func answeringChallenge(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(constant.HeaderWebhookEventType) != constant.EventTypeVerification {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var challenge struct {
+			Challenge string `json:"challenge"`
+		}
+		json.NewDecoder(r.Body).Decode(&challenge)
+		w.Write([]byte(challenge.Challenge))
+	})
+}
+
+func TestSubscriptionVerification(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	var (
+		mu         sync.Mutex
+		answer     = "nothing"
+		key        string
+		challenges int
+		received   int
+	)
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get(constant.HeaderWebhookEventType) != constant.EventTypeVerification {
+			received++
+			return
+		}
+
+		challenges++
+		// The endpoint is not trusted with the key before it is verified
+		assert.Empty(t, r.Header.Get(constant.HeaderWebhookKey))
+		var challenge struct {
+			Challenge string `json:"challenge"`
+		}
+		json.NewDecoder(r.Body).Decode(&challenge)
+
+		switch answer {
+		case "echo":
+			w.Write([]byte(challenge.Challenge))
+		case "echo-json":
+			w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			json.NewEncoder(w).Encode(map[string]string{"challenge": challenge.Challenge})
+		case "sign":
+			mac := hmac.New(sha256.New, []byte(key))
+			mac.Write([]byte(challenge.Challenge))
+			w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			json.NewEncoder(w).Encode(map[string]string{"signature": hex.EncodeToString(mac.Sum(nil))})
+		}
+	}))
+	defer merchant.Close()
+
+	answerWith := func(v string) {
+		mu.Lock()
+		answer = v
+		mu.Unlock()
+	}
+
+	call := func(handler echo.HandlerFunc, input map[string]interface{}) (int, map[string]interface{}) {
+		data, _ := json.Marshal(input)
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(constant.HeaderReadToken, testReadToken)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+
+		var response map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response
+	}
+	item := func(response map[string]interface{}) map[string]interface{} {
+		item, _ := response["item"].(map[string]interface{})
+		return item
+	}
+	upsert := func(url string) map[string]interface{} {
+		code, response := call(h.UpsertSubscription, map[string]interface{}{"merchantId": "123456", "type": "TEST", "notificationUrl": url})
+		assert.Equal(t, http.StatusOK, code)
+		return item(response)
+	}
+	send := func(requestID string) map[string]interface{} {
+		_, response := call(h.SendNotification, map[string]interface{}{"merchantId": "123456", "requestId": requestID, "type": "TEST", "payload": requestID})
+		return item(response)
+	}
+	subscription := map[string]interface{}{"merchantId": "123456", "type": "TEST"}
+
+	// A wrong answer leaves the subscription pending, receiving nothing. Echoing the JSON challenge is no answer.
+	answerWith("echo-json")
+	sub := upsert(merchant.URL)
+	assert.Equal(t, string(types.SubscriptionStatusPendingVerification), sub["status"])
+	if assert.Len(t, sub["warnings"], 1) {
+		assert.Contains(t, sub["warnings"].([]interface{})[0], "endpoint verification failed")
+	}
+	assert.Nil(t, send("req-1"))
+
+	mu.Lock()
+	key = sub["notificationKey"].(string)
+	mu.Unlock()
+
+	code, response := call(h.ResumeSubscription, subscription)
+	assert.Equal(t, http.StatusConflict, code)
+	if exception, ok := response["error"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Equal(t, "SUBSCRIPTION_NOT_VERIFIED", exception["code"])
+	}
+
+	// Challenged again on request, a signed answer verifies it
+	answerWith("sign")
+	code, response = call(h.VerifySubscription, subscription)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, string(types.SubscriptionStatusActive), item(response)["status"])
+	assert.NotEmpty(t, item(response)["verifiedAt"])
+	assert.Nil(t, item(response)["warnings"])
+
+	assert.Equal(t, string(types.NotificationStatusSuccess), send("req-1")["status"])
+	assert.Equal(t, 1, received)
+
+	// Saving the same URL again does not challenge it
+	assert.Equal(t, string(types.SubscriptionStatusActive), upsert(merchant.URL)["status"])
+	assert.Equal(t, 2, challenges)
+
+	// A new URL is challenged, an echoed answer verifies it
+	answerWith("nothing")
+	assert.Equal(t, string(types.SubscriptionStatusPendingVerification), upsert(merchant.URL + "/new")["status"])
+	assert.Nil(t, send("req-2"))
+
+	answerWith("echo")
+	assert.Equal(t, string(types.SubscriptionStatusActive), upsert(merchant.URL + "/new")["status"])
+	assert.Equal(t, 4, challenges)
+	assert.Equal(t, string(types.NotificationStatusSuccess), send("req-2")["status"])
+	assert.Equal(t, 2, received)
+}
+
+func TestVerificationChallengeWithoutAuth(t *testing.T) {
+	e := echo.New()
+	e.Validator = validator.New()
+	h := setupTest()
+
+	var (
+		mu           sync.Mutex
+		challenged   []http.Header
+		delivered    []http.Header
+		tokenFetches int
+	)
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/token" {
+			tokenFetches++
+			w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w.Write([]byte(`{"access_token":"oauth-token","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+		if r.Header.Get(constant.HeaderWebhookEventType) != constant.EventTypeVerification {
+			delivered = append(delivered, r.Header.Clone())
+			return
+		}
+
+		challenged = append(challenged, r.Header.Clone())
+		var challenge struct {
+			Challenge string `json:"challenge"`
+		}
+		json.NewDecoder(r.Body).Decode(&challenge)
+		w.Write([]byte(challenge.Challenge))
+	}))
+	defer merchant.Close()
+
+	tests := []struct {
+		name   string
+		auth   map[string]interface{}
+		header string
+	}{
+		{"BASIC", map[string]interface{}{"type": "BASIC", "username": "merchant", "password": "secret"}, "Authorization"},
+		{"BEARER", map[string]interface{}{"type": "BEARER", "token": "static-token"}, "Authorization"},
+		{"HEADERS", map[string]interface{}{"type": "HEADERS", "headers": map[string]string{"X-Api-Key": "api-key"}}, "X-Api-Key"},
+		{"OAUTH2", map[string]interface{}{"type": "OAUTH2_CLIENT_CREDENTIALS", "tokenUrl": merchant.URL + "/token", "clientId": "client", "clientSecret": "client-secret"}, "Authorization"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			challenged, delivered, tokenFetches = nil, nil, 0
+			mu.Unlock()
+
+			data, _ := json.Marshal(map[string]interface{}{
+				"merchantId":      "123456",
+				"type":            tt.name,
+				"notificationUrl": merchant.URL + "/" + strings.ToLower(tt.name),
+				"auth":            tt.auth,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			assert.NoError(t, h.UpsertSubscription(e.NewContext(req, rec)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			// The endpoint under verification is sent none of the subscription's credentials, nor is a token fetched for it
+			mu.Lock()
+			if assert.Len(t, challenged, 1) {
+				assert.Empty(t, challenged[0].Get("Authorization"))
+				assert.Empty(t, challenged[0].Get(tt.header))
+			}
+			assert.Zero(t, tokenFetches)
+			mu.Unlock()
+
+			// Once verified, deliveries carry them
+			data, _ = json.Marshal(map[string]interface{}{"merchantId": "123456", "requestId": tt.name + "-1", "type": tt.name, "payload": "paid"})
+			req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec = httptest.NewRecorder()
+			assert.NoError(t, h.SendNotification(e.NewContext(req, rec)))
+
+			mu.Lock()
+			if assert.Len(t, delivered, 1) {
+				assert.NotEmpty(t, delivered[0].Get(tt.header))
+			}
+			mu.Unlock()
+		})
+	}
+}
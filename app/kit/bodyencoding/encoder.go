@@ -0,0 +1,114 @@
+package bodyencoding
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"xenotification/app/types"
+)
+
+// Encoder : serializes a webhook body. Values are normalized first, so encoders only see the types
+// encoding/json decodes into: map[string]interface{}, []interface{}, string, json.Number, bool and nil.
+type Encoder interface {
+	// ContentType : sent unless the subscription sets its own
+	ContentType() string
+	Encode(v interface{}) ([]byte, error)
+}
+
+var (
+	mu       sync.RWMutex
+	encoders = map[types.BodyEncoding]Encoder{}
+)
+
+func init() {
+	Register(types.BodyEncodingJSON, JSON{})
+	Register(types.BodyEncodingForm, Form{})
+	Register(types.BodyEncodingXML, XML{Root: "notification"})
+	Register(types.BodyEncodingRaw, Raw{})
+}
+
+// Register : adds or replaces the encoder for an encoding
+func Register(encoding types.BodyEncoding, encoder Encoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	encoders[encoding] = encoder
+}
+
+// Get : an empty encoding is JSON
+func Get(encoding types.BodyEncoding) (Encoder, error) {
+	if encoding == "" {
+		encoding = types.BodyEncodingJSON
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	encoder, ok := encoders[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unknown body encoding %q", encoding)
+	}
+	return encoder, nil
+}
+
+// Encode : normalizes v and serializes it with the encoding's encoder
+func Encode(encoding types.BodyEncoding, v interface{}) ([]byte, string, error) {
+	encoder, err := Get(encoding)
+	if err != nil {
+		return nil, "", err
+	}
+
+	normalized, err := Normalize(v)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := encoder.Encode(normalized)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot encode body as %s: %w", encoding, err)
+	}
+	return data, encoder.ContentType(), nil
+}
+
+// Gzip :
+func Gzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Gunzip :
+func Gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Normalize : round trips v through JSON, keeping numbers exact
+func Normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var normalized interface{}
+	if err := decoder.Decode(&normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
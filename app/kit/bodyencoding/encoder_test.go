@@ -0,0 +1,159 @@
+package bodyencoding
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"xenotification/app/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	payload := map[string]interface{}{
+		"id":     "inv-1",
+		"amount": 100000.5,
+		"paid":   true,
+		"note":   nil,
+		"customer": map[string]interface{}{
+			"name": "Budi & Sons",
+		},
+		"items": []interface{}{
+			map[string]interface{}{"sku": "A-1", "qty": 2},
+			"gift",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		encoding    types.BodyEncoding
+		v           interface{}
+		want        string
+		contentType string
+		wantErr     bool
+	}{
+		{
+			name:        "default is JSON",
+			v:           payload,
+			want:        `{"amount":100000.5,"customer":{"name":"Budi \u0026 Sons"},"id":"inv-1","items":[{"qty":2,"sku":"A-1"},"gift"],"note":null,"paid":true}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "form flattens with brackets",
+			encoding:    types.BodyEncodingForm,
+			v:           payload,
+			want:        "amount=100000.5&customer%5Bname%5D=Budi+%26+Sons&id=inv-1&items%5B0%5D%5Bqty%5D=2&items%5B0%5D%5Bsku%5D=A-1&items%5B1%5D=gift&note=&paid=true",
+			contentType: "application/x-www-form-urlencoded",
+		},
+		{
+			name:        "form wraps a string",
+			encoding:    types.BodyEncodingForm,
+			v:           "hello",
+			want:        "payload=hello",
+			contentType: "application/x-www-form-urlencoded",
+		},
+		{
+			name:     "xml",
+			encoding: types.BodyEncodingXML,
+			v:        payload,
+			want: xmlHeader + `<notification><amount>100000.5</amount><customer><name>Budi &amp; Sons</name></customer><id>inv-1</id>` +
+				`<items><item><qty>2</qty><sku>A-1</sku></item><item>gift</item></items><note></note><paid>true</paid></notification>`,
+			contentType: "application/xml",
+		},
+		{
+			name:     "xml rejects invalid element names",
+			encoding: types.BodyEncodingXML,
+			v:        map[string]interface{}{"2fa": true},
+			wantErr:  true,
+		},
+		{
+			name:        "raw sends a string as is",
+			encoding:    types.BodyEncodingRaw,
+			v:           "<Invoice id=\"1\"/>",
+			want:        "<Invoice id=\"1\"/>",
+			contentType: "text/plain; charset=utf-8",
+		},
+		{
+			name:     "raw needs a string",
+			encoding: types.BodyEncodingRaw,
+			v:        payload,
+			wantErr:  true,
+		},
+		{
+			name:     "unknown encoding",
+			encoding: "YAML",
+			v:        payload,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, contentType, err := Encode(tt.encoding, tt.v)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, string(data))
+				assert.Equal(t, tt.contentType, contentType)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("UPPER", upper{})
+	defer func() {
+		mu.Lock()
+		delete(encoders, "UPPER")
+		mu.Unlock()
+	}()
+
+	data, contentType, err := Encode("UPPER", "hello")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "HELLO", string(data))
+		assert.Equal(t, "text/plain", contentType)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	data, err := Gzip([]byte(`{"id":"inv-1"}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		plain, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id":"inv-1"}`, string(plain))
+	}
+}
+
+func TestGunzip(t *testing.T) {
+	data, err := Gzip([]byte(`{"id":"inv-1"}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	plain, err := Gunzip(data)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"inv-1"}`, string(plain))
+
+	_, err = Gunzip([]byte(`{"id":"inv-1"}`))
+	assert.Error(t, err)
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+type upper struct{}
+
+func (upper) ContentType() string { return "text/plain" }
+
+func (upper) Encode(v interface{}) ([]byte, error) {
+	return bytes.ToUpper([]byte(v.(string))), nil
+}
@@ -0,0 +1,75 @@
+package bodyencoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Form : nested objects and arrays are flattened with brackets, e.g. customer[name] and items[0][id].
+// A body which is not an object is sent as its payload field.
+type Form struct{}
+
+// ContentType :
+func (Form) ContentType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+// Encode :
+func (Form) Encode(v interface{}) ([]byte, error) {
+	values := url.Values{}
+
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{"payload": v}
+	}
+
+	for key, value := range object {
+		if err := flatten(values, key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	// Encode sorts by key, so the same body always gives the same bytes
+	return []byte(values.Encode()), nil
+}
+
+func flatten(values url.Values, key string, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, each := range v {
+			if err := flatten(values, key+"["+k+"]", each); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, each := range v {
+			if err := flatten(values, key+"["+strconv.Itoa(i)+"]", each); err != nil {
+				return err
+			}
+		}
+	default:
+		s, err := scalar(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		values.Add(key, s)
+	}
+	return nil
+}
+
+// scalar : the text form of a normalized scalar, null is empty
+func scalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("unsupported value of type %T", v)
+}
@@ -0,0 +1,16 @@
+package bodyencoding
+
+import "encoding/json"
+
+// JSON :
+type JSON struct{}
+
+// ContentType :
+func (JSON) ContentType() string {
+	return "application/json"
+}
+
+// Encode :
+func (JSON) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
@@ -0,0 +1,20 @@
+package bodyencoding
+
+import "errors"
+
+// Raw : a string body sent as is, for payloads the producer already serialized
+type Raw struct{}
+
+// ContentType :
+func (Raw) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+// Encode :
+func (Raw) Encode(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("raw encoding needs a string payload")
+	}
+	return []byte(s), nil
+}
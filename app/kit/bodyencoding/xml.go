@@ -0,0 +1,97 @@
+package bodyencoding
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// XML : object fields become elements in key order and array items repeat an <item> element,
+// e.g. {"id":"1","tags":["a"]} is <notification><id>1</id><tags><item>a</item></tags></notification>.
+// Null fields are empty elements.
+type XML struct {
+	// Root : the name of the document element
+	Root string
+}
+
+// ContentType :
+func (XML) ContentType() string {
+	return "application/xml"
+}
+
+// Encode :
+func (x XML) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	if err := encodeElement(encoder, x.Root, v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeElement(encoder *xml.Encoder, name string, v interface{}) error {
+	if !isXMLName(name) {
+		return fmt.Errorf("%q is not a valid XML element name", name)
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if err := encodeElement(encoder, key, v[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, each := range v {
+			if err := encodeElement(encoder, "item", each); err != nil {
+				return err
+			}
+		}
+	default:
+		s, err := scalar(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := encoder.EncodeToken(xml.CharData(s)); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+// isXMLName : letters, digits, '_', '-' and '.', not starting with a digit, '-', '.' or "xml" in any case
+func isXMLName(name string) bool {
+	if name == "" || (len(name) >= 3 && strings.EqualFold(name[:3], "xml")) {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case i > 0 && (r == '-' || r == '.' || (r >= '0' && r <= '9')):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,410 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"xenotification/app/model"
+)
+
+// ErrUnknownKey : the record was sealed with a key which is not in the keyring
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Cipher : envelope encryption of the notification fields holding customer data and secrets.
+// Each record gets its own data key, used with AES-GCM, which is stored wrapped by the active key-encryption key.
+//
+// A nil Cipher means encryption is disabled, Seal returns the record as is and Open only passes plaintext through.
+type Cipher struct {
+	keyring *Keyring
+}
+
+// New :
+func New(keyring *Keyring) *Cipher {
+	if keyring == nil {
+		return nil
+	}
+	return &Cipher{keyring: keyring}
+}
+
+// ActiveKeyID : records sealed with another key are rewrapped by the rotation cron
+func (c *Cipher) ActiveKeyID() string {
+	if c == nil {
+		return ""
+	}
+	return c.keyring.ActiveKeyID()
+}
+
+// SealNotification : returns a copy of the notification with the payload and key moved into Sealed.
+// A notification without plaintext keeps its existing Sealed.
+func (c *Cipher) SealNotification(n *model.Notification) (*model.Notification, error) {
+	if c == nil || (n.Payload == nil && n.NotificationKey == "") {
+		return n, nil
+	}
+
+	payload, err := json.Marshal(n.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := c.seal(notificationAAD(n), map[string][]byte{
+		fieldPayload:         payload,
+		fieldNotificationKey: []byte(n.NotificationKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := *n
+	out.Payload = nil
+	out.NotificationKey = ""
+	out.Sealed = sealed
+	return &out, nil
+}
+
+// OpenNotification : returns a copy of the notification with the sealed fields decrypted
+func (c *Cipher) OpenNotification(n *model.Notification) (*model.Notification, error) {
+	if n.Sealed == nil {
+		return n, nil
+	}
+
+	fields, err := c.open(notificationAAD(n), n.Sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *n
+	if err := json.Unmarshal(fields[fieldPayload], &out.Payload); err != nil {
+		return nil, err
+	}
+	out.NotificationKey = string(fields[fieldNotificationKey])
+	out.Sealed = nil
+	return &out, nil
+}
+
+// SealNotificationSubscription : returns a copy of the subscription with the key and auth moved into Sealed
+func (c *Cipher) SealNotificationSubscription(s *model.NotificationSubscription) (*model.NotificationSubscription, error) {
+	if c == nil || (s.NotificationKey == "" && s.Auth == nil) {
+		return s, nil
+	}
+
+	fields := map[string][]byte{
+		fieldNotificationKey: []byte(s.NotificationKey),
+	}
+	if s.Auth != nil {
+		auth, err := json.Marshal(s.Auth)
+		if err != nil {
+			return nil, err
+		}
+		fields[fieldAuth] = auth
+	}
+
+	sealed, err := c.seal(subscriptionAAD(s), fields)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *s
+	out.NotificationKey = ""
+	out.Auth = nil
+	out.Sealed = sealed
+	return &out, nil
+}
+
+// OpenNotificationSubscription : returns a copy of the subscription with the key and auth decrypted
+func (c *Cipher) OpenNotificationSubscription(s *model.NotificationSubscription) (*model.NotificationSubscription, error) {
+	if s.Sealed == nil {
+		return s, nil
+	}
+
+	fields, err := c.open(subscriptionAAD(s), s.Sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *s
+	out.NotificationKey = string(fields[fieldNotificationKey])
+	if auth, ok := fields[fieldAuth]; ok {
+		out.Auth = new(model.SubscriptionAuth)
+		if err := json.Unmarshal(auth, out.Auth); err != nil {
+			return nil, err
+		}
+	}
+	out.Sealed = nil
+	return &out, nil
+}
+
+// SealNotificationAttempt : returns a copy of the attempt with the request body moved into Sealed
+func (c *Cipher) SealNotificationAttempt(a *model.NotificationAttempt) (*model.NotificationAttempt, error) {
+	if c == nil || a.RequestBody == "" {
+		return a, nil
+	}
+
+	sealed, err := c.seal(attemptAAD(a), map[string][]byte{
+		fieldRequestBody: []byte(a.RequestBody),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := *a
+	out.RequestBody = ""
+	out.Sealed = sealed
+	return &out, nil
+}
+
+// OpenNotificationAttempt : returns a copy of the attempt with the request body decrypted
+func (c *Cipher) OpenNotificationAttempt(a *model.NotificationAttempt) (*model.NotificationAttempt, error) {
+	if a.Sealed == nil {
+		return a, nil
+	}
+
+	fields, err := c.open(attemptAAD(a), a.Sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *a
+	out.RequestBody = string(fields[fieldRequestBody])
+	out.Sealed = nil
+	return &out, nil
+}
+
+// SealClientCertificate : returns a copy of the certificate with the private key moved into Sealed
+func (c *Cipher) SealClientCertificate(cert *model.ClientCertificate) (*model.ClientCertificate, error) {
+	if c == nil || cert.PrivateKey == "" {
+		return cert, nil
+	}
+
+	sealed, err := c.seal(clientCertificateAAD(cert), map[string][]byte{
+		fieldPrivateKey: []byte(cert.PrivateKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := *cert
+	out.PrivateKey = ""
+	out.Sealed = sealed
+	return &out, nil
+}
+
+// OpenClientCertificate : returns a copy of the certificate with the private key decrypted
+func (c *Cipher) OpenClientCertificate(cert *model.ClientCertificate) (*model.ClientCertificate, error) {
+	if cert.Sealed == nil {
+		return cert, nil
+	}
+
+	fields, err := c.open(clientCertificateAAD(cert), cert.Sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *cert
+	out.PrivateKey = string(fields[fieldPrivateKey])
+	out.Sealed = nil
+	return &out, nil
+}
+
+// SealResponse : seals a response body kept outside the database, e.g. for idempotent replays, under the name
+// of what it belongs to. A nil Cipher returns nil, the body is then kept as is.
+func (c *Cipher) SealResponse(name string, body []byte) (*model.Sealed, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return c.seal(responseAAD(name), map[string][]byte{fieldResponseBody: body})
+}
+
+// OpenResponse : the body sealed under name
+func (c *Cipher) OpenResponse(name string, sealed *model.Sealed) ([]byte, error) {
+	fields, err := c.open(responseAAD(name), sealed)
+	if err != nil {
+		return nil, err
+	}
+	return fields[fieldResponseBody], nil
+}
+
+// Rewrap : wraps the record's data key with the active key. The sealed fields are left untouched.
+func (c *Cipher) Rewrap(sealed *model.Sealed) (*model.Sealed, error) {
+	if c == nil {
+		return nil, errors.New("encryption is disabled")
+	}
+
+	dataKey, err := c.unwrap(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *sealed
+	out.KeyID, out.DataKey, err = c.wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+const (
+	fieldPayload         = "payload"
+	fieldNotificationKey = "notificationKey"
+	fieldPrivateKey      = "privateKey"
+	fieldAuth            = "auth"
+	fieldRequestBody     = "requestBody"
+	fieldResponseBody    = "responseBody"
+)
+
+// The additional data ties each ciphertext to its record and field, so sealed values cannot be swapped around
+func notificationAAD(n *model.Notification) string {
+	return "notification/" + n.ID.Hex()
+}
+
+// subscriptionAAD : live subscriptions keep the name from before modes, so their records still open
+func subscriptionAAD(s *model.NotificationSubscription) string {
+	if s.ID.Mode == "" {
+		return fmt.Sprintf("subscription/%s/%s", s.ID.MerchantID, s.ID.Type)
+	}
+	return fmt.Sprintf("subscription/%s/%s/%s", s.ID.MerchantID, s.ID.Type, s.ID.Mode)
+}
+
+func attemptAAD(a *model.NotificationAttempt) string {
+	return "attempt/" + a.ID.Hex()
+}
+
+func responseAAD(name string) string {
+	return "response/" + name
+}
+
+func clientCertificateAAD(cert *model.ClientCertificate) string {
+	return "clientCertificate/" + cert.ID.Hex()
+}
+
+func (c *Cipher) seal(aad string, fields map[string][]byte) (*model.Sealed, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := new(model.Sealed)
+	sealed.KeyID, sealed.DataKey, err = c.wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for field, plaintext := range fields {
+		ciphertext, err := encrypt(aead, plaintext, aad+"/"+field)
+		if err != nil {
+			return nil, err
+		}
+
+		switch field {
+		case fieldPayload:
+			sealed.Payload = ciphertext
+		case fieldNotificationKey:
+			sealed.NotificationKey = ciphertext
+		case fieldPrivateKey:
+			sealed.PrivateKey = ciphertext
+		case fieldAuth:
+			sealed.Auth = ciphertext
+		case fieldRequestBody:
+			sealed.RequestBody = ciphertext
+		case fieldResponseBody:
+			sealed.ResponseBody = ciphertext
+		}
+	}
+
+	return sealed, nil
+}
+
+func (c *Cipher) open(aad string, sealed *model.Sealed) (map[string][]byte, error) {
+	if c == nil {
+		return nil, errors.New("encryption is disabled, cannot open a sealed record")
+	}
+
+	dataKey, err := c.unwrap(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string][]byte)
+	for field, ciphertext := range map[string]string{
+		fieldPayload:         sealed.Payload,
+		fieldNotificationKey: sealed.NotificationKey,
+		fieldPrivateKey:      sealed.PrivateKey,
+		fieldAuth:            sealed.Auth,
+		fieldRequestBody:     sealed.RequestBody,
+		fieldResponseBody:    sealed.ResponseBody,
+	} {
+		if ciphertext == "" {
+			continue
+		}
+
+		plaintext, err := decrypt(aead, ciphertext, aad+"/"+field)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open %s: %w", field, err)
+		}
+		fields[field] = plaintext
+	}
+
+	return fields, nil
+}
+
+func (c *Cipher) wrap(dataKey []byte) (string, string, error) {
+	keyID := c.keyring.ActiveKeyID()
+	kek, err := c.keyring.key(keyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	wrapped, err := encrypt(kek, dataKey, keyID)
+	if err != nil {
+		return "", "", err
+	}
+	return keyID, wrapped, nil
+}
+
+func (c *Cipher) unwrap(sealed *model.Sealed) ([]byte, error) {
+	kek, err := c.keyring.key(sealed.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := decrypt(kek, sealed.DataKey, sealed.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// encrypt : returns base64(nonce || ciphertext)
+func encrypt(aead cipher.AEAD, plaintext []byte, aad string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(aad))), nil
+}
+
+func decrypt(aead cipher.AEAD, ciphertext string, aad string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(aad))
+}
@@ -0,0 +1,129 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize : key-encryption keys are AES-256 keys
+const KeySize = 32
+
+// Keyring : the key-encryption keys by ID. New data keys are wrapped with the active key, the others
+// are kept to open records sealed before a rotation.
+type Keyring struct {
+	activeKeyID string
+	keys        map[string]cipher.AEAD
+}
+
+// keyFile : the layout of ENCRYPTION_KEYFILE
+type keyFile struct {
+	ActiveKeyID string            `json:"activeKeyId"`
+	Keys        map[string]string `json:"keys"`
+}
+
+// NewKeyring :
+func NewKeyring(activeKeyID string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{activeKeyID: activeKeyID, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ":,") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes, got %d", id, KeySize, len(key))
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+
+	if _, ok := k.keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", activeKeyID)
+	}
+
+	return k, nil
+}
+
+// LoadKeyring : reads the keys from the JSON file at path when set, otherwise from keys, a comma separated
+// list of id:base64Key. It returns nil when neither is configured.
+func LoadKeyring(path string, keys string, activeKeyID string) (*Keyring, error) {
+	encoded := make(map[string]string)
+
+	switch {
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var file keyFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("cannot parse key file: %w", err)
+		}
+		encoded = file.Keys
+		if activeKeyID == "" {
+			activeKeyID = file.ActiveKeyID
+		}
+
+	case keys != "":
+		for _, each := range strings.Split(keys, ",") {
+			id, key, ok := strings.Cut(strings.TrimSpace(each), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid key %q, expected id:base64Key", each)
+			}
+			encoded[id] = key
+		}
+
+	default:
+		return nil, nil
+	}
+
+	if len(encoded) == 0 {
+		return nil, errors.New("no encryption key configured")
+	}
+
+	decoded := make(map[string][]byte, len(encoded))
+	for id, key := range encoded {
+		data, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		decoded[id] = data
+
+		// A single key needs no ENCRYPTION_ACTIVE_KEY_ID
+		if len(encoded) == 1 && activeKeyID == "" {
+			activeKeyID = id
+		}
+	}
+
+	return NewKeyring(activeKeyID, decoded)
+}
+
+// ActiveKeyID :
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeKeyID
+}
+
+func (k *Keyring) key(id string) (cipher.AEAD, error) {
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	return aead, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,175 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"xenotification/app/kit/bodyencoding"
+	"xenotification/app/kit/jsonpath"
+	"xenotification/app/model"
+	"xenotification/app/types"
+)
+
+// Validate : checks the fields are paths and each operator has the value it compares with
+func Validate(filters []model.SubscriptionFilter) error {
+	for i, each := range filters {
+		if err := validate(each); err != nil {
+			return fmt.Errorf("filters[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validate(f model.SubscriptionFilter) error {
+	if _, err := jsonpath.Parse(f.Field); err != nil {
+		return err
+	}
+
+	value, err := bodyencoding.Normalize(f.Value)
+	if err != nil {
+		return err
+	}
+
+	switch f.Operator {
+	case types.FilterOperatorEquals, types.FilterOperatorNotEquals:
+		if !isScalar(value) {
+			return fmt.Errorf("%s needs a string, number, boolean or null value", f.Operator)
+		}
+
+	case types.FilterOperatorIn, types.FilterOperatorNotIn:
+		values, ok := value.([]interface{})
+		if !ok || len(values) == 0 {
+			return fmt.Errorf("%s needs a list of values", f.Operator)
+		}
+		for _, each := range values {
+			if !isScalar(each) {
+				return fmt.Errorf("%s needs a list of strings, numbers, booleans or nulls", f.Operator)
+			}
+		}
+
+	case types.FilterOperatorGreaterThan, types.FilterOperatorGreaterThanOrEqual,
+		types.FilterOperatorLessThan, types.FilterOperatorLessThanOrEqual:
+		if _, ok := number(value); !ok {
+			return fmt.Errorf("%s needs a number value", f.Operator)
+		}
+
+	case types.FilterOperatorExists, types.FilterOperatorNotExists:
+		if value != nil {
+			return fmt.Errorf("%s takes no value", f.Operator)
+		}
+
+	default:
+		return fmt.Errorf("unknown operator %q", f.Operator)
+	}
+
+	return nil
+}
+
+// Match : whether the payload passes all the filters, true when there are none
+func Match(filters []model.SubscriptionFilter, payload interface{}) (bool, error) {
+	if len(filters) == 0 {
+		return true, nil
+	}
+
+	normalized, err := bodyencoding.Normalize(payload)
+	if err != nil {
+		return false, err
+	}
+
+	for _, each := range filters {
+		ok, err := match(each, normalized)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func match(f model.SubscriptionFilter, payload interface{}) (bool, error) {
+	path, err := jsonpath.Parse(f.Field)
+	if err != nil {
+		return false, err
+	}
+	field, exists := path.Lookup(payload)
+
+	// Values stored by Mongo come back as its own types, e.g. primitive.A for a list
+	value, err := bodyencoding.Normalize(f.Value)
+	if err != nil {
+		return false, err
+	}
+
+	switch f.Operator {
+	case types.FilterOperatorExists:
+		return exists, nil
+	case types.FilterOperatorNotExists:
+		return !exists, nil
+	case types.FilterOperatorEquals:
+		return exists && equal(field, value), nil
+	case types.FilterOperatorNotEquals:
+		return !exists || !equal(field, value), nil
+	case types.FilterOperatorIn, types.FilterOperatorNotIn:
+		found := false
+		if values, ok := value.([]interface{}); ok && exists {
+			for _, each := range values {
+				if equal(field, each) {
+					found = true
+					break
+				}
+			}
+		}
+		return found == (f.Operator == types.FilterOperatorIn), nil
+	}
+
+	// The numeric comparisons only hold for numbers
+	x, ok := number(field)
+	if !exists || !ok {
+		return false, nil
+	}
+	y, ok := number(value)
+	if !ok {
+		return false, fmt.Errorf("%s needs a number value", f.Operator)
+	}
+
+	switch cmp := x.Cmp(y); f.Operator {
+	case types.FilterOperatorGreaterThan:
+		return cmp > 0, nil
+	case types.FilterOperatorGreaterThanOrEqual:
+		return cmp >= 0, nil
+	case types.FilterOperatorLessThan:
+		return cmp < 0, nil
+	case types.FilterOperatorLessThanOrEqual:
+		return cmp <= 0, nil
+	}
+
+	return false, fmt.Errorf("unknown operator %q", f.Operator)
+}
+
+// equal : numbers compare by value so 100 equals 100.0, anything else must be the same scalar
+func equal(x, y interface{}) bool {
+	if a, ok := number(x); ok {
+		b, ok := number(y)
+		return ok && a.Cmp(b) == 0
+	}
+	if !isScalar(x) {
+		return false
+	}
+	return x == y
+}
+
+// number : exact, amounts must not be off by a rounding error at the boundary
+func number(v interface{}) (*big.Rat, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).SetString(string(n))
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case nil, string, bool, json.Number:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package filter
+
+import (
+	"testing"
+
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var payload = map[string]interface{}{
+	"amount":   150000.5,
+	"currency": "IDR",
+	"status":   "PAID",
+	"refunded": false,
+	"note":     nil,
+	"items": []interface{}{
+		map[string]interface{}{"sku": "A-1", "qty": 2},
+	},
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter model.SubscriptionFilter
+		want   bool
+	}{
+		{"equal string", model.SubscriptionFilter{Field: "$.currency", Operator: types.FilterOperatorEquals, Value: "IDR"}, true},
+		{"equal other string", model.SubscriptionFilter{Field: "$.currency", Operator: types.FilterOperatorEquals, Value: "USD"}, false},
+		{"equal number by value", model.SubscriptionFilter{Field: "$.items[0].qty", Operator: types.FilterOperatorEquals, Value: 2.0}, true},
+		{"equal boolean", model.SubscriptionFilter{Field: "refunded", Operator: types.FilterOperatorEquals, Value: false}, true},
+		{"equal null", model.SubscriptionFilter{Field: "$.note", Operator: types.FilterOperatorEquals, Value: nil}, true},
+		{"equal missing field", model.SubscriptionFilter{Field: "$.missing", Operator: types.FilterOperatorEquals, Value: nil}, false},
+		{"equal number and string", model.SubscriptionFilter{Field: "$.items[0].qty", Operator: types.FilterOperatorEquals, Value: "2"}, false},
+		{"not equal", model.SubscriptionFilter{Field: "$.status", Operator: types.FilterOperatorNotEquals, Value: "FAILED"}, true},
+		{"not equal missing field", model.SubscriptionFilter{Field: "$.missing", Operator: types.FilterOperatorNotEquals, Value: "x"}, true},
+		{"in", model.SubscriptionFilter{Field: "$.currency", Operator: types.FilterOperatorIn, Value: []interface{}{"USD", "IDR"}}, true},
+		{"not in list", model.SubscriptionFilter{Field: "$.currency", Operator: types.FilterOperatorIn, Value: []interface{}{"USD", "SGD"}}, false},
+		{"not in", model.SubscriptionFilter{Field: "$.currency", Operator: types.FilterOperatorNotIn, Value: []interface{}{"USD", "SGD"}}, true},
+		{"greater than", model.SubscriptionFilter{Field: "$.amount", Operator: types.FilterOperatorGreaterThan, Value: 150000}, true},
+		{"greater than exact boundary", model.SubscriptionFilter{Field: "$.amount", Operator: types.FilterOperatorGreaterThan, Value: 150000.5}, false},
+		{"greater than or equal", model.SubscriptionFilter{Field: "$.amount", Operator: types.FilterOperatorGreaterThanOrEqual, Value: 150000.5}, true},
+		{"less than", model.SubscriptionFilter{Field: "$.amount", Operator: types.FilterOperatorLessThan, Value: 100000}, false},
+		{"less than or equal", model.SubscriptionFilter{Field: "$.amount", Operator: types.FilterOperatorLessThanOrEqual, Value: 200000}, true},
+		{"compare a string", model.SubscriptionFilter{Field: "$.currency", Operator: types.FilterOperatorGreaterThan, Value: 0}, false},
+		{"compare a missing field", model.SubscriptionFilter{Field: "$.missing", Operator: types.FilterOperatorLessThan, Value: 0}, false},
+		{"exists", model.SubscriptionFilter{Field: "$.note", Operator: types.FilterOperatorExists}, true},
+		{"exists in array", model.SubscriptionFilter{Field: "$.items[1]", Operator: types.FilterOperatorExists}, false},
+		{"not exists", model.SubscriptionFilter{Field: "$.customer.name", Operator: types.FilterOperatorNotExists}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, Validate([]model.SubscriptionFilter{tt.filter}))
+
+			got, err := Match([]model.SubscriptionFilter{tt.filter}, payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	filters := []model.SubscriptionFilter{
+		{Field: "$.currency", Operator: types.FilterOperatorEquals, Value: "IDR"},
+		{Field: "$.amount", Operator: types.FilterOperatorGreaterThan, Value: 100000},
+	}
+
+	got, err := Match(filters, payload)
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	filters[1].Value = 200000
+	got, err = Match(filters, payload)
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	got, err = Match(nil, "anything")
+	assert.NoError(t, err)
+	assert.True(t, got)
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []model.SubscriptionFilter{
+		{Field: "$.items[first]", Operator: types.FilterOperatorExists},
+		{Field: "$.amount", Operator: "BETWEEN", Value: 1},
+		{Field: "$.amount", Operator: types.FilterOperatorGreaterThan, Value: "100"},
+		{Field: "$.amount", Operator: types.FilterOperatorGreaterThan},
+		{Field: "$.currency", Operator: types.FilterOperatorIn, Value: "IDR"},
+		{Field: "$.currency", Operator: types.FilterOperatorIn, Value: []interface{}{}},
+		{Field: "$.currency", Operator: types.FilterOperatorIn, Value: []interface{}{[]interface{}{"IDR"}}},
+		{Field: "$.customer", Operator: types.FilterOperatorEquals, Value: map[string]interface{}{"name": "Budi"}},
+		{Field: "$.note", Operator: types.FilterOperatorExists, Value: true},
+	}
+
+	for _, each := range invalid {
+		assert.Error(t, Validate([]model.SubscriptionFilter{each}), "%+v", each)
+	}
+}
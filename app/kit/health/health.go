@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Component status
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Report status
+const (
+	ReportOK          = "ok"
+	ReportDegraded    = "degraded"
+	ReportUnavailable = "unavailable"
+)
+
+// Check : a dependency probed by the readiness endpoint.
+// A failing critical check makes the service unavailable, other failures only degrade it.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// ComponentReport :
+type ComponentReport struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Latency  string `json:"latency"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report :
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentReport `json:"components"`
+}
+
+// Ready :
+func (r Report) Ready() bool {
+	return r.Status != ReportUnavailable
+}
+
+// Run : runs all checks concurrently, each bounded by timeout. A check still running when its context is done is
+// reported down and left to finish on its own, so Run returns by then whether or not the check honours ctx.
+func Run(ctx context.Context, timeout time.Duration, checks []Check) Report {
+	report := Report{
+		Status:     ReportOK,
+		Components: make(map[string]ComponentReport, len(checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			startAt := time.Now()
+			done := make(chan error, 1)
+			go func() {
+				done <- check.Run(checkCtx)
+			}()
+
+			var err error
+			select {
+			case err = <-done:
+			case <-checkCtx.Done():
+				err = checkCtx.Err()
+			}
+
+			component := ComponentReport{
+				Status:   StatusUp,
+				Critical: check.Critical,
+				Latency:  time.Since(startAt).String(),
+			}
+			if err != nil {
+				component.Status = StatusDown
+				component.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Components[check.Name] = component
+			if err != nil {
+				if check.Critical {
+					report.Status = ReportUnavailable
+				} else if report.Status == ReportOK {
+					report.Status = ReportDegraded
+				}
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return report
+}
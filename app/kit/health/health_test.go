@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	hung := make(chan struct{})
+	defer close(hung)
+
+	checks := []Check{
+		{Name: "up", Critical: true, Run: func(ctx context.Context) error { return nil }},
+		{Name: "failing", Run: func(ctx context.Context) error { return errors.New("stale") }},
+		// Ignores its context, as a client without timeouts would
+		{Name: "hung", Critical: true, Run: func(ctx context.Context) error {
+			<-hung
+			return nil
+		}},
+	}
+
+	startAt := time.Now()
+	report := Run(context.Background(), 50*time.Millisecond, checks)
+	assert.Less(t, time.Since(startAt), time.Second)
+
+	assert.Equal(t, ReportUnavailable, report.Status)
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusUp, report.Components["up"].Status)
+	assert.Equal(t, StatusDown, report.Components["failing"].Status)
+	assert.Equal(t, "stale", report.Components["failing"].Error)
+	assert.Equal(t, StatusDown, report.Components["hung"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Components["hung"].Error)
+
+	// The caller going away ends the run too
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report = Run(ctx, time.Minute, checks[2:])
+	assert.Equal(t, context.Canceled.Error(), report.Components["hung"].Error)
+
+	report = Run(context.Background(), time.Second, checks[:2])
+	assert.Equal(t, ReportDegraded, report.Status)
+	assert.True(t, report.Ready())
+}
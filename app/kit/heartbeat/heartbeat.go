@@ -0,0 +1,40 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Heartbeat names
+const (
+	CronSendNotification    = "cron-send-notification"
+	CronRecoverNotification = "cron-recover-notification"
+	CronArchiveNotification = "cron-archive-notification"
+)
+
+// ErrNoHeartbeat :
+var ErrNoHeartbeat = errors.New("no heartbeat recorded")
+
+// Store : records when a background worker last completed a run
+type Store interface {
+	Beat(ctx context.Context, name string) error
+	Last(ctx context.Context, name string) (time.Time, error)
+}
+
+// Check : returns a health check which fails when the named worker has not beaten within maxAge
+func Check(store Store, name string, maxAge time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		last, err := store.Last(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if age := time.Since(last); age > maxAge {
+			return fmt.Errorf("last heartbeat was %s ago", age.Truncate(time.Second))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,39 @@
+package heartbeat
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryStore struct {
+	mu    sync.RWMutex
+	beats map[string]time.Time
+}
+
+// NewMemory : creates a heartbeat store local to the process, for tests and single instance setups
+func NewMemory() Store {
+	return &memoryStore{beats: make(map[string]time.Time)}
+}
+
+// Beat :
+func (s *memoryStore) Beat(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.beats[name] = time.Now().UTC()
+	return nil
+}
+
+// Last :
+func (s *memoryStore) Last(ctx context.Context, name string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	last, ok := s.beats[name]
+	if !ok {
+		return time.Time{}, ErrNoHeartbeat
+	}
+
+	return last, nil
+}
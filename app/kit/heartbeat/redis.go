@@ -0,0 +1,43 @@
+package heartbeat
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const redisKeyPrefix = "xenotification:heartbeat:"
+
+type redisStore struct {
+	pool *redis.Pool
+}
+
+// NewRedis : creates a heartbeat store shared by every instance through redis
+func NewRedis(pool *redis.Pool) Store {
+	return &redisStore{pool: pool}
+}
+
+// Beat :
+func (s *redisStore) Beat(ctx context.Context, name string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", redisKeyPrefix+name, time.Now().UTC().Unix())
+	return err
+}
+
+// Last :
+func (s *redisStore) Last(ctx context.Context, name string) (time.Time, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	unix, err := redis.Int64(conn.Do("GET", redisKeyPrefix+name))
+	if err == redis.ErrNil {
+		return time.Time{}, ErrNoHeartbeat
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(unix, 0).UTC(), nil
+}
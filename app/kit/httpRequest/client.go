@@ -0,0 +1,205 @@
+package httprequest
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Options : how the client connects to the merchant. Zero durations and sizes mean no limit.
+type Options struct {
+	ConnectTimeout      time.Duration
+	TLSHandshakeTimeout time.Duration
+	// Timeout : the whole request, from dialing to reading the response body
+	Timeout         time.Duration
+	MaxResponseSize int64
+	// MaxRedirects : zero does not follow redirects
+	MaxRedirects        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// ProxyURL : when empty, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables apply
+	ProxyURL string
+	// CABundle : PEM encoded certificates trusted on top of the system roots
+	CABundle string
+	// RootCAs : PEM encoded certificates trusted instead of the system roots and CABundle
+	RootCAs string
+	// ClientCertificate, ClientKey : PEM encoded, presented when the server asks for a certificate
+	ClientCertificate string
+	ClientKey         string
+}
+
+const (
+	// maxClients : how many pooled clients made for non-default Options are kept, the least recently used one
+	// is dropped past that
+	maxClients = 256
+	// clientIdleTimeout : pooled clients unused for longer are dropped
+	clientIdleTimeout = 10 * time.Minute
+)
+
+// Client : an HTTP client sharing its connection pool between requests. Requests made with other
+// Options get their own pooled client, created on first use and kept while it is among the maxClients most
+// recently used and not idle for clientIdleTimeout. The clients are keyed by a digest of their Options, which
+// hold client keys.
+type Client struct {
+	defaults   Options
+	fallback   *resty.Client
+	maxClients int
+	mu         sync.Mutex
+	clients    map[[sha256.Size]byte]*list.Element
+	recent     *list.List
+}
+
+type pooledClient struct {
+	digest   [sha256.Size]byte
+	client   *resty.Client
+	lastUsed time.Time
+}
+
+// New : fails when the default options cannot be applied, e.g. an invalid CA bundle
+func New(defaults Options) (*Client, error) {
+	fallback, err := newRestyClient(defaults)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		defaults:   defaults,
+		fallback:   fallback,
+		maxClients: maxClients,
+		clients:    make(map[[sha256.Size]byte]*list.Element),
+		recent:     list.New(),
+	}, nil
+}
+
+// Defaults : the options requests are made with unless overridden
+func (c *Client) Defaults() Options {
+	return c.defaults
+}
+
+// Validate : checks the options can be applied, without keeping a client for them
+func (o Options) Validate() error {
+	_, err := newRestyClient(o)
+	return err
+}
+
+func (o Options) digest() [sha256.Size]byte {
+	data, _ := json.Marshal(o)
+	return sha256.Sum256(data)
+}
+
+func (c *Client) client(opts Options) (*resty.Client, error) {
+	if opts == c.defaults {
+		return c.fallback, nil
+	}
+
+	digest := opts.digest()
+
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	defer c.evict(now)
+
+	if element, ok := c.clients[digest]; ok {
+		pooled := element.Value.(*pooledClient)
+		pooled.lastUsed = now
+		c.recent.MoveToFront(element)
+		return pooled.client, nil
+	}
+
+	client, err := newRestyClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[digest] = c.recent.PushFront(&pooledClient{digest: digest, client: client, lastUsed: now})
+
+	return client, nil
+}
+
+// evict : drops the clients past maxClients or idle for clientIdleTimeout, closing their idle connections.
+// Requests still in flight on them finish, their connections then close after the idle connection timeout.
+func (c *Client) evict(now time.Time) {
+	for oldest := c.recent.Back(); oldest != nil; oldest = c.recent.Back() {
+		pooled := oldest.Value.(*pooledClient)
+		if c.recent.Len() <= c.maxClients && now.Sub(pooled.lastUsed) < clientIdleTimeout {
+			return
+		}
+
+		c.recent.Remove(oldest)
+		delete(c.clients, pooled.digest)
+		pooled.client.GetClient().CloseIdleConnections()
+	}
+}
+
+func newRestyClient(o Options) (*resty.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch {
+	case o.RootCAs != "":
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(o.RootCAs)) {
+			return nil, errors.New("root CAs hold no valid certificate")
+		}
+		tlsConfig.RootCAs = pool
+
+	case o.CABundle != "":
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(o.CABundle)) {
+			return nil, errors.New("CA bundle holds no valid certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if o.ClientCertificate != "" {
+		certificate, err := tls.X509KeyPair([]byte(o.ClientCertificate), []byte(o.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if o.ProxyURL != "" {
+		proxyURL, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   o.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: o.TLSHandshakeTimeout,
+		MaxIdleConnsPerHost: o.MaxIdleConnsPerHost,
+		IdleConnTimeout:     o.IdleConnTimeout,
+		ForceAttemptHTTP2:   true,
+	}
+
+	redirectPolicy := resty.NoRedirectPolicy()
+	if o.MaxRedirects > 0 {
+		redirectPolicy = resty.FlexibleRedirectPolicy(o.MaxRedirects)
+	}
+
+	return resty.New().
+		SetTransport(transport).
+		SetTimeout(o.Timeout).
+		SetRedirectPolicy(redirectPolicy), nil
+}
@@ -0,0 +1,42 @@
+package httprequest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientPool(t *testing.T) {
+	c, err := New(Options{Timeout: time.Second})
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.maxClients = 2
+
+	// The defaults always get the same client, outside the pool
+	fallback, _ := c.client(Options{Timeout: time.Second})
+	assert.Same(t, c.fallback, fallback)
+	assert.Zero(t, c.recent.Len())
+
+	first, _ := c.client(Options{Timeout: time.Second, ClientKey: "key-1"})
+	again, _ := c.client(Options{Timeout: time.Second, ClientKey: "key-1"})
+	assert.Same(t, first, again)
+
+	// A third client drops the least recently used one
+	c.client(Options{Timeout: time.Second, ClientKey: "key-2"})
+	c.client(Options{Timeout: time.Second, ClientKey: "key-1"})
+	c.client(Options{Timeout: time.Second, ClientKey: "key-3"})
+	assert.Equal(t, 2, c.recent.Len())
+	assert.Contains(t, c.clients, Options{Timeout: time.Second, ClientKey: "key-1"}.digest())
+	assert.NotContains(t, c.clients, Options{Timeout: time.Second, ClientKey: "key-2"}.digest())
+
+	// and idle clients are dropped on the next use of the pool
+	c.clients[Options{Timeout: time.Second, ClientKey: "key-1"}.digest()].Value.(*pooledClient).lastUsed = time.Now().Add(-clientIdleTimeout)
+	c.client(Options{Timeout: time.Second, ClientKey: "key-3"})
+	assert.Equal(t, 1, c.recent.Len())
+	assert.NotContains(t, c.clients, Options{Timeout: time.Second, ClientKey: "key-1"}.digest())
+
+	recreated, _ := c.client(Options{Timeout: time.Second, ClientKey: "key-1"})
+	assert.NotSame(t, first, recreated)
+}
@@ -1,54 +1,157 @@
 package httprequest
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"net/http"
 	"reflect"
+	"strings"
+	"time"
+
+	"xenotification/app/kit/tracing"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/imdario/mergo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// HttpAPI :
-func HttpAPI(method, requestURL string, headers map[string]string, request, response interface{}) (int, error) {
+// Exchange : a request as it was sent and the response as it was received. The response fields stay empty
+// when none came back.
+type Exchange struct {
+	Method          string
+	URL             string
+	RequestHeaders  map[string]string
+	RequestBody     []byte
+	StatusCode      int
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	// ResponseTruncated : the response body was over Options.MaxResponseSize, ResponseBody holds its start
+	ResponseTruncated bool
+	Duration          time.Duration
+}
+
+type exchangeKey struct{}
+
+// WithExchange : HttpAPI records the requests made with the returned context into exchange, the last one
+// overwriting the others. A nil exchange stops the recording.
+func WithExchange(ctx context.Context, exchange *Exchange) context.Context {
+	return context.WithValue(ctx, exchangeKey{}, exchange)
+}
+
+// HttpAPI : sends request as the JSON body, or as is when it is a []byte with its Content-Type in headers.
+// The JSON response is decoded into response; any other response is decoded as a string, for response
+// types which can hold one. A response over Options.MaxResponseSize is cut to that size rather than failing
+// the request, the endpoint has already answered with its status.
+func (c *Client) HttpAPI(ctx context.Context, opts Options, method, requestURL string, headers map[string]string, request, response interface{}) (int, error) {
 	if reflect.ValueOf(response).Kind() != reflect.Ptr {
 		return 0, errors.New("response struct should be pointer")
 	}
 
+	method = strings.ToUpper(method)
+
+	ctx, span := tracing.Start(ctx, "HTTP "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.full", requestURL),
+		),
+	)
+	defer span.End()
+
+	fail := func(err error) (int, error) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, err
+	}
+
+	client, err := c.client(opts)
+	if err != nil {
+		return fail(err)
+	}
+
 	head := map[string]string{
 		"Content-Type": "application/json",
 	}
 
 	mergo.Merge(&headers, head)
 
-	// startAt := time.Now().UTC()
-	var resp *resty.Response
-	client := resty.New().
-		SetDebug(false).
+	// Propagate the trace to the receiver
+	tracing.Inject(ctx, headers)
+
+	req := client.R().
+		SetContext(ctx).
 		SetHeaders(headers).
-		// SetTimeout(15 * time.Minute).
-		OnAfterResponse(func(_ *resty.Client, rsp *resty.Response) error {
-			// if c.logger != nil {
-			// 	go c.logger.LogAPI(c.requestID, request, rsp)
-			// }
-			return nil
-		}).R()
-
-	var err error
-	switch method {
-	case "get":
-		resp, err = client.Get(requestURL)
-	default:
-		resp, err = client.SetBody(request).Post(requestURL)
+		SetDoNotParseResponse(true)
+	if method != http.MethodGet && method != http.MethodHead {
+		req.SetBody(request)
+	}
+
+	exchange, _ := ctx.Value(exchangeKey{}).(*Exchange)
+	if exchange != nil {
+		*exchange = Exchange{Method: method, URL: requestURL, RequestHeaders: make(map[string]string, len(headers))}
+		for name, value := range headers {
+			exchange.RequestHeaders[name] = value
+		}
+		if data, ok := request.([]byte); ok {
+			exchange.RequestBody = data
+		} else if method != http.MethodGet && method != http.MethodHead && request != nil {
+			exchange.RequestBody, _ = json.Marshal(request)
+		}
+	}
+
+	start := time.Now()
+	resp, err := req.Execute(method, requestURL)
+	if exchange != nil {
+		exchange.Duration = time.Since(start)
 	}
 	if err != nil {
-		return 0, err
+		return fail(err)
+	}
+
+	if exchange != nil {
+		exchange.StatusCode = resp.StatusCode()
+		exchange.ResponseHeaders = resp.Header()
+	}
+
+	body := resp.RawBody()
+	defer body.Close()
+
+	reader := io.Reader(body)
+	if opts.MaxResponseSize > 0 {
+		reader = io.LimitReader(body, opts.MaxResponseSize+1)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fail(err)
+	}
+
+	truncated := opts.MaxResponseSize > 0 && int64(len(data)) > opts.MaxResponseSize
+	if truncated {
+		data = data[:opts.MaxResponseSize]
+	}
+
+	if exchange != nil {
+		exchange.ResponseBody = data
+		exchange.ResponseTruncated = truncated
+	}
+
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", resp.StatusCode()),
+		attribute.Bool("http.response.body.truncated", truncated),
+	)
+	if resp.StatusCode() >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status())
 	}
 
-	if response != nil {
-		err := json.Unmarshal(resp.Body(), &response)
-		if err != nil {
-			return 0, err
+	if response != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &response); err != nil {
+			// e.g. legacy endpoints answering in XML or plain text
+			quoted, _ := json.Marshal(string(data))
+			json.Unmarshal(quoted, &response)
 		}
 	}
 
@@ -0,0 +1,54 @@
+package httprequest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseSizeLimit(t *testing.T) {
+	body := strings.Repeat("a", 32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		maxSize       int64
+		wantBody      string
+		wantTruncated bool
+	}{
+		{"no limit", 0, body, false},
+		{"under the limit", 64, body, false},
+		{"at the limit", 32, body, false},
+		{"over the limit", 16, body[:16], true},
+	}
+
+	c, err := New(Options{Timeout: 5 * time.Second})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exchange := new(Exchange)
+			var resp interface{}
+			statusCode, err := c.HttpAPI(WithExchange(context.Background(), exchange), Options{Timeout: 5 * time.Second, MaxResponseSize: tt.maxSize}, http.MethodPost, server.URL, map[string]string{}, []byte("{}"), &resp)
+
+			// The endpoint's answer stands, only the body kept is cut
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusAccepted, statusCode)
+			assert.Equal(t, http.StatusAccepted, exchange.StatusCode)
+			assert.Equal(t, tt.wantBody, string(exchange.ResponseBody))
+			assert.Equal(t, tt.wantTruncated, exchange.ResponseTruncated)
+			assert.Equal(t, tt.wantBody, resp)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"xenotification/app/model"
+)
+
+// ErrInProgress : another request with the same key has not finished yet
+var ErrInProgress = errors.New("a request with this idempotency key is in progress")
+
+// Record : the first response served for an idempotency key
+type Record struct {
+	// RequestHash : the request body's hash, a retry must send the same body
+	RequestHash string `json:"requestHash"`
+	// Status : zero while the first request is still being served
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+	// Sealed : the body instead, when encryption at rest is enabled
+	Sealed *model.Sealed `json:"sealed,omitempty"`
+}
+
+// Completed :
+func (r Record) Completed() bool {
+	return r.Status != 0
+}
+
+// Store : keeps the responses of requests sent with an Idempotency-Key header
+type Store interface {
+	// Begin : claims the key for a request, for up to lease. When the key is already taken the record
+	// found is returned instead, it is still in progress unless Completed.
+	Begin(ctx context.Context, key string, requestHash string, lease time.Duration) (*Record, error)
+	// Complete : stores the response for ttl
+	Complete(ctx context.Context, key string, record Record, ttl time.Duration) error
+	// Release : frees a claimed key so the request can be retried
+	Release(ctx context.Context, key string) error
+}
@@ -0,0 +1,55 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+}
+
+type memoryRecord struct {
+	record    Record
+	expiresAt time.Time
+}
+
+// NewMemory : creates an idempotency store local to the process, for tests and single instance setups
+func NewMemory() Store {
+	return &memoryStore{records: make(map[string]memoryRecord)}
+}
+
+// Begin :
+func (s *memoryStore) Begin(ctx context.Context, key string, requestHash string, lease time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[key]; ok && time.Now().Before(existing.expiresAt) {
+		record := existing.record
+		return &record, nil
+	}
+
+	s.records[key] = memoryRecord{record: Record{RequestHash: requestHash}, expiresAt: time.Now().Add(lease)}
+	return nil, nil
+}
+
+// Complete :
+func (s *memoryStore) Complete(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.Body = append([]byte(nil), record.Body...)
+	s.records[key] = memoryRecord{record: record, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Release :
+func (s *memoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
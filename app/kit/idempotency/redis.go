@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const redisKeyPrefix = "xenotification:idempotency:"
+
+type redisStore struct {
+	pool *redis.Pool
+}
+
+// NewRedis : creates an idempotency store shared by every instance through redis
+func NewRedis(pool *redis.Pool) Store {
+	return &redisStore{pool: pool}
+}
+
+// Begin :
+func (s *redisStore) Begin(ctx context.Context, key string, requestHash string, lease time.Duration) (*Record, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	claim, err := json.Marshal(Record{RequestHash: requestHash})
+	if err != nil {
+		return nil, err
+	}
+
+	// The key may expire between SET NX and GET, try again once
+	for i := 0; i < 2; i++ {
+		_, err := redis.String(conn.Do("SET", redisKeyPrefix+key, claim, "NX", "PX", lease.Milliseconds()))
+		if err == nil {
+			return nil, nil
+		} else if err != redis.ErrNil {
+			return nil, err
+		}
+
+		data, err := redis.Bytes(conn.Do("GET", redisKeyPrefix+key))
+		if err == redis.ErrNil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		record := new(Record)
+		if err := json.Unmarshal(data, record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+
+	return nil, ErrInProgress
+}
+
+// Complete :
+func (s *redisStore) Complete(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("SET", redisKeyPrefix+key, data, "PX", ttl.Milliseconds())
+	return err
+}
+
+// Release :
+func (s *redisStore) Release(ctx context.Context, key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", redisKeyPrefix+key)
+	return err
+}
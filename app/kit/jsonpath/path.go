@@ -0,0 +1,94 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path : a JSONPath subset, $ followed by .name, ['name'] and [index] steps. The leading $ is optional.
+type Path []step
+
+type step struct {
+	name  string
+	index int
+	// isIndex : selects an array item rather than an object field
+	isIndex bool
+}
+
+// Parse :
+func Parse(expression string) (Path, error) {
+	s := strings.TrimSpace(expression)
+	if s == "" {
+		return nil, errors.New("empty path")
+	}
+
+	s = strings.TrimPrefix(s, "$")
+	if s != "" && s[0] != '.' && s[0] != '[' {
+		s = "." + s
+	}
+
+	var p Path
+	for s != "" {
+		switch s[0] {
+		case '.':
+			end := strings.IndexAny(s[1:], ".[")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			name := s[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("invalid path %q: empty field name", expression)
+			}
+			p = append(p, step{name: name})
+			s = s[end+1:]
+
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unclosed bracket", expression)
+			}
+			inner := s[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p = append(p, step{name: inner[1 : len(inner)-1]})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid path %q: %q is not an index", expression, inner)
+				}
+				p = append(p, step{index: index, isIndex: true})
+			}
+			s = s[end+1:]
+
+		default:
+			return nil, fmt.Errorf("invalid path %q", expression)
+		}
+	}
+
+	return p, nil
+}
+
+// Lookup : the value at the path in v, which holds what encoding/json decodes to. ok is false when the path
+// does not exist, a null value exists.
+func (p Path) Lookup(v interface{}) (value interface{}, ok bool) {
+	for _, each := range p {
+		if each.isIndex {
+			items, isArray := v.([]interface{})
+			if !isArray || each.index >= len(items) {
+				return nil, false
+			}
+			v = items[each.index]
+			continue
+		}
+
+		object, isObject := v.(map[string]interface{})
+		if !isObject {
+			return nil, false
+		}
+		if v, ok = object[each.name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,86 @@
+package jsonpath
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var document = map[string]interface{}{
+	"id":   "inv-1",
+	"note": nil,
+	"customer": map[string]interface{}{
+		"name":       "Budi",
+		"given name": "Budi",
+	},
+	"items": []interface{}{
+		map[string]interface{}{"sku": "A-1", "qty": 2.0},
+		map[string]interface{}{"sku": "B-2", "tags": []interface{}{"new"}},
+	},
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       interface{}
+		wantOK     bool
+	}{
+		{"root", "$", document, true},
+		{"field", "$.id", "inv-1", true},
+		{"field without $", "id", "inv-1", true},
+		{"field without the dot", "$id", "inv-1", true},
+		{"nested field", "$.customer.name", "Budi", true},
+		{"quoted field", "$.customer['given name']", "Budi", true},
+		{"double quoted field", `$["customer"]["name"]`, "Budi", true},
+		{"null exists", "$.note", nil, true},
+		{"missing field", "$.missing", nil, false},
+		{"missing nested field", "$.customer.email", nil, false},
+		{"field of a string", "$.id.length", nil, false},
+		{"array index", "$.items[0].sku", "A-1", true},
+		{"second array index", "$.items[1].sku", "B-2", true},
+		{"nested array index", "$.items[1].tags[0]", "new", true},
+		{"index out of range", "$.items[2]", nil, false},
+		{"index of an object", "$.customer[0]", nil, false},
+		{"field of an array", "$.items.sku", nil, false},
+		{"field missing in an item", "$.items[0].tags", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := Parse(tt.expression)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			got, ok := path.Lookup(document)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+	}{
+		{"empty", ""},
+		{"blank", "  "},
+		{"empty field name", "$.customer..name"},
+		{"trailing dot", "$.customer."},
+		{"unclosed bracket", "$.items[0"},
+		{"negative index", "$.items[-1]"},
+		{"not an index", "$.items[first]"},
+		{"wildcard", "$.items[*]"},
+		{"unbalanced quotes", "$.customer['name\"]"},
+		{"stray characters", "$.items[0]sku"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expression)
+			assert.Error(t, err)
+		})
+	}
+}
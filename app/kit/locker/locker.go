@@ -0,0 +1,21 @@
+package locker
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotObtained : the lock is held by someone else
+var ErrNotObtained = errors.New("lock not obtained")
+
+// Locker : hands out named mutexes shared by every instance of the service
+type Locker interface {
+	NewMutex(name string, expiry time.Duration) Mutex
+}
+
+// Mutex : a lock which expires on its own if the holder never releases it
+type Mutex interface {
+	Lock() error
+	// Unlock : reports false when the lock was no longer held, e.g. because it expired
+	Unlock() (bool, error)
+}
@@ -0,0 +1,61 @@
+package locker
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]memoryLock
+}
+
+type memoryLock struct {
+	owner     *memoryMutex
+	expiresAt time.Time
+}
+
+// NewMemory : creates a locker local to the process, for tests and single instance setups.
+// Unlike redsync it does not retry, Lock fails straight away with ErrNotObtained when the lock is held.
+func NewMemory() Locker {
+	return &memoryLocker{locks: make(map[string]memoryLock)}
+}
+
+// NewMutex :
+func (l *memoryLocker) NewMutex(name string, expiry time.Duration) Mutex {
+	return &memoryMutex{locker: l, name: name, expiry: expiry}
+}
+
+type memoryMutex struct {
+	locker *memoryLocker
+	name   string
+	expiry time.Duration
+}
+
+// Lock :
+func (m *memoryMutex) Lock() error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	now := time.Now()
+	if held, ok := m.locker.locks[m.name]; ok && now.Before(held.expiresAt) {
+		return ErrNotObtained
+	}
+
+	m.locker.locks[m.name] = memoryLock{owner: m, expiresAt: now.Add(m.expiry)}
+	return nil
+}
+
+// Unlock :
+func (m *memoryMutex) Unlock() (bool, error) {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	held, ok := m.locker.locks[m.name]
+	if !ok || held.owner != m {
+		return false, nil
+	}
+
+	delete(m.locker.locks, m.name)
+	return time.Now().Before(held.expiresAt), nil
+}
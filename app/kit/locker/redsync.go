@@ -0,0 +1,21 @@
+package locker
+
+import (
+	"time"
+
+	"github.com/go-redsync/redsync"
+)
+
+type redsyncLocker struct {
+	rs *redsync.Redsync
+}
+
+// NewRedsync : creates a locker backed by redis through redsync
+func NewRedsync(rs *redsync.Redsync) Locker {
+	return &redsyncLocker{rs: rs}
+}
+
+// NewMutex :
+func (l *redsyncLocker) NewMutex(name string, expiry time.Duration) Mutex {
+	return l.rs.NewMutex(name, redsync.SetExpiry(expiry))
+}
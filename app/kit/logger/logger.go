@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type contextKey struct{}
+
+// New : creates a logger writing to w, level is one of debug, info, warn or error
+func New(w io.Writer, level, format string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(handler)
+}
+
+// NewContext : returns a copy of ctx carrying l
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext : returns the logger carried by ctx, or fallback when there is none.
+// The trace and span IDs of the span in ctx are attached to the returned logger.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	l := fallback
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if v, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		l = v
+	}
+	if l == nil {
+		l = slog.Default()
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		l = l.With(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+
+	return l
+}
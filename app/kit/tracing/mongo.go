@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewMongoMonitor : creates a command monitor which records a span for every mongo command
+func NewMongoMonitor() *event.CommandMonitor {
+	var spans sync.Map
+
+	key := func(connectionID string, requestID int64) interface{} {
+		return struct {
+			connectionID string
+			requestID    int64
+		}{connectionID, requestID}
+	}
+
+	finish := func(connectionID string, requestID int64, err error) {
+		v, ok := spans.LoadAndDelete(key(connectionID, requestID))
+		if !ok {
+			return
+		}
+
+		span := v.(trace.Span)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			collection := ""
+			if v, err := evt.Command.LookupErr(evt.CommandName); err == nil {
+				collection, _ = v.StringValueOK()
+			}
+
+			_, span := Start(ctx, "mongodb."+evt.CommandName,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("db.system", "mongodb"),
+					attribute.String("db.name", evt.DatabaseName),
+					attribute.String("db.operation", evt.CommandName),
+					attribute.String("db.mongodb.collection", collection),
+				),
+			)
+			spans.Store(key(evt.ConnectionID, evt.RequestID), span)
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			finish(evt.ConnectionID, evt.RequestID, nil)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			finish(evt.ConnectionID, evt.RequestID, errors.New(evt.Failure))
+		},
+	}
+}
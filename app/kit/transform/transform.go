@@ -0,0 +1,160 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"xenotification/app/kit/bodyencoding"
+	"xenotification/app/kit/jsonpath"
+	"xenotification/app/model"
+	"xenotification/app/types"
+)
+
+// MaxOutputSize : rendering stops with an error past this many bytes, e.g. on a runaway range
+const MaxOutputSize = 1 << 20
+
+// ErrOutputTooLarge :
+var ErrOutputTooLarge = fmt.Errorf("transform output is over %d bytes", MaxOutputSize)
+
+var funcs = template.FuncMap{
+	// json : the value as JSON, for embedding objects and quoting strings in JSON templates
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Validate : parses the template or the projection's paths
+func Validate(t *model.PayloadTransform) error {
+	switch t.Type {
+	case types.TransformTypeTemplate:
+		if strings.TrimSpace(t.Template) == "" {
+			return errors.New("template transform needs a template")
+		}
+		_, err := parseTemplate(t.Template)
+		return err
+
+	case types.TransformTypeProjection:
+		if len(t.Projection) == 0 {
+			return errors.New("projection transform needs at least one field")
+		}
+		for field, expression := range t.Projection {
+			if field == "" || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") || strings.Contains(field, "..") {
+				return fmt.Errorf("invalid output field %q", field)
+			}
+			if _, err := jsonpath.Parse(expression); err != nil {
+				return fmt.Errorf("%s: %w", field, err)
+			}
+		}
+		return checkFields(t.Projection)
+	}
+
+	return fmt.Errorf("unknown transform type %q", t.Type)
+}
+
+// Apply : reshapes body. A template's output is parsed when it is JSON and kept as a string otherwise,
+// either way it is then encoded like any other body.
+func Apply(t *model.PayloadTransform, body interface{}) (interface{}, error) {
+	normalized, err := bodyencoding.Normalize(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Type {
+	case types.TransformTypeTemplate:
+		return render(t.Template, normalized)
+	case types.TransformTypeProjection:
+		return project(t.Projection, normalized)
+	}
+
+	return nil, fmt.Errorf("unknown transform type %q", t.Type)
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("transform").Funcs(funcs).Option("missingkey=zero").Parse(text)
+}
+
+func render(text string, v interface{}) (interface{}, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &limitedBuffer{limit: MaxOutputSize}
+	if err := tmpl.Execute(w, v); err != nil {
+		if errors.Is(err, ErrOutputTooLarge) {
+			return nil, ErrOutputTooLarge
+		}
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(w.Bytes()))
+	decoder.UseNumber()
+
+	var parsed interface{}
+	if err := decoder.Decode(&parsed); err == nil && !decoder.More() {
+		return parsed, nil
+	}
+	return w.String(), nil
+}
+
+func project(projection map[string]string, v interface{}) (interface{}, error) {
+	// A field is never the parent of another one, see checkFields, so the order only makes errors stable
+	fields := make([]string, 0, len(projection))
+	for field := range projection {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	out := make(map[string]interface{}, len(projection))
+	for _, field := range fields {
+		path, err := jsonpath.Parse(projection[field])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+
+		parent := out
+		names := strings.Split(field, ".")
+		for _, name := range names[:len(names)-1] {
+			child, ok := parent[name].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				parent[name] = child
+			}
+			parent = child
+		}
+		parent[names[len(names)-1]], _ = path.Lookup(v)
+	}
+
+	return out, nil
+}
+
+// checkFields : a field cannot be both a value and the parent of another field, e.g. customer and customer.name
+func checkFields(projection map[string]string) error {
+	for field := range projection {
+		for other := range projection {
+			if strings.HasPrefix(other, field+".") {
+				return fmt.Errorf("output field %q is also the parent of %q", field, other)
+			}
+		}
+	}
+	return nil
+}
+
+// limitedBuffer : fails writes past the limit, which stops the template
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, ErrOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,105 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var body = map[string]interface{}{
+	"id":   "evt-1",
+	"type": "invoice.paid",
+	"data": map[string]interface{}{
+		"id":     "inv-1",
+		"amount": 100000.5,
+		"customer": map[string]interface{}{
+			"name": "Budi",
+		},
+		"items": []interface{}{
+			map[string]interface{}{"sku": "A-1", "qty": 2},
+		},
+		"weird.key": true,
+	},
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform model.PayloadTransform
+		want      string
+	}{
+		{
+			name: "template rendering JSON is parsed",
+			transform: model.PayloadTransform{
+				Type:     types.TransformTypeTemplate,
+				Template: `{"text": {{json (printf "Invoice %s paid by %s" .data.id .data.customer.name)}}, "amount": {{.data.amount}}, "items": {{json .data.items}}}`,
+			},
+			want: `{"amount":100000.5,"items":[{"qty":2,"sku":"A-1"}],"text":"Invoice inv-1 paid by Budi"}`,
+		},
+		{
+			name: "template rendering text is a string",
+			transform: model.PayloadTransform{
+				Type:     types.TransformTypeTemplate,
+				Template: `{{.type}}: {{.data.id}}{{range .data.items}} {{.sku}}x{{.qty}}{{end}}`,
+			},
+			want: `"invoice.paid: inv-1 A-1x2"`,
+		},
+		{
+			name: "projection",
+			transform: model.PayloadTransform{
+				Type: types.TransformTypeProjection,
+				Projection: map[string]string{
+					"invoice_id":    "$.data.id",
+					"customer.name": "data.customer.name",
+					"first_sku":     "$.data.items[0].sku",
+					"flag":          "$.data['weird.key']",
+					"missing":       "$.data.items[5].sku",
+				},
+			},
+			want: `{"customer":{"name":"Budi"},"first_sku":"A-1","flag":true,"invoice_id":"inv-1","missing":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !assert.NoError(t, Validate(&tt.transform)) {
+				return
+			}
+
+			out, err := Apply(&tt.transform, body)
+			if assert.NoError(t, err) {
+				data, _ := json.Marshal(out)
+				assert.JSONEq(t, tt.want, string(data))
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, transform := range map[string]model.PayloadTransform{
+		"unknown type":        {Type: "JQ"},
+		"empty template":      {Type: types.TransformTypeTemplate, Template: " "},
+		"unparsable template": {Type: types.TransformTypeTemplate, Template: "{{.data.id"},
+		"unknown function":    {Type: types.TransformTypeTemplate, Template: "{{env \"SECRET\"}}"},
+		"empty projection":    {Type: types.TransformTypeProjection},
+		"unclosed bracket":    {Type: types.TransformTypeProjection, Projection: map[string]string{"id": "$.data[0"}},
+		"negative index":      {Type: types.TransformTypeProjection, Projection: map[string]string{"id": "$.data[-1]"}},
+		"parent and child":    {Type: types.TransformTypeProjection, Projection: map[string]string{"a": "$.id", "a.b": "$.type"}},
+		"empty field segment": {Type: types.TransformTypeProjection, Projection: map[string]string{"a..b": "$.id"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, Validate(&transform))
+		})
+	}
+}
+
+func TestApplyOutputLimit(t *testing.T) {
+	transform := &model.PayloadTransform{Type: types.TransformTypeTemplate, Template: `{{range 100000000}}xxxxxxxxxx{{end}}`}
+
+	_, err := Apply(transform, body)
+	assert.ErrorIs(t, err, ErrOutputTooLarge)
+}
@@ -0,0 +1,231 @@
+package webhookauth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	httprequest "xenotification/app/kit/httpRequest"
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Authenticator : a strategy adding a subscription's credentials to its webhooks
+type Authenticator interface {
+	// Apply : sets the credentials on the outgoing headers
+	Apply(ctx context.Context, headers map[string]string) error
+	// Refresh : called after the endpoint answered 401, reports whether sending again may succeed
+	Refresh() bool
+}
+
+// Provider : picks the Authenticator for a subscription and keeps the OAuth2 tokens fetched for it.
+// It is safe for concurrent use, concurrent deliveries missing the same token share one fetch.
+type Provider struct {
+	client  *httprequest.Client
+	tokens  *tokenCache
+	fetches singleflight.Group
+}
+
+// NewProvider : tokens are fetched with client
+func NewProvider(client *httprequest.Client) *Provider {
+	return &Provider{client: client, tokens: newTokenCache()}
+}
+
+// Authenticator : opts reach the token URL. A nil auth gives an Authenticator adding nothing.
+func (p *Provider) Authenticator(auth *model.SubscriptionAuth, opts httprequest.Options) (Authenticator, error) {
+	if auth == nil {
+		return none{}, nil
+	}
+
+	switch auth.Type {
+	case types.AuthTypeBasic:
+		return basic{username: auth.Username, password: auth.Password}, nil
+	case types.AuthTypeBearer:
+		return bearer{token: auth.Token}, nil
+	case types.AuthTypeHeaders:
+		return headers(auth.Headers), nil
+	case types.AuthTypeOAuth2ClientCredentials:
+		return &clientCredentials{provider: p, auth: auth, opts: opts}, nil
+	}
+
+	return nil, fmt.Errorf("unknown auth type %q", auth.Type)
+}
+
+// reservedHeaders : set by the delivery itself, custom headers cannot replace them
+var reservedHeaders = []string{"Content-Type", "Content-Encoding", "Content-Length", "Host", "Traceparent", "Tracestate"}
+
+// Validate : checks the fields the auth type needs are there
+func Validate(auth *model.SubscriptionAuth) error {
+	switch auth.Type {
+	case types.AuthTypeBasic:
+		if auth.Username == "" || auth.Password == "" {
+			return errors.New("basic auth needs a username and password")
+		}
+
+	case types.AuthTypeBearer:
+		if auth.Token == "" {
+			return errors.New("bearer auth needs a token")
+		}
+
+	case types.AuthTypeHeaders:
+		if len(auth.Headers) == 0 {
+			return errors.New("headers auth needs at least one header")
+		}
+		for name := range auth.Headers {
+			canonical := textproto.CanonicalMIMEHeaderKey(name)
+			if name == "" || strings.ContainsAny(name, " :\r\n") {
+				return fmt.Errorf("invalid header name %q", name)
+			}
+			if strings.HasPrefix(canonical, "X-Xendit-") {
+				return fmt.Errorf("header %s is reserved", name)
+			}
+			for _, reserved := range reservedHeaders {
+				if canonical == reserved {
+					return fmt.Errorf("header %s is reserved", name)
+				}
+			}
+		}
+
+	case types.AuthTypeOAuth2ClientCredentials:
+		if auth.ClientID == "" || auth.ClientSecret == "" {
+			return errors.New("oauth2 client credentials need a client ID and secret")
+		}
+		if u, err := url.ParseRequestURI(auth.TokenURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			return errors.New("oauth2 client credentials need a token URL")
+		}
+
+	default:
+		return fmt.Errorf("unknown auth type %q", auth.Type)
+	}
+
+	return nil
+}
+
+type none struct{}
+
+func (none) Apply(ctx context.Context, headers map[string]string) error { return nil }
+func (none) Refresh() bool                                              { return false }
+
+type basic struct {
+	username, password string
+}
+
+func (a basic) Apply(ctx context.Context, headers map[string]string) error {
+	headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(a.username+":"+a.password))
+	return nil
+}
+
+func (basic) Refresh() bool { return false }
+
+type bearer struct {
+	token string
+}
+
+func (a bearer) Apply(ctx context.Context, headers map[string]string) error {
+	headers["Authorization"] = "Bearer " + a.token
+	return nil
+}
+
+func (bearer) Refresh() bool { return false }
+
+type headers map[string]string
+
+func (a headers) Apply(ctx context.Context, h map[string]string) error {
+	for name, value := range a {
+		h[name] = value
+	}
+	return nil
+}
+
+func (headers) Refresh() bool { return false }
+
+// clientCredentials : sends the cached token, fetching a new one when it is missing or about to expire
+type clientCredentials struct {
+	provider *Provider
+	auth     *model.SubscriptionAuth
+	opts     httprequest.Options
+}
+
+func (a *clientCredentials) Apply(ctx context.Context, headers map[string]string) error {
+	token, err := a.provider.token(ctx, a.auth, a.opts)
+	if err != nil {
+		return err
+	}
+
+	headers["Authorization"] = "Bearer " + token
+	return nil
+}
+
+// Refresh : the merchant may have revoked the token before it expired
+func (a *clientCredentials) Refresh() bool {
+	a.provider.tokens.forget(tokenKey(a.auth))
+	return true
+}
+
+// token : the fetch outlives a caller giving up on it, the others waiting on it still get the token
+func (p *Provider) token(ctx context.Context, auth *model.SubscriptionAuth, opts httprequest.Options) (string, error) {
+	key := tokenKey(auth)
+	if token, ok := p.tokens.get(key); ok {
+		return token, nil
+	}
+
+	fetched := p.fetches.DoChan(key, func() (interface{}, error) {
+		// A fetch may have finished since the lookup above
+		if token, ok := p.tokens.get(key); ok {
+			return token, nil
+		}
+		return p.fetchToken(context.WithoutCancel(ctx), key, auth, opts)
+	})
+
+	select {
+	case result := <-fetched:
+		if result.Err != nil {
+			return "", result.Err
+		}
+		return result.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// fetchToken : asks the token endpoint and caches its answer
+func (p *Provider) fetchToken(ctx context.Context, key string, auth *model.SubscriptionAuth, opts httprequest.Options) (string, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(auth.Scopes) > 0 {
+		form.Set("scope", strings.Join(auth.Scopes, " "))
+	}
+
+	// Client authentication as recommended by RFC 6749 section 2.3.1
+	credentials := url.QueryEscape(auth.ClientID) + ":" + url.QueryEscape(auth.ClientSecret)
+	headers := map[string]string{
+		"Content-Type":  "application/x-www-form-urlencoded",
+		"Accept":        "application/json",
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)),
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	statusCode, err := p.client.HttpAPI(ctx, opts, http.MethodPost, auth.TokenURL, headers, form.Encode(), &resp)
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch oauth2 token: %w", err)
+	} else if statusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot fetch oauth2 token: token endpoint answered %d", statusCode)
+	} else if resp.AccessToken == "" {
+		return "", errors.New("cannot fetch oauth2 token: no access token in the response")
+	} else if resp.TokenType != "" && !strings.EqualFold(resp.TokenType, "bearer") {
+		return "", fmt.Errorf("cannot fetch oauth2 token: unsupported token type %q", resp.TokenType)
+	}
+
+	p.tokens.put(key, resp.AccessToken, resp.ExpiresIn)
+	return resp.AccessToken, nil
+}
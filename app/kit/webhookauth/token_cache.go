@@ -0,0 +1,73 @@
+package webhookauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"xenotification/app/model"
+)
+
+// expiryMargin : tokens are refreshed this long before they expire, so none expires in flight
+const expiryMargin = 30 * time.Second
+
+type cachedToken struct {
+	accessToken string
+	// expiresAt : zero when the token endpoint gave no lifetime, it is then kept until rejected
+	expiresAt time.Time
+}
+
+// tokenCache : OAuth2 tokens by the credentials they were fetched with
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: make(map[string]cachedToken)}
+}
+
+func (c *tokenCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, ok := c.tokens[key]
+	if !ok {
+		return "", false
+	}
+	if !token.expiresAt.IsZero() && !time.Now().Add(expiryMargin).Before(token.expiresAt) {
+		delete(c.tokens, key)
+		return "", false
+	}
+	return token.accessToken, true
+}
+
+func (c *tokenCache) put(key, accessToken string, expiresIn int64) {
+	token := cachedToken{accessToken: accessToken}
+	if expiresIn > 0 {
+		token.expiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = token
+}
+
+func (c *tokenCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, key)
+}
+
+// tokenKey : changing any of the credentials fetches a new token, the secret is hashed so it is not kept twice
+func tokenKey(auth *model.SubscriptionAuth) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		auth.TokenURL,
+		auth.ClientID,
+		auth.ClientSecret,
+		strings.Join(auth.Scopes, " "),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"xenotification/app/constant"
+	"xenotification/app/env"
+	"xenotification/app/kit/idempotency"
+	"xenotification/app/kit/logger"
+	"xenotification/app/response"
+	"xenotification/app/response/errcode"
+	"xenotification/app/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Idempotency headers
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// Idempotency : replays the first response, byte for byte, to requests retried with the same Idempotency-Key
+// header for the same merchant and mode. Reusing a key with a different body, or with a read token when the first
+// request had none or the other way round, is a conflict. Server errors are not kept so the request can be retried.
+// The response is sealed like the records it holds.
+func (mw *Middleware) Idempotency() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if key == "" {
+				return next(c)
+			} else if len(key) > maxIdempotencyKeyLength {
+				return c.JSON(http.StatusUnprocessableEntity, response.NewException(c, errcode.ValidationError, errors.New("Idempotency-Key is too long")))
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, response.NewException(c, errcode.InvalidRequest, err))
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			// Whether the caller may read secrets is part of the request, the response of one which could is not
+			// replayed to one which cannot
+			hash := sha256.New()
+			hash.Write(body)
+			if env.CanReadSecrets(c.Request().Header.Get(constant.HeaderReadToken)) {
+				hash.Write([]byte(constant.HeaderReadToken))
+			}
+			requestHash := hex.EncodeToString(hash.Sum(nil))
+
+			// Keys are scoped to the endpoint, merchant and mode. A body which does not parse fails the handler's own
+			// validation, and is never replayed to another merchant's request as they do not share a hash.
+			var scope struct {
+				MerchantID string     `json:"merchantId"`
+				Mode       types.Mode `json:"mode"`
+			}
+			json.Unmarshal(body, &scope)
+			if scope.Mode == "" {
+				scope.Mode = types.ModeLive
+			}
+
+			ctx := c.Request().Context()
+			storeKey := strings.Join([]string{c.Request().Method, c.Path(), scope.MerchantID, string(scope.Mode), key}, " ")
+
+			existing, err := mw.idempotency.Begin(ctx, storeKey, requestHash, constant.IdempotencyLease)
+			if err == idempotency.ErrInProgress {
+				return c.JSON(http.StatusConflict, response.NewException(c, errcode.IdempotencyKeyInUse, err))
+			} else if err != nil {
+				return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+			}
+
+			if existing != nil {
+				if existing.RequestHash != requestHash {
+					return c.JSON(http.StatusConflict, response.NewException(c, errcode.IdempotencyKeyReused, errors.New("Idempotency key was already used with a different request")))
+				} else if !existing.Completed() {
+					return c.JSON(http.StatusConflict, response.NewException(c, errcode.IdempotencyKeyInUse, idempotency.ErrInProgress))
+				}
+
+				replayed := existing.Body
+				if existing.Sealed != nil {
+					if replayed, err = mw.cipher.OpenResponse(storeKey, existing.Sealed); err != nil {
+						return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
+					}
+				}
+
+				c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+				return c.Blob(existing.Status, existing.ContentType, replayed)
+			}
+
+			recorder := &bodyRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			err = next(c)
+			c.Response().Writer = recorder.ResponseWriter
+
+			// Detach so a client hanging up does not leave the key claimed
+			ctx = context.WithoutCancel(ctx)
+			log := logger.FromContext(ctx, mw.logger).With(slog.String("idempotency_key", key))
+
+			status := c.Response().Status
+			if err != nil || !c.Response().Committed || status >= http.StatusInternalServerError {
+				if err := mw.idempotency.Release(ctx, storeKey); err != nil {
+					log.Error("failed to release idempotency key", slog.Any("error", err))
+				}
+				return err
+			}
+
+			record := idempotency.Record{
+				RequestHash: requestHash,
+				Status:      status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        recorder.body.Bytes(),
+			}
+			if record.Sealed, err = mw.cipher.SealResponse(storeKey, record.Body); err != nil {
+				log.Error("failed to seal idempotent response", slog.Any("error", err))
+				if err := mw.idempotency.Release(ctx, storeKey); err != nil {
+					log.Error("failed to release idempotency key", slog.Any("error", err))
+				}
+				return nil
+			} else if record.Sealed != nil {
+				record.Body = nil
+			}
+
+			if err := mw.idempotency.Complete(ctx, storeKey, record, env.Config.Idempotency.TTL); err != nil {
+				log.Error("failed to store idempotent response", slog.Any("error", err))
+			}
+
+			return nil
+		}
+	}
+}
+
+// bodyRecorder : keeps a copy of the response body as it is written
+type bodyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write :
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
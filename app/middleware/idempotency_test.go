@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/env"
+	"xenotification/app/kit/encryption"
+	"xenotification/app/kit/idempotency"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testReadToken = "test-read-token"
+
+func TestMain(m *testing.M) {
+	if err := env.LoadWith(map[string]string{
+		"APP_NAME":               "xenotification",
+		"APP_VERSION":            "test",
+		"ENV":                    "test",
+		"SYSTEM_PATH":            "http://localhost",
+		"REDIS_HOST":             "localhost:6379",
+		"REDIS_PASSWORD":         "",
+		"ENCRYPTION_READ_TOKENS": testReadToken,
+	}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestIdempotency(t *testing.T) {
+	mw := &Middleware{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		idempotency: idempotency.NewMemory(),
+	}
+
+	calls := 0
+	status := http.StatusOK
+
+	e := echo.New()
+	e.POST("/v1/notify", func(c echo.Context) error {
+		calls++
+		return c.JSON(status, map[string]interface{}{"calls": calls})
+	}, mw.Idempotency())
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set(HeaderIdempotencyKey, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("key-1", `{"requestId":"1"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	// Retries get the first response back without running the handler again
+	retry := send("key-1", `{"requestId":"1"}`)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, first.Body.Bytes(), retry.Body.Bytes())
+	assert.Equal(t, first.Header().Get(echo.HeaderContentType), retry.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "true", retry.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 1, calls)
+
+	conflict := send("key-1", `{"requestId":"2"}`)
+	assert.Equal(t, http.StatusConflict, conflict.Code)
+	assert.Contains(t, conflict.Body.String(), "IDEMPOTENCY_KEY_REUSED")
+	assert.Equal(t, 1, calls)
+
+	// Server errors are not kept
+	status = http.StatusInternalServerError
+	assert.Equal(t, http.StatusInternalServerError, send("key-2", `{"requestId":"3"}`).Code)
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, send("key-2", `{"requestId":"3"}`).Code)
+	assert.Equal(t, 3, calls)
+
+	// Without a key every request is served
+	send("", `{"requestId":"1"}`)
+	send("", `{"requestId":"1"}`)
+	assert.Equal(t, 5, calls)
+}
+
+// completedStore : keeps the records completed, as the store would hold them
+type completedStore struct {
+	idempotency.Store
+	completed []idempotency.Record
+}
+
+func (s *completedStore) Complete(ctx context.Context, key string, record idempotency.Record, ttl time.Duration) error {
+	s.completed = append(s.completed, record)
+	return s.Store.Complete(ctx, key, record, ttl)
+}
+
+func TestIdempotencyScopeAndSealing(t *testing.T) {
+	key := sha256.Sum256([]byte("test-1"))
+	keyring, err := encryption.NewKeyring("test-1", map[string][]byte{"test-1": key[:]})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	store := &completedStore{Store: idempotency.NewMemory()}
+	mw := &Middleware{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		idempotency: store,
+		cipher:      encryption.New(keyring),
+	}
+
+	calls := 0
+	e := echo.New()
+	e.POST("/v1/notify", func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusOK, map[string]interface{}{"calls": calls, "notificationKey": "secret-key"})
+	}, mw.Idempotency())
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, "key-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Another merchant, or another mode, with the same key is a request of its own
+	first := send(`{"merchantId":"123456","requestId":"1"}`)
+	assert.Equal(t, http.StatusOK, send(`{"merchantId":"654321","requestId":"1"}`).Code)
+	assert.Equal(t, http.StatusOK, send(`{"merchantId":"123456","mode":"TEST","requestId":"1"}`).Code)
+	assert.Equal(t, 3, calls)
+
+	// Live is the default mode
+	retry := send(`{"merchantId":"123456","requestId":"1"}`)
+	assert.Equal(t, "true", retry.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, first.Body.Bytes(), retry.Body.Bytes())
+	assert.Equal(t, http.StatusConflict, send(`{"merchantId":"123456","mode":"LIVE","requestId":"2"}`).Code)
+	assert.Equal(t, 3, calls)
+
+	// The responses are kept sealed
+	if assert.Len(t, store.completed, 3) {
+		for _, record := range store.completed {
+			assert.Empty(t, record.Body)
+			assert.NotNil(t, record.Sealed)
+			assert.NotContains(t, record.Sealed.ResponseBody, "secret-key")
+		}
+	}
+}
+
+func TestIdempotencyReadToken(t *testing.T) {
+	mw := &Middleware{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		idempotency: idempotency.NewMemory(),
+	}
+
+	calls := 0
+	e := echo.New()
+	e.POST("/v1/notify", func(c echo.Context) error {
+		calls++
+		notificationKey := "********"
+		if env.CanReadSecrets(c.Request().Header.Get(constant.HeaderReadToken)) {
+			notificationKey = "secret-key"
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"notificationKey": notificationKey})
+	}, mw.Idempotency())
+
+	send := func(key, readToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(`{"merchantId":"123456","requestId":"1"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, key)
+		if readToken != "" {
+			req.Header.Set(constant.HeaderReadToken, readToken)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("key-1", testReadToken)
+	assert.Contains(t, first.Body.String(), "secret-key")
+
+	// A retry without the read token, or with a wrong one, does not get the secrets back
+	for _, token := range []string{"", "wrong-token"} {
+		retry := send("key-1", token)
+		assert.Equal(t, http.StatusConflict, retry.Code)
+		assert.Contains(t, retry.Body.String(), "IDEMPOTENCY_KEY_REUSED")
+		assert.NotContains(t, retry.Body.String(), "secret-key")
+	}
+	assert.Equal(t, "true", send("key-1", testReadToken).Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 1, calls)
+
+	// Nor does a retry with the token get them from a redacted response
+	assert.NotContains(t, send("key-2", "").Body.String(), "secret-key")
+	assert.Equal(t, http.StatusConflict, send("key-2", testReadToken).Code)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"log/slog"
+
+	"xenotification/app/kit/logger"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// RequestLogger : attaches a logger carrying the request ID to the request context and writes an access log line per request
+func (mw *Middleware) RequestLogger() echo.MiddlewareFunc {
+	accessLog := middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogMethod:    true,
+		LogURI:       true,
+		LogRequestID: true,
+		LogUserAgent: true,
+		LogStatus:    true,
+		LogError:     true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			if v.Status >= 500 || v.Error != nil {
+				level = slog.LevelError
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+				slog.String("user_agent", v.UserAgent),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.Any("error", v.Error))
+			}
+
+			logger.FromContext(c.Request().Context(), mw.logger).LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return accessLog(func(c echo.Context) error {
+			requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+			if requestID == "" {
+				requestID = c.Request().Header.Get(echo.HeaderXRequestID)
+			}
+
+			l := mw.logger
+			if l == nil {
+				l = slog.Default()
+			}
+
+			ctx := logger.NewContext(c.Request().Context(), l.With(slog.String("request_id", requestID)))
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
+		})
+	}
+}
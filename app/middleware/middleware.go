@@ -1,23 +1,36 @@
 package middleware
 
 import (
+	"log/slog"
+
 	"xenotification/app/bootstrap"
+	"xenotification/app/kit/encryption"
+	"xenotification/app/kit/idempotency"
 	"xenotification/app/repository"
 
+	"github.com/ulule/limiter/v3"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Middleware :
 type Middleware struct {
-	mongodb    *mongo.Client
-	repository *repository.Repository
+	mongodb     *mongo.Client
+	repository  repository.Repository
+	logger      *slog.Logger
+	limiter     *limiter.Limiter
+	idempotency idempotency.Store
+	cipher      *encryption.Cipher
 }
 
 // New :
 func New(bs *bootstrap.Bootstrap) *Middleware {
 	h := &Middleware{
-		mongodb:    bs.MongoDB,
-		repository: bs.Repository,
+		mongodb:     bs.MongoDB,
+		repository:  bs.Repository,
+		logger:      bs.Logger,
+		limiter:     newLimiter(bs.RateLimitRedis),
+		idempotency: bs.Idempotency,
+		cipher:      bs.Cipher,
 	}
 
 	return h
@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"time"
 
-	"xenotification/app/env"
 	"xenotification/app/response"
 	"xenotification/app/response/errcode"
 
@@ -35,18 +34,12 @@ func newRate(periodInSecond, limit int64) Rate {
 	}
 }
 
-var instance *limiter.Limiter
-
-func init() {
-	store, err := r.NewStore(redis.NewClient(&redis.Options{
-		Addr:     env.Config.Redis.Host,
-		Password: env.Config.Redis.Password,
-		DB:       1,
-	}))
+func newLimiter(client *redis.Client) *limiter.Limiter {
+	store, err := r.NewStore(client)
 	if err != nil {
 		panic(err)
 	}
-	instance = limiter.New(store, limiter.Rate{})
+	return limiter.New(store, limiter.Rate{})
 }
 
 // APIRateLimit :
@@ -63,7 +56,7 @@ func (mw *Middleware) APIRateLimit(i int64) echo.MiddlewareFunc {
 			realIP := c.RealIP()
 
 			formatter := fmt.Sprintf("%x%x%x", c.Request().URL.Path, c.Request().Method, realIP)
-			context, err := instance.Store.Get(c.Request().Context(), formatter, r.Rate)
+			context, err := mw.limiter.Store.Get(c.Request().Context(), formatter, r.Rate)
 			if err != nil {
 				return c.JSON(http.StatusInternalServerError, response.NewException(c, errcode.SystemError, err))
 			}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"xenotification/app/constant"
+	"xenotification/app/kit/tracing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry : starts a server span for the request, continuing the producer's trace when it sends a traceparent
+func (mw *Middleware) OpenTelemetry(typ string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			r := c.Request()
+
+			operation := "HTTP " + r.Method + " " + r.URL.Path
+
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracing.Start(ctx, operation,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("type", typ),
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.full", r.URL.String()),
+					attribute.String("component", "xenotification"),
+				),
+			)
+			defer span.End()
+
+			c.SetRequest(r.WithContext(ctx))
+
+			requestHeader, err := json.Marshal(maskHeader(c.Request().Header))
+			if err == nil {
+				span.AddEvent("http.request.header", trace.WithAttributes(attribute.String("value", string(requestHeader))))
+			}
+
+			// Bodies carry merchants' payloads and secrets, only their size and digest go on the span
+			isContentTypeJSON := strings.Contains(c.Request().Header.Get("Content-Type"), "application/json") || c.Request().Header.Get("Content-Type") == ""
+			if c.Request().Body != nil && isContentTypeJSON {
+				reqBody := readBody(c)
+				span.SetAttributes(bodyAttributes("http.request.body", reqBody.Bytes())...)
+				c.Request().Body = ioutil.NopCloser(reqBody)
+			}
+
+			// Response
+			resDigest := sha256.New()
+			writer := &bodyDumpResponseWriter{Writer: io.MultiWriter(c.Response().Writer, resDigest), ResponseWriter: c.Response().Writer}
+			c.Response().Writer = writer
+
+			defer func() {
+				responseHeader, err := json.Marshal(maskHeader(c.Response().Header()))
+				if err == nil {
+					span.AddEvent("http.response.header", trace.WithAttributes(attribute.String("value", string(responseHeader))))
+				}
+
+				span.SetAttributes(
+					attribute.Int64("http.response.body.size", c.Response().Size),
+					attribute.String("http.response.body.sha256", hex.EncodeToString(resDigest.Sum(nil))),
+				)
+
+				setAttributes(span, c)
+				statusCode := c.Response().Status
+
+				if statusCode > 399 {
+					span.SetStatus(codes.Error, http.StatusText(statusCode))
+				}
+				span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+func setAttributes(sp trace.Span, c echo.Context) {
+	remoteIP := c.RealIP()
+	userAgent := c.Request().UserAgent()
+
+	requestID := c.Response().Header().Get("X-Request-Id")
+
+	sp.SetAttributes(
+		attribute.String("request_id", requestID),
+		attribute.String("remote_ip", remoteIP),
+		attribute.String("user_agent", userAgent),
+	)
+}
+
+// secretHeaders : headers whose values are credentials, or unlock them, and never go on a span
+var secretHeaders = []string{
+	echo.HeaderAuthorization,
+	"Proxy-Authorization",
+	echo.HeaderCookie,
+	echo.HeaderSetCookie,
+	constant.HeaderReadToken,
+	constant.HeaderWebhookKey,
+	HeaderIdempotencyKey,
+}
+
+// maskHeader : a copy of the header with the secret values masked
+func maskHeader(header http.Header) http.Header {
+	masked := header.Clone()
+	for _, name := range secretHeaders {
+		if values := masked.Values(name); len(values) > 0 {
+			masked[http.CanonicalHeaderKey(name)] = []string{"********"}
+		}
+	}
+	return masked
+}
+
+// bodyAttributes : the size and SHA-256 digest of a body, enough to match it against the producer's or
+// merchant's copy without recording it
+func bodyAttributes(prefix string, body []byte) []attribute.KeyValue {
+	digest := sha256.Sum256(body)
+	return []attribute.KeyValue{
+		attribute.Int(prefix+".size", len(body)),
+		attribute.String(prefix+".sha256", hex.EncodeToString(digest[:])),
+	}
+}
+
+func readBody(c echo.Context) *bytes.Buffer {
+	body := new(bytes.Buffer)
+
+	if c.Request().Body != nil { // Read
+		reqBodyByte, _ := ioutil.ReadAll(c.Request().Body)
+		body.Write(reqBodyByte)
+	}
+
+	return body
+}
+
+type bodyDumpResponseWriter struct {
+	io.Writer
+	http.ResponseWriter
+}
+
+func (w *bodyDumpResponseWriter) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *bodyDumpResponseWriter) Write(b []byte) (int, error) {
+	return w.Writer.Write(b)
+}
+
+func (w *bodyDumpResponseWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *bodyDumpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xenotification/app/constant"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOpenTelemetry(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	requestBody := `{"payload":"secret-payload"}`
+	responseBody := `{"notificationKey":"secret-key"}`
+
+	e := echo.New()
+	e.POST("/v1/notify", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		assert.NoError(t, err)
+		assert.Equal(t, requestBody, string(body))
+		c.Response().Header().Set(echo.HeaderSetCookie, "session=secret-session")
+		return c.String(http.StatusOK, responseBody)
+	}, (&Middleware{}).OpenTelemetry("notify"))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/notify", strings.NewReader(requestBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer secret-token")
+	req.Header.Set(constant.HeaderReadToken, "secret-read-token")
+	req.Header.Set(HeaderIdempotencyKey, "secret-idempotency-key")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, responseBody, rec.Body.String())
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+
+	attributes := map[string]interface{}{}
+	for _, kv := range spans[0].Attributes() {
+		attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	digest := func(body string) string {
+		sum := sha256.Sum256([]byte(body))
+		return hex.EncodeToString(sum[:])
+	}
+	assert.Equal(t, int64(len(requestBody)), attributes["http.request.body.size"])
+	assert.Equal(t, digest(requestBody), attributes["http.request.body.sha256"])
+	assert.Equal(t, int64(len(responseBody)), attributes["http.response.body.size"])
+	assert.Equal(t, digest(responseBody), attributes["http.response.body.sha256"])
+
+	// Neither body nor a secret header is recorded anywhere on the span, the other headers are
+	for _, kv := range spans[0].Attributes() {
+		assert.NotContains(t, kv.Value.Emit(), "secret")
+	}
+	headers := map[string]http.Header{}
+	for _, event := range spans[0].Events() {
+		for _, kv := range event.Attributes {
+			assert.NotContains(t, kv.Value.Emit(), "secret")
+
+			var header http.Header
+			assert.NoError(t, json.Unmarshal([]byte(kv.Value.AsString()), &header))
+			headers[event.Name] = header
+		}
+	}
+	assert.Equal(t, echo.MIMEApplicationJSON, headers["http.request.header"].Get(echo.HeaderContentType))
+	assert.Equal(t, "********", headers["http.request.header"].Get(echo.HeaderAuthorization))
+	assert.Equal(t, "********", headers["http.request.header"].Get(constant.HeaderReadToken))
+	assert.Equal(t, "********", headers["http.response.header"].Get(echo.HeaderSetCookie))
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"xenotification/app/bootstrap"
+	"xenotification/app/env"
+)
+
+// Migrate : applies the pending migrations and exits, for running them ahead of a deploy
+func Migrate() {
+	bs := bootstrap.NewStorage()
+
+	err := bs.Repository.Migrate()
+	if err != nil {
+		bs.Logger.Error("migration failed", slog.String("driver", env.Config.DB.Driver), slog.Any("error", err))
+	} else {
+		bs.Logger.Info("migrations are up to date", slog.String("driver", env.Config.DB.Driver))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if closeErr := bs.Close(ctx); closeErr != nil {
+		bs.Logger.Error("failed to close connections", slog.Any("error", closeErr))
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
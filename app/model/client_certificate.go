@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ClientCertificate : a certificate and key presented to merchant endpoints requiring mutual TLS
+type ClientCertificate struct {
+	ID         primitive.ObjectID `bson:"_id" json:"_id"`
+	MerchantID string             `bson:"merchantId" json:"merchantId"`
+	// Certificate : PEM encoded, the leaf first followed by any intermediates
+	Certificate string `bson:"certificate" json:"certificate"`
+	// PrivateKey : PEM encoded, sealed at rest
+	PrivateKey  string    `bson:"privateKey" json:"privateKey"`
+	Subject     string    `bson:"subject" json:"subject"`
+	Fingerprint string    `bson:"fingerprint" json:"fingerprint"`
+	NotAfter    time.Time `bson:"notAfter" json:"notAfter"`
+	Sealed      *Sealed   `bson:"sealed,omitempty" json:"sealed,omitempty"`
+	Model       `bson:",inline"`
+}
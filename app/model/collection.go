@@ -4,7 +4,12 @@ package model
 type Collection = string
 
 const (
-	CollectionNotificationSubscription Collection = "NotificationSubscription"
-	CollectionNotification             Collection = "Notification"
-	CollectionNotificationAttempt      Collection = "NotificationAttempt"
+	CollectionNotificationSubscription   Collection = "NotificationSubscription"
+	CollectionNotification               Collection = "Notification"
+	CollectionNotificationAttempt        Collection = "NotificationAttempt"
+	CollectionNotificationArchive        Collection = "NotificationArchive"
+	CollectionNotificationAttemptArchive Collection = "NotificationAttemptArchive"
+	CollectionClientCertificate          Collection = "NotificationClientCertificate"
+	CollectionSubscriptionAudit          Collection = "NotificationSubscriptionAudit"
+	CollectionMigration                  Collection = "_migrations"
 )
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// HTTPOptions : a subscription's overrides of the outbound HTTP client, unset fields keep the defaults
+type HTTPOptions struct {
+	Timeout         time.Duration `bson:"timeout,omitempty" json:"timeout,omitempty"`
+	MaxResponseSize int64         `bson:"maxResponseSize,omitempty" json:"maxResponseSize,omitempty"`
+	MaxRedirects    *int          `bson:"maxRedirects,omitempty" json:"maxRedirects,omitempty"`
+	ProxyURL        string        `bson:"proxyUrl,omitempty" json:"proxyUrl,omitempty"`
+	// CABundle : PEM encoded certificates trusted for this subscription's endpoint
+	CABundle string `bson:"caBundle,omitempty" json:"caBundle,omitempty"`
+	// ServerCA : PEM encoded certificates pinned as the only roots trusted for this subscription's endpoint
+	ServerCA string `bson:"serverCa,omitempty" json:"serverCa,omitempty"`
+}
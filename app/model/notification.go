@@ -13,12 +13,17 @@ type Notification struct {
 	MerchantID      string                   `bson:"merchantId" json:"merchantId"`
 	RequestID       string                   `bson:"requestId" json:"requestId"`
 	Type            string                   `bson:"type" json:"type"`
+	Mode            types.Mode               `bson:"mode,omitempty" json:"mode,omitempty"`
 	Payload         interface{}              `bson:"payload" json:"payload"`
 	NotificationURL string                   `bson:"notificationUrl" json:"notificationUrl"`
 	NotificationKey string                   `bson:"notificationKey" json:"notificationKey"`
+	PayloadFormat   types.PayloadFormat      `bson:"payloadFormat,omitempty" json:"payloadFormat,omitempty"`
 	AttemptNo       uint                     `bson:"attemptNo" json:"attemptNo"`
 	AttemptedAt     *time.Time               `bson:"attemptedAt" json:"attempedAt"`
 	Status          types.NotificationStatus `bson:"status" json:"status"`
+	TraceParent     string                   `bson:"traceParent,omitempty" json:"traceParent,omitempty"`
+	ArchivedAt      *time.Time               `bson:"archivedAt,omitempty" json:"archivedAt,omitempty"`
+	Sealed          *Sealed                  `bson:"sealed,omitempty" json:"sealed,omitempty"`
 	IsSimulation    bool                     `bson:"-" json:"-"`
 	Model           `bson:",inline"`
 }
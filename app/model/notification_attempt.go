@@ -17,5 +17,9 @@ type NotificationAttempt struct {
 	StatusCode     int                      `bson:"statusCode" json:"statusCode"`
 	Error          *string                  `bson:"error" json:"error"`
 	SentAt         *time.Time               `bson:"sentAt" json:"sentAt"`
-	Model          `bson:",inline"`
+	TraceParent    string                   `bson:"traceParent,omitempty" json:"traceParent,omitempty"`
+	// RequestBody : the body as sent, before compression, kept when the subscription transforms the payload
+	RequestBody string  `bson:"requestBody,omitempty" json:"requestBody,omitempty"`
+	Sealed      *Sealed `bson:"sealed,omitempty" json:"sealed,omitempty"`
+	Model       `bson:",inline"`
 }
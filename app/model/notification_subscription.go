@@ -1,16 +1,52 @@
 package model
 
+import (
+	"time"
+	"xenotification/app/types"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
 // SubscriptionKey :
 type SubscriptionKey struct {
 	MerchantID string `bson:"merchantId" json:"merchantId"`
 	Type       string `bson:"type" json:"type"`
+	// Mode : live when empty, omitted so live keys match those from before modes
+	Mode types.Mode `bson:"mode,omitempty" json:"mode,omitempty"`
 }
 
 // NotificationSubscription :
 type NotificationSubscription struct {
-	ID                    SubscriptionKey `bson:"_id" json:"_id"`
-	NotificationURL       string          `bson:"notificationUrl" json:"notificationUrl"`
-	NotificationKey       string          `bson:"notificationKey" json:"notificationKey"`
-	AcceptableStatusCodes []int           `bson:"acceptableStatusCodes" json:"acceptableStatusCodes"`
-	Model                 `bson:",inline"`
+	ID                    SubscriptionKey     `bson:"_id" json:"_id"`
+	NotificationURL       string              `bson:"notificationUrl" json:"notificationUrl"`
+	NotificationKey       string              `bson:"notificationKey" json:"notificationKey"`
+	AcceptableStatusCodes []int               `bson:"acceptableStatusCodes" json:"acceptableStatusCodes"`
+	PayloadFormat         types.PayloadFormat `bson:"payloadFormat,omitempty" json:"payloadFormat,omitempty"`
+	HTTPOptions           *HTTPOptions        `bson:"httpOptions,omitempty" json:"httpOptions,omitempty"`
+	// Method : POST when empty
+	Method       string             `bson:"method,omitempty" json:"method,omitempty"`
+	BodyEncoding types.BodyEncoding `bson:"bodyEncoding,omitempty" json:"bodyEncoding,omitempty"`
+	// ContentType : replaces the body encoding's content type
+	ContentType string `bson:"contentType,omitempty" json:"contentType,omitempty"`
+	// Gzip : compresses request bodies with Content-Encoding: gzip
+	Gzip                bool                `bson:"gzip,omitempty" json:"gzip,omitempty"`
+	ClientCertificateID *primitive.ObjectID `bson:"clientCertificateId,omitempty" json:"clientCertificateId,omitempty"`
+	// Auth : not omitted when empty, so an upsert without it clears the stored one
+	Auth      *SubscriptionAuth    `bson:"auth" json:"auth,omitempty"`
+	Transform *PayloadTransform    `bson:"transform" json:"transform,omitempty"`
+	Filters   []SubscriptionFilter `bson:"filters" json:"filters,omitempty"`
+	// Status : active when empty
+	Status types.SubscriptionStatus `bson:"status,omitempty" json:"status,omitempty"`
+	// VerifiedAt : when the endpoint last answered the verification challenge, subscriptions older than the
+	// challenge have none
+	VerifiedAt *time.Time `bson:"verifiedAt,omitempty" json:"verifiedAt,omitempty"`
+	// ConsecutiveFailures : failed deliveries since the last successful one, FailingSince is when the first of them happened
+	ConsecutiveFailures int        `bson:"consecutiveFailures,omitempty" json:"consecutiveFailures,omitempty"`
+	FailingSince        *time.Time `bson:"failingSince,omitempty" json:"failingSince,omitempty"`
+	LastSuccessAt       *time.Time `bson:"lastSuccessAt,omitempty" json:"lastSuccessAt,omitempty"`
+	// DisabledAt : only set when the subscription was disabled automatically, with the reason why
+	DisabledAt     *time.Time `bson:"disabledAt,omitempty" json:"disabledAt,omitempty"`
+	DisabledReason string     `bson:"disabledReason,omitempty" json:"disabledReason,omitempty"`
+	Sealed         *Sealed    `bson:"sealed,omitempty" json:"sealed,omitempty"`
+	Model          `bson:",inline"`
 }
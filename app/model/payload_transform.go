@@ -0,0 +1,11 @@
+package model
+
+import "xenotification/app/types"
+
+// PayloadTransform : reshapes the body before it is encoded, with the Template or the Projection depending on the Type
+type PayloadTransform struct {
+	Type     types.TransformType `bson:"type" json:"type"`
+	Template string              `bson:"template,omitempty" json:"template,omitempty"`
+	// Projection : output field to path, dotted output fields are nested
+	Projection map[string]string `bson:"projection,omitempty" json:"projection,omitempty"`
+}
@@ -0,0 +1,14 @@
+package model
+
+// Sealed : fields encrypted at rest. DataKey is the record's own key wrapped by the key-encryption key KeyID,
+// the other fields are sealed with the data key. Values are base64 encoded.
+type Sealed struct {
+	KeyID           string `bson:"keyId" json:"keyId"`
+	DataKey         string `bson:"dataKey" json:"dataKey"`
+	Payload         string `bson:"payload,omitempty" json:"payload,omitempty"`
+	NotificationKey string `bson:"notificationKey,omitempty" json:"notificationKey,omitempty"`
+	PrivateKey      string `bson:"privateKey,omitempty" json:"privateKey,omitempty"`
+	Auth            string `bson:"auth,omitempty" json:"auth,omitempty"`
+	RequestBody     string `bson:"requestBody,omitempty" json:"requestBody,omitempty"`
+	ResponseBody    string `bson:"responseBody,omitempty" json:"responseBody,omitempty"`
+}
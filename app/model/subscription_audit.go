@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+	"xenotification/app/types"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SubscriptionAudit : an append only record of a change to a subscription
+type SubscriptionAudit struct {
+	ID         primitive.ObjectID `bson:"_id" json:"_id"`
+	MerchantID string             `bson:"merchantId" json:"merchantId"`
+	Type       string             `bson:"type" json:"type"`
+	Mode       types.Mode         `bson:"mode,omitempty" json:"mode,omitempty"`
+	Action     types.AuditAction  `bson:"action" json:"action"`
+	// Actor : who made the change, "system" for the service itself
+	Actor     string               `bson:"actor" json:"actor"`
+	SourceIP  string               `bson:"sourceIp,omitempty" json:"sourceIp,omitempty"`
+	Changes   []SubscriptionChange `bson:"changes" json:"changes"`
+	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
+}
+
+// SubscriptionChange : the values are JSON encoded, empty when the field was not set, with secrets masked
+type SubscriptionChange struct {
+	Field  string `bson:"field" json:"field"`
+	Before string `bson:"before,omitempty" json:"before,omitempty"`
+	After  string `bson:"after,omitempty" json:"after,omitempty"`
+}
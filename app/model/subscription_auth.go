@@ -0,0 +1,18 @@
+package model
+
+import "xenotification/app/types"
+
+// SubscriptionAuth : the credentials webhooks present to the merchant's endpoint, which of the fields
+// apply depends on the Type. It is sealed at rest as a whole.
+type SubscriptionAuth struct {
+	Type     types.AuthType `bson:"type" json:"type"`
+	Username string         `bson:"username,omitempty" json:"username,omitempty"`
+	Password string         `bson:"password,omitempty" json:"password,omitempty"`
+	Token    string         `bson:"token,omitempty" json:"token,omitempty"`
+	// Headers : all values are treated as secrets
+	Headers      map[string]string `bson:"headers,omitempty" json:"headers,omitempty"`
+	TokenURL     string            `bson:"tokenUrl,omitempty" json:"tokenUrl,omitempty"`
+	ClientID     string            `bson:"clientId,omitempty" json:"clientId,omitempty"`
+	ClientSecret string            `bson:"clientSecret,omitempty" json:"clientSecret,omitempty"`
+	Scopes       []string          `bson:"scopes,omitempty" json:"scopes,omitempty"`
+}
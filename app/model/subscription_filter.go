@@ -0,0 +1,13 @@
+package model
+
+import "xenotification/app/types"
+
+// SubscriptionFilter : a condition on a payload field, notifications are only sent when all of a
+// subscription's filters hold
+type SubscriptionFilter struct {
+	// Field : a path into the payload, e.g. $.amount or $.items[0].currency
+	Field    string               `bson:"field" json:"field"`
+	Operator types.FilterOperator `bson:"operator" json:"operator"`
+	// Value : a string, number, boolean or null, a list of those for IN and NOT_IN, unset for EXISTS and NOT_EXISTS
+	Value interface{} `bson:"value,omitempty" json:"value,omitempty"`
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"log/slog"
+	"xenotification/app/model"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindClientCertificates : a merchant only holds a handful of certificates, so they are not paginated
+func (r Mongo) FindClientCertificates(merchantID string) ([]*model.ClientCertificate, error) {
+	certs := make([]*model.ClientCertificate, 0)
+
+	ctx := r.getContext()
+	nextCursor, err := r.db.Collection(model.CollectionClientCertificate).Find(
+		ctx,
+		bson.M{"merchantId": merchantID},
+		options.Find().SetSort(bson.M{"notAfter": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		cert := new(model.ClientCertificate)
+		if err := nextCursor.Decode(cert); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, errors.New("entity decode error")
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nextCursor.Err()
+}
+
+// FindClientCertificate :
+func (r Mongo) FindClientCertificate(id primitive.ObjectID, merchantID string) (*model.ClientCertificate, error) {
+	v := new(model.ClientCertificate)
+	if err := r.db.Collection(model.CollectionClientCertificate).FindOne(
+		r.getContext(),
+		bson.M{"_id": id, "merchantId": merchantID},
+	).Decode(v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// CreateClientCertificate :
+func (r Mongo) CreateClientCertificate(cert *model.ClientCertificate) error {
+	_, err := r.db.Collection(model.CollectionClientCertificate).InsertOne(r.getContext(), cert)
+	return err
+}
+
+// DeleteClientCertificate :
+func (r Mongo) DeleteClientCertificate(id primitive.ObjectID, merchantID string) error {
+	_, err := r.db.Collection(model.CollectionClientCertificate).DeleteOne(
+		r.getContext(),
+		bson.M{"_id": id, "merchantId": merchantID},
+	)
+	return err
+}
+
+// ClientCertificateInUse :
+func (r Mongo) ClientCertificateInUse(id primitive.ObjectID) (bool, error) {
+	count, err := r.db.Collection(model.CollectionNotificationSubscription).CountDocuments(
+		r.getContext(),
+		bson.M{"clientCertificateId": id},
+		options.Count().SetLimit(1),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,84 @@
+package encrypted
+
+import (
+	"context"
+
+	"xenotification/app/kit/encryption"
+	"xenotification/app/model"
+	"xenotification/app/repository"
+)
+
+// Repository : seals the payloads, request bodies, credentials and client certificate private keys before they reach the wrapped repository.
+// Reads are passed through untouched, callers open the records with the cipher when they need the plaintext.
+type Repository struct {
+	repository.Repository
+	cipher *encryption.Cipher
+}
+
+// New :
+func New(repo repository.Repository, cipher *encryption.Cipher) repository.Repository {
+	return &Repository{Repository: repo, cipher: cipher}
+}
+
+// WithContext :
+func (r *Repository) WithContext(ctx context.Context) repository.Repository {
+	return &Repository{Repository: r.Repository.WithContext(ctx), cipher: r.cipher}
+}
+
+// UpsertNotification :
+func (r *Repository) UpsertNotification(notification *model.Notification) error {
+	sealed, err := r.cipher.SealNotification(notification)
+	if err != nil {
+		return err
+	}
+	return r.Repository.UpsertNotification(sealed)
+}
+
+// CreateNotification :
+func (r *Repository) CreateNotification(notification *model.Notification) error {
+	sealed, err := r.cipher.SealNotification(notification)
+	if err != nil {
+		return err
+	}
+	return r.Repository.CreateNotification(sealed)
+}
+
+// SaveNotificationAttemptResult :
+func (r *Repository) SaveNotificationAttemptResult(notification *model.Notification, attempt *model.NotificationAttempt) error {
+	sealed, err := r.cipher.SealNotification(notification)
+	if err != nil {
+		return err
+	}
+	sealedAttempt, err := r.cipher.SealNotificationAttempt(attempt)
+	if err != nil {
+		return err
+	}
+	return r.Repository.SaveNotificationAttemptResult(sealed, sealedAttempt)
+}
+
+// UpsertNotificationAttempt :
+func (r *Repository) UpsertNotificationAttempt(att *model.NotificationAttempt) error {
+	sealed, err := r.cipher.SealNotificationAttempt(att)
+	if err != nil {
+		return err
+	}
+	return r.Repository.UpsertNotificationAttempt(sealed)
+}
+
+// UpsertNotificationSubscription :
+func (r *Repository) UpsertNotificationSubscription(sub *model.NotificationSubscription) error {
+	sealed, err := r.cipher.SealNotificationSubscription(sub)
+	if err != nil {
+		return err
+	}
+	return r.Repository.UpsertNotificationSubscription(sealed)
+}
+
+// CreateClientCertificate :
+func (r *Repository) CreateClientCertificate(cert *model.ClientCertificate) error {
+	sealed, err := r.cipher.SealClientCertificate(cert)
+	if err != nil {
+		return err
+	}
+	return r.Repository.CreateClientCertificate(sealed)
+}
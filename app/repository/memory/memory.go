@@ -0,0 +1,827 @@
+package memory
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/types"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const defaultLimit = 50
+
+// Repository : an in-memory repository for tests and local development.
+// It is safe for concurrent use, every write is atomic like its MongoDB counterpart.
+type Repository struct {
+	mu            *sync.RWMutex
+	notifications map[primitive.ObjectID]model.Notification
+	attempts      map[primitive.ObjectID]model.NotificationAttempt
+	subscriptions map[model.SubscriptionKey]model.NotificationSubscription
+	certificates  map[primitive.ObjectID]model.ClientCertificate
+	audits        []model.SubscriptionAudit
+
+	archivedNotifications map[primitive.ObjectID]model.Notification
+	archivedAttempts      map[primitive.ObjectID]model.NotificationAttempt
+}
+
+var _ repository.Repository = (*Repository)(nil)
+
+// New :
+func New() *Repository {
+	return &Repository{
+		mu:            new(sync.RWMutex),
+		notifications: make(map[primitive.ObjectID]model.Notification),
+		attempts:      make(map[primitive.ObjectID]model.NotificationAttempt),
+		subscriptions: make(map[model.SubscriptionKey]model.NotificationSubscription),
+		certificates:  make(map[primitive.ObjectID]model.ClientCertificate),
+
+		archivedNotifications: make(map[primitive.ObjectID]model.Notification),
+		archivedAttempts:      make(map[primitive.ObjectID]model.NotificationAttempt),
+	}
+}
+
+// WithContext : there is nothing to cancel, the same repository is returned
+func (r *Repository) WithContext(ctx context.Context) repository.Repository {
+	return r
+}
+
+// Migrate : there is no schema to maintain
+func (r *Repository) Migrate() error {
+	return nil
+}
+
+// FindNotifications :
+func (r *Repository) FindNotifications(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error) {
+	notifications := r.filterNotifications(func(n *model.Notification) bool {
+		return n.MerchantID == merchantID && n.Mode == mode
+	})
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].UpdatedAt.After(notifications[j].UpdatedAt)
+	})
+
+	return paginate(notifications, cursor, limit)
+}
+
+// FindNotificationByID :
+func (r *Repository) FindNotificationByID(id string, merchantID string) (*model.Notification, error) {
+	dataID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.notifications[dataID]
+	if !ok || v.MerchantID != merchantID {
+		return nil, repository.ErrNotFound
+	}
+
+	return &v, nil
+}
+
+// FindNotification :
+func (r *Repository) FindNotification(typ string, requestID string, mode types.Mode) (*model.Notification, error) {
+	notifications := r.filterNotifications(func(n *model.Notification) bool {
+		return n.Type == typ && n.RequestID == requestID && n.Mode == mode
+	})
+	if len(notifications) == 0 {
+		return nil, repository.ErrNotFound
+	}
+
+	return notifications[0], nil
+}
+
+// UpsertNotification :
+func (r *Repository) UpsertNotification(notification *model.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isDuplicate(notification) {
+		return repository.ErrDuplicate
+	}
+
+	r.notifications[notification.ID] = *notification
+	return nil
+}
+
+// CreateNotification : creates the notification together with its first attempt, pending or held
+func (r *Repository) CreateNotification(notification *model.Notification) error {
+	notificationAttempt := new(model.NotificationAttempt)
+	notificationAttempt.ID = primitive.NewObjectID()
+	notificationAttempt.NotificationID = notification.ID
+	notificationAttempt.MerchantID = notification.MerchantID
+	notificationAttempt.AttemptNo = 1
+	notificationAttempt.Status = repository.FirstAttemptStatus(notification)
+	notificationAttempt.TraceParent = notification.TraceParent
+	notificationAttempt.CreatedAt = time.Now().UTC()
+	notificationAttempt.UpdatedAt = time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isDuplicate(notification) {
+		return repository.ErrDuplicate
+	}
+
+	r.notifications[notification.ID] = *notification
+	r.attempts[notificationAttempt.ID] = *notificationAttempt
+	return nil
+}
+
+// SaveNotificationAttemptResult :
+func (r *Repository) SaveNotificationAttemptResult(notification *model.Notification, attempt *model.NotificationAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isDuplicate(notification) {
+		return repository.ErrDuplicate
+	}
+
+	r.attempts[attempt.ID] = *attempt
+	r.notifications[notification.ID] = *notification
+	return nil
+}
+
+// FindRetryNotifications :
+func (r *Repository) FindRetryNotifications(policy repository.RetryPolicy, cursor string) ([]*model.Notification, string, error) {
+	due := time.Now().Add(-1 * policy.Interval)
+	notifications := r.filterNotifications(func(n *model.Notification) bool {
+		return n.Status == types.NotificationStatusFailed &&
+			n.Mode == policy.Mode &&
+			n.AttemptNo < policy.Attempts &&
+			(n.AttemptedAt == nil || !n.AttemptedAt.After(due))
+	})
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].ID.Hex() < notifications[j].ID.Hex()
+	})
+
+	return paginate(notifications, cursor, defaultLimit)
+}
+
+// FindStuckNotifications :
+func (r *Repository) FindStuckNotifications(cutoff time.Time, cursor string) ([]*model.Notification, string, error) {
+	notifications := r.filterNotifications(func(n *model.Notification) bool {
+		return n.Status == types.NotificationStatusPending && !n.UpdatedAt.After(cutoff)
+	})
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].UpdatedAt.Before(notifications[j].UpdatedAt)
+	})
+
+	return paginate(notifications, cursor, defaultLimit)
+}
+
+// FindHeldSubscriptionKeys :
+func (r *Repository) FindHeldSubscriptionKeys() ([]model.SubscriptionKey, error) {
+	seen := make(map[model.SubscriptionKey]bool)
+	keys := make([]model.SubscriptionKey, 0)
+	for _, n := range r.filterNotifications(func(n *model.Notification) bool { return n.Status == types.NotificationStatusHeld }) {
+		key := model.SubscriptionKey{MerchantID: n.MerchantID, Type: n.Type, Mode: n.Mode}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// FindHeldNotifications :
+func (r *Repository) FindHeldNotifications(id model.SubscriptionKey, limit int64) ([]*model.Notification, error) {
+	notifications := r.filterNotifications(func(n *model.Notification) bool {
+		return n.MerchantID == id.MerchantID && n.Type == id.Type && n.Mode == id.Mode && n.Status == types.NotificationStatusHeld
+	})
+	sort.SliceStable(notifications, func(i, j int) bool {
+		if !notifications[i].CreatedAt.Equal(notifications[j].CreatedAt) {
+			return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+		}
+		return notifications[i].ID.Hex() < notifications[j].ID.Hex()
+	})
+
+	if int64(len(notifications)) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+// FindLastNotificationAttempt :
+func (r *Repository) FindLastNotificationAttempt(notificationID primitive.ObjectID) (*model.NotificationAttempt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var last *model.NotificationAttempt
+	for _, each := range r.attempts {
+		if each.NotificationID != notificationID || (last != nil && last.AttemptNo >= each.AttemptNo) {
+			continue
+		}
+		v := each
+		last = &v
+	}
+	if last == nil {
+		return nil, repository.ErrNotFound
+	}
+
+	return last, nil
+}
+
+// UpsertNotificationAttempt :
+func (r *Repository) UpsertNotificationAttempt(att *model.NotificationAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts[att.ID] = *att
+	return nil
+}
+
+// FindStuckNotificationAttempts :
+func (r *Repository) FindStuckNotificationAttempts(cutoff time.Time, cursor string) ([]*model.NotificationAttempt, string, error) {
+	r.mu.RLock()
+	attempts := make([]*model.NotificationAttempt, 0)
+	for _, each := range r.attempts {
+		if each.Status == types.NotificationStatusPending && !each.UpdatedAt.After(cutoff) {
+			v := each
+			attempts = append(attempts, &v)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(attempts, func(i, j int) bool {
+		return attempts[i].UpdatedAt.Before(attempts[j].UpdatedAt)
+	})
+
+	return paginate(attempts, cursor, defaultLimit)
+}
+
+// ArchiveNotifications :
+func (r *Repository) ArchiveNotifications(scope repository.MerchantScope, before time.Time, retryAttempts uint, limit int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := oldestFirst(r.notifications, func(n model.Notification) bool {
+		exhausted := n.Status == types.NotificationStatusFailed && n.AttemptNo >= retryAttempts
+		return scope.Includes(n.MerchantID) && n.Mode == scope.Mode && (isArchivable(n.Status) || exhausted) && !n.UpdatedAt.After(before)
+	}, limit)
+
+	now := time.Now().UTC()
+	for _, id := range due {
+		for attemptID, attempt := range r.attempts {
+			if attempt.NotificationID == id {
+				r.archivedAttempts[attemptID] = attempt
+				delete(r.attempts, attemptID)
+			}
+		}
+
+		notification := r.notifications[id]
+		notification.ArchivedAt = &now
+		r.archivedNotifications[id] = notification
+		delete(r.notifications, id)
+	}
+
+	return int64(len(due)), nil
+}
+
+// PurgeArchivedNotifications :
+func (r *Repository) PurgeArchivedNotifications(scope repository.MerchantScope, before time.Time, limit int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := oldestFirst(r.archivedNotifications, func(n model.Notification) bool {
+		return scope.Includes(n.MerchantID) && n.Mode == scope.Mode && !n.UpdatedAt.After(before)
+	}, limit)
+
+	for _, id := range due {
+		for attemptID, attempt := range r.archivedAttempts {
+			if attempt.NotificationID == id {
+				delete(r.archivedAttempts, attemptID)
+			}
+		}
+		delete(r.archivedNotifications, id)
+	}
+
+	return int64(len(due)), nil
+}
+
+// FindArchivedNotifications :
+func (r *Repository) FindArchivedNotifications(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error) {
+	r.mu.RLock()
+	notifications := make([]*model.Notification, 0)
+	for _, each := range r.archivedNotifications {
+		if each.MerchantID == merchantID && each.Mode == mode {
+			v := each
+			notifications = append(notifications, &v)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].UpdatedAt.After(notifications[j].UpdatedAt)
+	})
+
+	return paginate(notifications, cursor, limit)
+}
+
+// FindArchivedNotification :
+func (r *Repository) FindArchivedNotification(typ string, requestID string, mode types.Mode) (*model.Notification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, each := range r.archivedNotifications {
+		if each.Type == typ && each.RequestID == requestID && each.Mode == mode {
+			v := each
+			return &v, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+// FindNotificationSubscriptions :
+func (r *Repository) FindNotificationSubscriptions(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.NotificationSubscription, string, error) {
+	r.mu.RLock()
+	subscriptions := make([]*model.NotificationSubscription, 0)
+	for _, each := range r.subscriptions {
+		if each.ID.MerchantID == merchantID && each.ID.Mode == mode {
+			v := each
+			subscriptions = append(subscriptions, &v)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].ID.Type < subscriptions[j].ID.Type
+	})
+
+	return paginate(subscriptions, cursor, limit)
+}
+
+// FindNotificationSubscription :
+func (r *Repository) FindNotificationSubscription(id model.SubscriptionKey) (*model.NotificationSubscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.subscriptions[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+
+	return &v, nil
+}
+
+// UpsertNotificationSubscription :
+func (r *Repository) UpsertNotificationSubscription(sub *model.NotificationSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v := *sub
+	v.AcceptableStatusCodes = append([]int(nil), sub.AcceptableStatusCodes...)
+	r.subscriptions[sub.ID] = v
+	return nil
+}
+
+// DeleteNotificationSubscription :
+func (r *Repository) DeleteNotificationSubscription(id model.SubscriptionKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subscriptions, id)
+	return nil
+}
+
+// UpdateNotificationSubscriptionStatus :
+func (r *Repository) UpdateNotificationSubscriptionStatus(id model.SubscriptionKey, status types.SubscriptionStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.subscriptions[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	v.Status = status
+	v.UpdatedAt = time.Now().UTC()
+	if status == types.SubscriptionStatusActive {
+		v.ConsecutiveFailures = 0
+		v.FailingSince = nil
+		v.DisabledAt = nil
+		v.DisabledReason = ""
+	}
+	r.subscriptions[id] = v
+	return nil
+}
+
+// RecordNotificationSubscriptionDelivery :
+func (r *Repository) RecordNotificationSubscriptionDelivery(id model.SubscriptionKey, succeeded bool, at time.Time) (*model.NotificationSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.subscriptions[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if succeeded {
+		v.ConsecutiveFailures = 0
+		v.FailingSince = nil
+		v.LastSuccessAt = &at
+	} else {
+		v.ConsecutiveFailures++
+		if v.FailingSince == nil || at.Before(*v.FailingSince) {
+			v.FailingSince = &at
+		}
+	}
+	r.subscriptions[id] = v
+	return &v, nil
+}
+
+// VerifyNotificationSubscription :
+func (r *Repository) VerifyNotificationSubscription(id model.SubscriptionKey, url string, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.subscriptions[id]
+	if !ok || v.NotificationURL != url || v.Status != types.SubscriptionStatusPendingVerification {
+		return false, nil
+	}
+	v.Status = types.SubscriptionStatusActive
+	v.VerifiedAt = &at
+	v.UpdatedAt = at
+	r.subscriptions[id] = v
+	return true, nil
+}
+
+// AutoDisableNotificationSubscription :
+func (r *Repository) AutoDisableNotificationSubscription(id model.SubscriptionKey, reason string, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.subscriptions[id]
+	if !ok || (v.Status != "" && v.Status != types.SubscriptionStatusActive) {
+		return false, nil
+	}
+	v.Status = types.SubscriptionStatusDisabled
+	v.DisabledAt = &at
+	v.DisabledReason = reason
+	v.UpdatedAt = at
+	r.subscriptions[id] = v
+	return true, nil
+}
+
+// CreateSubscriptionAudit :
+func (r *Repository) CreateSubscriptionAudit(audit *model.SubscriptionAudit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v := *audit
+	v.Changes = append([]model.SubscriptionChange(nil), audit.Changes...)
+	r.audits = append(r.audits, v)
+	return nil
+}
+
+// FindSubscriptionAudits :
+func (r *Repository) FindSubscriptionAudits(merchantID string, mode types.Mode, typ string, cursor string, limit int64) ([]*model.SubscriptionAudit, string, error) {
+	r.mu.RLock()
+	audits := make([]*model.SubscriptionAudit, 0)
+	for i := len(r.audits) - 1; i >= 0; i-- {
+		if each := r.audits[i]; each.MerchantID == merchantID && each.Mode == mode && (typ == "" || each.Type == typ) {
+			audits = append(audits, &each)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(audits, func(i, j int) bool {
+		return audits[i].CreatedAt.After(audits[j].CreatedAt)
+	})
+
+	return paginate(audits, cursor, limit)
+}
+
+// FindClientCertificates :
+func (r *Repository) FindClientCertificates(merchantID string) ([]*model.ClientCertificate, error) {
+	r.mu.RLock()
+	certs := make([]*model.ClientCertificate, 0)
+	for _, each := range r.certificates {
+		if each.MerchantID == merchantID {
+			v := each
+			certs = append(certs, &v)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(certs, func(i, j int) bool {
+		return certs[i].NotAfter.Before(certs[j].NotAfter)
+	})
+
+	return certs, nil
+}
+
+// FindClientCertificate :
+func (r *Repository) FindClientCertificate(id primitive.ObjectID, merchantID string) (*model.ClientCertificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.certificates[id]
+	if !ok || v.MerchantID != merchantID {
+		return nil, repository.ErrNotFound
+	}
+
+	return &v, nil
+}
+
+// CreateClientCertificate :
+func (r *Repository) CreateClientCertificate(cert *model.ClientCertificate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.certificates[cert.ID]; ok {
+		return repository.ErrDuplicate
+	}
+
+	r.certificates[cert.ID] = *cert
+	return nil
+}
+
+// DeleteClientCertificate :
+func (r *Repository) DeleteClientCertificate(id primitive.ObjectID, merchantID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.certificates[id]; ok && v.MerchantID == merchantID {
+		delete(r.certificates, id)
+	}
+	return nil
+}
+
+// ClientCertificateInUse :
+func (r *Repository) ClientCertificateInUse(id primitive.ObjectID) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, each := range r.subscriptions {
+		if each.ClientCertificateID != nil && *each.ClientCertificateID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isDuplicate : mirrors the unique index on type, request ID and mode, the caller must hold the lock
+func (r *Repository) isDuplicate(notification *model.Notification) bool {
+	for id, each := range r.notifications {
+		if id != notification.ID && each.Type == notification.Type && each.RequestID == notification.RequestID && each.Mode == notification.Mode {
+			return true
+		}
+	}
+	return false
+}
+
+// filterNotifications : returns copies of the notifications matching fn
+func (r *Repository) filterNotifications(fn func(n *model.Notification) bool) []*model.Notification {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	notifications := make([]*model.Notification, 0)
+	for _, each := range r.notifications {
+		v := each
+		if fn(&v) {
+			notifications = append(notifications, &v)
+		}
+	}
+
+	return notifications
+}
+
+// oldestFirst : IDs of up to limit notifications matching fn, least recently updated first
+func isArchivable(status types.NotificationStatus) bool {
+	for _, each := range types.ArchivableNotificationStatuses {
+		if each == status {
+			return true
+		}
+	}
+	return false
+}
+
+func oldestFirst(notifications map[primitive.ObjectID]model.Notification, fn func(n model.Notification) bool, limit int64) []primitive.ObjectID {
+	matched := make([]model.Notification, 0)
+	for _, each := range notifications {
+		if fn(each) {
+			matched = append(matched, each)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].UpdatedAt.Before(matched[j].UpdatedAt)
+	})
+	if int64(len(matched)) > limit {
+		matched = matched[:limit]
+	}
+
+	ids := make([]primitive.ObjectID, len(matched))
+	for i, each := range matched {
+		ids[i] = each.ID
+	}
+	return ids
+}
+
+// paginate : applies the same hex encoded skip cursor as the MongoDB repository
+func paginate[T any](items []T, cursor string, limit int64) ([]T, string, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	currentSkip := int64(0)
+
+	if cursor != "" {
+		data, err := hex.DecodeString(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		currentSkip, err = strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if currentSkip >= int64(len(items)) {
+		return items[:0], "", nil
+	}
+	items = items[currentSkip:]
+
+	if int64(len(items)) > limit {
+		return items[:limit], hex.EncodeToString([]byte(fmt.Sprintf("%d", currentSkip+limit))), nil
+	}
+
+	return items, "", nil
+}
+
+// FindNotificationsToReseal :
+func (r *Repository) FindNotificationsToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.Notification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	notifications := make([]*model.Notification, 0)
+	for _, source := range []map[primitive.ObjectID]model.Notification{r.notifications, r.archivedNotifications} {
+		for _, each := range source {
+			if each.ID.Hex() > after.Hex() && (each.Sealed == nil || each.Sealed.KeyID != keyID) {
+				v := each
+				notifications = append(notifications, &v)
+			}
+		}
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].ID.Hex() < notifications[j].ID.Hex()
+	})
+	if int64(len(notifications)) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+// ResealNotification :
+func (r *Repository) ResealNotification(notification *model.Notification, sealed *model.Sealed) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	source := r.notifications
+	if notification.ArchivedAt != nil {
+		source = r.archivedNotifications
+	}
+
+	v, ok := source[notification.ID]
+	if !ok {
+		return nil
+	}
+	v.Payload = nil
+	v.NotificationKey = ""
+	v.Sealed = sealed
+	source[notification.ID] = v
+	return nil
+}
+
+// FindNotificationSubscriptionsToReseal :
+func (r *Repository) FindNotificationSubscriptionsToReseal(keyID string, after model.SubscriptionKey, limit int64) ([]*model.NotificationSubscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subscriptions := make([]*model.NotificationSubscription, 0)
+	for _, each := range r.subscriptions {
+		if subscriptionKeyLess(after, each.ID) && (each.Sealed == nil || each.Sealed.KeyID != keyID) {
+			v := each
+			subscriptions = append(subscriptions, &v)
+		}
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptionKeyLess(subscriptions[i].ID, subscriptions[j].ID)
+	})
+	if int64(len(subscriptions)) > limit {
+		subscriptions = subscriptions[:limit]
+	}
+	return subscriptions, nil
+}
+
+// subscriptionKeyLess : ordered by merchant ID, type and mode
+func subscriptionKeyLess(a, b model.SubscriptionKey) bool {
+	if a.MerchantID != b.MerchantID {
+		return a.MerchantID < b.MerchantID
+	} else if a.Type != b.Type {
+		return a.Type < b.Type
+	}
+	return a.Mode < b.Mode
+}
+
+// ResealNotificationSubscription :
+func (r *Repository) ResealNotificationSubscription(id model.SubscriptionKey, sealed *model.Sealed) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.subscriptions[id]
+	if !ok {
+		return nil
+	}
+	v.NotificationKey = ""
+	v.Auth = nil
+	v.Sealed = sealed
+	r.subscriptions[id] = v
+	return nil
+}
+
+// FindNotificationAttemptsToReseal :
+func (r *Repository) FindNotificationAttemptsToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.NotificationAttempt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attempts := make([]*model.NotificationAttempt, 0)
+	for _, source := range []map[primitive.ObjectID]model.NotificationAttempt{r.attempts, r.archivedAttempts} {
+		for _, each := range source {
+			if each.ID.Hex() > after.Hex() && (each.RequestBody != "" || (each.Sealed != nil && each.Sealed.KeyID != keyID)) {
+				v := each
+				attempts = append(attempts, &v)
+			}
+		}
+	}
+
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].ID.Hex() < attempts[j].ID.Hex()
+	})
+	if int64(len(attempts)) > limit {
+		attempts = attempts[:limit]
+	}
+	return attempts, nil
+}
+
+// ResealNotificationAttempt :
+func (r *Repository) ResealNotificationAttempt(id primitive.ObjectID, sealed *model.Sealed) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, source := range []map[primitive.ObjectID]model.NotificationAttempt{r.attempts, r.archivedAttempts} {
+		if v, ok := source[id]; ok {
+			v.RequestBody = ""
+			v.Sealed = sealed
+			source[id] = v
+		}
+	}
+	return nil
+}
+
+// FindClientCertificatesToReseal :
+func (r *Repository) FindClientCertificatesToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.ClientCertificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	certs := make([]*model.ClientCertificate, 0)
+	for _, each := range r.certificates {
+		if each.ID.Hex() > after.Hex() && (each.Sealed == nil || each.Sealed.KeyID != keyID) {
+			v := each
+			certs = append(certs, &v)
+		}
+	}
+
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].ID.Hex() < certs[j].ID.Hex()
+	})
+	if int64(len(certs)) > limit {
+		certs = certs[:limit]
+	}
+	return certs, nil
+}
+
+// ResealClientCertificate :
+func (r *Repository) ResealClientCertificate(id primitive.ObjectID, sealed *model.Sealed) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.certificates[id]
+	if !ok {
+		return nil
+	}
+	v.PrivateKey = ""
+	v.Sealed = sealed
+	r.certificates[id] = v
+	return nil
+}
@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration : a schema change, versions are applied in ascending order and never reused
+type migration struct {
+	Version int
+	Name    string
+	Up      func(r Mongo) error
+}
+
+// Server error codes dropIndex tolerates
+const (
+	errCodeNamespaceNotFound = 26
+	errCodeIndexNotFound     = 27
+)
+
+type migrationRecord struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create_notification_indexes",
+		Up: func(r Mongo) error {
+			return r.createIndexes(model.CollectionNotification, []mongo.IndexModel{
+				{
+					// Only one notification per type and request ID
+					Keys:    bson.D{{Key: "type", Value: 1}, {Key: "requestId", Value: 1}},
+					Options: options.Index().SetName("type_requestId").SetUnique(true),
+				},
+				{
+					Keys:    bson.D{{Key: "merchantId", Value: 1}, {Key: "updatedAt", Value: -1}},
+					Options: options.Index().SetName("merchantId_updatedAt"),
+				},
+				{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "attemptNo", Value: 1}, {Key: "attemptedAt", Value: 1}},
+					Options: options.Index().SetName("status_attemptNo_attemptedAt"),
+				},
+				{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "updatedAt", Value: 1}},
+					Options: options.Index().SetName("status_updatedAt"),
+				},
+			})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_notification_attempt_indexes",
+		Up: func(r Mongo) error {
+			return r.createIndexes(model.CollectionNotificationAttempt, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "notificationId", Value: 1}, {Key: "attemptNo", Value: -1}},
+					Options: options.Index().SetName("notificationId_attemptNo"),
+				},
+				{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "updatedAt", Value: 1}},
+					Options: options.Index().SetName("status_updatedAt"),
+				},
+			})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_notification_subscription_indexes",
+		Up: func(r Mongo) error {
+			return r.createIndexes(model.CollectionNotificationSubscription, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "_id.merchantId", Value: 1}, {Key: "_id.type", Value: 1}},
+					Options: options.Index().SetName("merchantId_type"),
+				},
+			})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_notification_archive_indexes",
+		Up: func(r Mongo) error {
+			if err := r.createIndexes(model.CollectionNotificationArchive, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "merchantId", Value: 1}, {Key: "updatedAt", Value: -1}},
+					Options: options.Index().SetName("merchantId_updatedAt"),
+				},
+				{
+					Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+					Options: options.Index().SetName("updatedAt"),
+				},
+			}); err != nil {
+				return err
+			}
+
+			return r.createIndexes(model.CollectionNotificationAttemptArchive, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "notificationId", Value: 1}},
+					Options: options.Index().SetName("notificationId"),
+				},
+			})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_client_certificate_indexes",
+		Up: func(r Mongo) error {
+			if err := r.createIndexes(model.CollectionClientCertificate, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "merchantId", Value: 1}},
+					Options: options.Index().SetName("merchantId"),
+				},
+			}); err != nil {
+				return err
+			}
+
+			return r.createIndexes(model.CollectionNotificationSubscription, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "clientCertificateId", Value: 1}},
+					Options: options.Index().SetName("clientCertificateId").SetSparse(true),
+				},
+			})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_held_notification_index",
+		Up: func(r Mongo) error {
+			return r.createIndexes(model.CollectionNotification, []mongo.IndexModel{
+				{
+					Keys: bson.D{{Key: "merchantId", Value: 1}, {Key: "type", Value: 1}, {Key: "createdAt", Value: 1}},
+					Options: options.Index().SetName("held").
+						SetPartialFilterExpression(bson.M{"status": types.NotificationStatusHeld}),
+				},
+			})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_subscription_audit_indexes",
+		Up: func(r Mongo) error {
+			return r.createIndexes(model.CollectionSubscriptionAudit, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "merchantId", Value: 1}, {Key: "createdAt", Value: -1}},
+					Options: options.Index().SetName("merchantId_createdAt"),
+				},
+				{
+					Keys:    bson.D{{Key: "merchantId", Value: 1}, {Key: "type", Value: 1}, {Key: "createdAt", Value: -1}},
+					Options: options.Index().SetName("merchantId_type_createdAt"),
+				},
+			})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "scope_request_id_to_mode",
+		Up: func(r Mongo) error {
+			// The new index is in place before the old one goes, so duplicates are never let through
+			if err := r.createIndexes(model.CollectionNotification, []mongo.IndexModel{
+				{
+					// Only one notification per type and request ID in each mode
+					Keys:    bson.D{{Key: "type", Value: 1}, {Key: "requestId", Value: 1}, {Key: "mode", Value: 1}},
+					Options: options.Index().SetName("type_requestId_mode").SetUnique(true),
+				},
+			}); err != nil {
+				return err
+			}
+
+			return r.dropIndex(model.CollectionNotification, "type_requestId")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create_notification_archive_request_id_index",
+		Up: func(r Mongo) error {
+			// Sending a notification looks for the request ID in the archive too
+			return r.createIndexes(model.CollectionNotificationArchive, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "type", Value: 1}, {Key: "requestId", Value: 1}, {Key: "mode", Value: 1}},
+					Options: options.Index().SetName("type_requestId_mode"),
+				},
+			})
+		},
+	},
+}
+
+// Migrate : applies the migrations which have not run yet and records them in the _migrations collection.
+// Creating an index which already exists is a no-op, so instances migrating at the same time do not conflict.
+func (r Mongo) Migrate() error {
+	ctx := r.getContext()
+	collection := r.db.Collection(model.CollectionMigration)
+
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+
+	var records []migrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, record := range records {
+		applied[record.Version] = true
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		if err := m.Up(r); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		if _, err := collection.UpdateOne(
+			ctx,
+			bson.M{"_id": m.Version},
+			bson.M{"$set": migrationRecord{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		r.getLogger().Info("applied migration", slog.Int("version", m.Version), slog.String("name", m.Name))
+	}
+
+	return nil
+}
+
+func (r Mongo) createIndexes(entityName model.Collection, indexes []mongo.IndexModel) error {
+	_, err := r.db.Collection(entityName).Indexes().CreateMany(r.getContext(), indexes)
+	return err
+}
+
+// dropIndex : an index which is already gone is not an error, another instance may have dropped it
+func (r Mongo) dropIndex(entityName model.Collection, name string) error {
+	_, err := r.db.Collection(entityName).Indexes().DropOne(r.getContext(), name)
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && (commandErr.Code == errCodeIndexNotFound || commandErr.Code == errCodeNamespaceNotFound) {
+		return nil
+	}
+	return err
+}
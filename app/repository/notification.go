@@ -1,13 +1,12 @@
 package repository
 
 import (
-	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"time"
-	"xenotification/app/constant"
 	"xenotification/app/model"
 	"xenotification/app/types"
 
@@ -16,17 +15,25 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readconcern"
-	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 // FindNotifications :
-func (r Repository) FindNotifications(merchantID string, cursor string, limit int64) ([]*model.Notification, string, error) {
+func (r Mongo) FindNotifications(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error) {
+	return r.findNotifications(model.CollectionNotification, merchantID, mode, cursor, limit)
+}
+
+// FindArchivedNotifications :
+func (r Mongo) FindArchivedNotifications(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error) {
+	return r.findNotifications(model.CollectionNotificationArchive, merchantID, mode, cursor, limit)
+}
+
+func (r Mongo) findNotifications(entityName model.Collection, merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error) {
 	notifications := make([]*model.Notification, 0)
 
-	ctx := context.Background()
+	ctx := r.getContext()
 	query := bson.M{
 		"merchantId": merchantID,
+		"mode":       modeQuery(mode),
 	}
 
 	sortQuery := bson.M{"updatedAt": -1}
@@ -49,7 +56,7 @@ func (r Repository) FindNotifications(merchantID string, cursor string, limit in
 		}
 	}
 
-	nextCursor, err := r.db.Collection(model.CollectionNotification).Find(
+	nextCursor, err := r.db.Collection(entityName).Find(
 		ctx,
 		query,
 		options.Find().SetLimit(limit+1).SetSort(sortQuery).SetSkip(currentSkip),
@@ -64,16 +71,19 @@ func (r Repository) FindNotifications(merchantID string, cursor string, limit in
 		tempResult := bson.M{}
 
 		if err := nextCursor.Decode(&tempResult); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
 			return nil, "", errors.New("entity decode error")
 		}
 
 		data, err := json.Marshal(tempResult)
 		if err != nil {
+			r.getLogger().Error("entity marshal error", slog.Any("error", err))
 			return nil, "", errors.New("entity marshal error")
 		}
 
 		notification := new(model.Notification)
 		if err := json.Unmarshal(data, notification); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
 			return nil, "", errors.New("entity unmarshal error")
 		}
 
@@ -110,7 +120,7 @@ func (r Repository) FindNotifications(merchantID string, cursor string, limit in
 }
 
 // FindNotificationByID :
-func (r Repository) FindNotificationByID(id string, merchantID string) (*model.Notification, error) {
+func (r Mongo) FindNotificationByID(id string, merchantID string) (*model.Notification, error) {
 	dataID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, err
@@ -118,7 +128,7 @@ func (r Repository) FindNotificationByID(id string, merchantID string) (*model.N
 
 	tempResult := bson.M{}
 	if err := r.db.Collection(model.CollectionNotification).FindOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": dataID, "merchantId": merchantID},
 	).Decode(&tempResult); err != nil {
 		return nil, err
@@ -126,11 +136,13 @@ func (r Repository) FindNotificationByID(id string, merchantID string) (*model.N
 
 	data, err := json.Marshal(tempResult)
 	if err != nil {
+		r.getLogger().Error("entity marshal error", slog.Any("error", err))
 		return nil, errors.New("entity marshal error")
 	}
 
 	v := new(model.Notification)
 	if err := json.Unmarshal(data, v); err != nil {
+		r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
 		return nil, errors.New("entity unmarshal error")
 	}
 
@@ -138,22 +150,33 @@ func (r Repository) FindNotificationByID(id string, merchantID string) (*model.N
 }
 
 // FindNotification :
-func (r Repository) FindNotification(typ string, requestID string) (*model.Notification, error) {
+func (r Mongo) FindNotification(typ string, requestID string, mode types.Mode) (*model.Notification, error) {
+	return r.findNotification(model.CollectionNotification, typ, requestID, mode)
+}
+
+// FindArchivedNotification :
+func (r Mongo) FindArchivedNotification(typ string, requestID string, mode types.Mode) (*model.Notification, error) {
+	return r.findNotification(model.CollectionNotificationArchive, typ, requestID, mode)
+}
+
+func (r Mongo) findNotification(entityName model.Collection, typ string, requestID string, mode types.Mode) (*model.Notification, error) {
 	tempResult := bson.M{}
-	if err := r.db.Collection(model.CollectionNotification).FindOne(
-		context.Background(),
-		bson.M{"type": typ, "requestId": requestID},
+	if err := r.db.Collection(entityName).FindOne(
+		r.getContext(),
+		bson.M{"type": typ, "requestId": requestID, "mode": modeQuery(mode)},
 	).Decode(&tempResult); err != nil {
 		return nil, err
 	}
 
 	data, err := json.Marshal(tempResult)
 	if err != nil {
+		r.getLogger().Error("entity marshal error", slog.Any("error", err))
 		return nil, errors.New("entity marshal error")
 	}
 
 	v := new(model.Notification)
 	if err := json.Unmarshal(data, v); err != nil {
+		r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
 		return nil, errors.New("entity unmarshal error")
 	}
 
@@ -161,29 +184,23 @@ func (r Repository) FindNotification(typ string, requestID string) (*model.Notif
 }
 
 // UpsertNotification :
-func (r Repository) UpsertNotification(notification *model.Notification) error {
+func (r Mongo) UpsertNotification(notification *model.Notification) error {
 	_, err := r.db.Collection(model.CollectionNotification).UpdateOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": notification.ID},
 		bson.M{"$set": notification},
 		options.Update().SetUpsert(true),
 	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
 	return err
 }
 
-// CreateNotification :
-func (r Repository) CreateNotification(notification *model.Notification) error {
-	return r.db.Client().UseSession(context.Background(), func(sctx mongo.SessionContext) error {
-		if err := sctx.StartTransaction(
-			options.Transaction().
-				SetReadConcern(readconcern.Snapshot()).
-				SetWriteConcern(writeconcern.New(writeconcern.WMajority())),
-		); err != nil {
-			return err
-		}
-
-		if err := r.UpsertNotification(notification); err != nil {
-			_ = sctx.AbortTransaction(sctx)
+// CreateNotification : creates the notification together with its first attempt, pending or held
+func (r Mongo) CreateNotification(notification *model.Notification) error {
+	return r.withTransaction(func(tx *Mongo) error {
+		if err := tx.UpsertNotification(notification); err != nil {
 			return err
 		}
 
@@ -193,41 +210,39 @@ func (r Repository) CreateNotification(notification *model.Notification) error {
 		notificationAttempt.NotificationID = notification.ID
 		notificationAttempt.MerchantID = notification.MerchantID
 		notificationAttempt.AttemptNo = 1
-		notificationAttempt.Status = types.NotificationStatusPending
+		notificationAttempt.Status = FirstAttemptStatus(notification)
+		notificationAttempt.TraceParent = notification.TraceParent
 		notificationAttempt.CreatedAt = time.Now().UTC()
 		notificationAttempt.UpdatedAt = time.Now().UTC()
 
-		if err := r.UpsertNotificationAttempt(notificationAttempt); err != nil {
-			_ = sctx.AbortTransaction(sctx)
+		return tx.UpsertNotificationAttempt(notificationAttempt)
+	})
+}
+
+// SaveNotificationAttemptResult : writes the outcome of an attempt and the resulting notification status atomically
+func (r Mongo) SaveNotificationAttemptResult(notification *model.Notification, attempt *model.NotificationAttempt) error {
+	return r.withTransaction(func(tx *Mongo) error {
+		if err := tx.UpsertNotificationAttempt(attempt); err != nil {
 			return err
 		}
 
-		for {
-			err := sctx.CommitTransaction(sctx)
-			switch e := err.(type) {
-			case nil:
-				return nil
-			case mongo.CommandError:
-				return e
-			default:
-				return e
-			}
-		}
+		return tx.UpsertNotification(notification)
 	})
 }
 
 // FindRetryNotifications :
-func (r Repository) FindRetryNotifications(cursor string) ([]*model.Notification, string, error) {
+func (r Mongo) FindRetryNotifications(policy RetryPolicy, cursor string) ([]*model.Notification, string, error) {
 	notifications := make([]*model.Notification, 0)
 
-	ctx := context.Background()
+	ctx := r.getContext()
 	query := bson.M{
 		"status":    types.NotificationStatusFailed,
-		"attemptNo": bson.M{"$lt": constant.RetryAttemptCount},
+		"mode":      modeQuery(policy.Mode),
+		"attemptNo": bson.M{"$lt": policy.Attempts},
 		"$or": bson.A{
 			bson.M{"attemptedAt": bson.M{"$exists": false}},
 			bson.M{"attemptedAt": nil},
-			bson.M{"attemptedAt": bson.M{"$lte": time.Now().Add(-1 * constant.RetryAttemptDuration)}},
+			bson.M{"attemptedAt": bson.M{"$lte": time.Now().Add(-1 * policy.Interval)}},
 		},
 	}
 
@@ -262,16 +277,19 @@ func (r Repository) FindRetryNotifications(cursor string) ([]*model.Notification
 		tempResult := bson.M{}
 
 		if err := nextCursor.Decode(&tempResult); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
 			return nil, "", errors.New("entity decode error")
 		}
 
 		data, err := json.Marshal(tempResult)
 		if err != nil {
+			r.getLogger().Error("entity marshal error", slog.Any("error", err))
 			return nil, "", errors.New("entity marshal error")
 		}
 
 		notification := new(model.Notification)
 		if err := json.Unmarshal(data, notification); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
 			return nil, "", errors.New("entity unmarshal error")
 		}
 
@@ -288,3 +306,147 @@ func (r Repository) FindRetryNotifications(cursor string) ([]*model.Notification
 
 	return notifications, "", nil
 }
+
+// FindStuckNotifications : notifications still pending after the cutoff, their delivery never completed
+func (r Mongo) FindStuckNotifications(cutoff time.Time, cursor string) ([]*model.Notification, string, error) {
+	notifications := make([]*model.Notification, 0)
+
+	ctx := r.getContext()
+	query := bson.M{
+		"status":    types.NotificationStatusPending,
+		"updatedAt": bson.M{"$lte": cutoff},
+	}
+
+	var limit int64 = 50
+
+	currentSkip := int64(0)
+
+	if cursor != "" {
+		data, err := hex.DecodeString(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		currentSkip, err = strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	nextCursor, err := r.db.Collection(model.CollectionNotification).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(bson.M{"updatedAt": 1}).SetSkip(currentSkip),
+	)
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		tempResult := bson.M{}
+
+		if err := nextCursor.Decode(&tempResult); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, "", errors.New("entity decode error")
+		}
+
+		data, err := json.Marshal(tempResult)
+		if err != nil {
+			r.getLogger().Error("entity marshal error", slog.Any("error", err))
+			return nil, "", errors.New("entity marshal error")
+		}
+
+		notification := new(model.Notification)
+		if err := json.Unmarshal(data, notification); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+			return nil, "", errors.New("entity unmarshal error")
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(notifications) > int(limit) {
+		return notifications[:len(notifications)-1], hex.EncodeToString([]byte(fmt.Sprintf("%d", currentSkip+limit))), nil
+	}
+
+	return notifications, "", nil
+}
+
+// FindHeldSubscriptionKeys :
+func (r Mongo) FindHeldSubscriptionKeys() ([]model.SubscriptionKey, error) {
+	ctx := r.getContext()
+	cursor, err := r.db.Collection(model.CollectionNotification).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": types.NotificationStatusHeld}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"merchantId": "$merchantId", "type": "$type", "mode": "$mode"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := make([]model.SubscriptionKey, 0)
+	for cursor.Next(ctx) {
+		var group struct {
+			ID model.SubscriptionKey `bson:"_id"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, errors.New("entity decode error")
+		}
+		keys = append(keys, group.ID)
+	}
+
+	return keys, cursor.Err()
+}
+
+// FindHeldNotifications :
+func (r Mongo) FindHeldNotifications(id model.SubscriptionKey, limit int64) ([]*model.Notification, error) {
+	notifications := make([]*model.Notification, 0)
+
+	ctx := r.getContext()
+	nextCursor, err := r.db.Collection(model.CollectionNotification).Find(
+		ctx,
+		bson.M{
+			"merchantId": id.MerchantID,
+			"type":       id.Type,
+			"mode":       modeQuery(id.Mode),
+			"status":     types.NotificationStatusHeld,
+		},
+		options.Find().SetLimit(limit).SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		tempResult := bson.M{}
+
+		if err := nextCursor.Decode(&tempResult); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, errors.New("entity decode error")
+		}
+
+		data, err := json.Marshal(tempResult)
+		if err != nil {
+			r.getLogger().Error("entity marshal error", slog.Any("error", err))
+			return nil, errors.New("entity marshal error")
+		}
+
+		notification := new(model.Notification)
+		if err := json.Unmarshal(data, notification); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+			return nil, errors.New("entity unmarshal error")
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nextCursor.Err()
+}
@@ -1,19 +1,25 @@
 package repository
 
 import (
-	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
 	"xenotification/app/model"
+	"xenotification/app/types"
 
+	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // FindLastNotificationAttempt :
-func (r Repository) FindLastNotificationAttempt(notificationID primitive.ObjectID) (*model.NotificationAttempt, error) {
+func (r Mongo) FindLastNotificationAttempt(notificationID primitive.ObjectID) (*model.NotificationAttempt, error) {
 	v := new(model.NotificationAttempt)
 	if err := r.db.Collection(model.CollectionNotificationAttempt).FindOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"notificationId": notificationID},
 		options.FindOne().SetSort(bson.M{"attemptNo": -1}),
 	).Decode(v); err != nil {
@@ -24,12 +30,69 @@ func (r Repository) FindLastNotificationAttempt(notificationID primitive.ObjectI
 }
 
 // UpsertNotificationAttempt :
-func (r Repository) UpsertNotificationAttempt(att *model.NotificationAttempt) error {
+func (r Mongo) UpsertNotificationAttempt(att *model.NotificationAttempt) error {
 	_, err := r.db.Collection(model.CollectionNotificationAttempt).UpdateOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": att.ID},
 		bson.M{"$set": att},
 		options.Update().SetUpsert(true),
 	)
 	return err
 }
+
+// FindStuckNotificationAttempts : attempts still pending after the cutoff, their outcome was never recorded
+func (r Mongo) FindStuckNotificationAttempts(cutoff time.Time, cursor string) ([]*model.NotificationAttempt, string, error) {
+	attempts := make([]*model.NotificationAttempt, 0)
+
+	ctx := r.getContext()
+	query := bson.M{
+		"status":    types.NotificationStatusPending,
+		"updatedAt": bson.M{"$lte": cutoff},
+	}
+
+	var limit int64 = 50
+
+	currentSkip := int64(0)
+
+	if cursor != "" {
+		data, err := hex.DecodeString(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		currentSkip, err = strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	nextCursor, err := r.db.Collection(model.CollectionNotificationAttempt).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(bson.M{"updatedAt": 1}).SetSkip(currentSkip),
+	)
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		attempt := new(model.NotificationAttempt)
+		if err := nextCursor.Decode(attempt); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, "", errors.New("entity decode error")
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(attempts) > int(limit) {
+		return attempts[:len(attempts)-1], hex.EncodeToString([]byte(fmt.Sprintf("%d", currentSkip+limit))), nil
+	}
+
+	return attempts, "", nil
+}
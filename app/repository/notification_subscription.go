@@ -1,11 +1,13 @@
 package repository
 
 import (
-	"context"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"strconv"
+	"time"
 	"xenotification/app/model"
+	"xenotification/app/types"
 
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,12 +15,13 @@ import (
 )
 
 // FindNotificationSubscriptions :
-func (r Repository) FindNotificationSubscriptions(merchantID string, cursor string, limit int64) ([]*model.NotificationSubscription, string, error) {
+func (r Mongo) FindNotificationSubscriptions(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.NotificationSubscription, string, error) {
 	notificationSubs := make([]*model.NotificationSubscription, 0)
 
-	ctx := context.Background()
+	ctx := r.getContext()
 	query := bson.M{
 		"_id.merchantId": merchantID,
+		"_id.mode":       modeQuery(mode),
 	}
 
 	if limit <= 0 {
@@ -53,6 +56,7 @@ func (r Repository) FindNotificationSubscriptions(merchantID string, cursor stri
 	for nextCursor.Next(ctx) {
 		notificationSub := new(model.NotificationSubscription)
 		if err := nextCursor.Decode(notificationSub); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
 			return nil, "", errors.New("entity decode error")
 		}
 		notificationSubs = append(notificationSubs, notificationSub)
@@ -70,10 +74,10 @@ func (r Repository) FindNotificationSubscriptions(merchantID string, cursor stri
 }
 
 // FindNotificationSubscription :
-func (r Repository) FindNotificationSubscription(id model.SubscriptionKey) (*model.NotificationSubscription, error) {
+func (r Mongo) FindNotificationSubscription(id model.SubscriptionKey) (*model.NotificationSubscription, error) {
 	v := new(model.NotificationSubscription)
 	if err := r.db.Collection(model.CollectionNotificationSubscription).FindOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": id},
 	).Decode(v); err != nil {
 		return nil, err
@@ -82,23 +86,120 @@ func (r Repository) FindNotificationSubscription(id model.SubscriptionKey) (*mod
 	return v, nil
 }
 
-// UpsertNotificationSubscription :
-func (r Repository) UpsertNotificationSubscription(sub *model.NotificationSubscription) error {
-	_, err := r.db.Collection(model.CollectionNotificationSubscription).UpdateOne(
-		context.Background(),
+// UpsertNotificationSubscription : replaces the whole subscription, so options left out are cleared
+func (r Mongo) UpsertNotificationSubscription(sub *model.NotificationSubscription) error {
+	_, err := r.db.Collection(model.CollectionNotificationSubscription).ReplaceOne(
+		r.getContext(),
 		bson.M{"_id": sub.ID},
-		bson.M{"$set": sub},
-		options.Update().SetUpsert(true),
+		sub,
+		options.Replace().SetUpsert(true),
 	)
 	return err
 }
 
 // DeleteNotificationSubscription :
-func (r Repository) DeleteNotificationSubscription(id model.SubscriptionKey) error {
+func (r Mongo) DeleteNotificationSubscription(id model.SubscriptionKey) error {
 	_, err := r.db.Collection(model.CollectionNotificationSubscription).DeleteOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": id},
 		options.Delete(),
 	)
 	return err
 }
+
+// UpdateNotificationSubscriptionStatus :
+func (r Mongo) UpdateNotificationSubscriptionStatus(id model.SubscriptionKey, status types.SubscriptionStatus) error {
+	result, err := r.db.Collection(model.CollectionNotificationSubscription).UpdateOne(
+		r.getContext(),
+		bson.M{"_id": id},
+		subscriptionStatusUpdate(status, time.Now().UTC()),
+	)
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func subscriptionStatusUpdate(status types.SubscriptionStatus, now time.Time) bson.M {
+	update := bson.M{"$set": bson.M{"status": status, "updatedAt": now}}
+	if status == types.SubscriptionStatusActive {
+		update["$unset"] = bson.M{
+			"consecutiveFailures": "",
+			"failingSince":        "",
+			"disabledAt":          "",
+			"disabledReason":      "",
+		}
+	}
+	return update
+}
+
+// RecordNotificationSubscriptionDelivery :
+func (r Mongo) RecordNotificationSubscriptionDelivery(id model.SubscriptionKey, succeeded bool, at time.Time) (*model.NotificationSubscription, error) {
+	update := bson.M{
+		"$inc": bson.M{"consecutiveFailures": 1},
+		// $min sets it when missing and keeps the start of a running streak
+		"$min": bson.M{"failingSince": at},
+	}
+	if succeeded {
+		update = bson.M{
+			"$set":   bson.M{"lastSuccessAt": at},
+			"$unset": bson.M{"consecutiveFailures": "", "failingSince": ""},
+		}
+	}
+
+	v := new(model.NotificationSubscription)
+	if err := r.db.Collection(model.CollectionNotificationSubscription).FindOneAndUpdate(
+		r.getContext(),
+		bson.M{"_id": id},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// VerifyNotificationSubscription :
+func (r Mongo) VerifyNotificationSubscription(id model.SubscriptionKey, url string, at time.Time) (bool, error) {
+	result, err := r.db.Collection(model.CollectionNotificationSubscription).UpdateOne(
+		r.getContext(),
+		bson.M{
+			"_id":             id,
+			"notificationUrl": url,
+			"status":          types.SubscriptionStatusPendingVerification,
+		},
+		bson.M{"$set": bson.M{
+			"status":     types.SubscriptionStatusActive,
+			"verifiedAt": at,
+			"updatedAt":  at,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// AutoDisableNotificationSubscription :
+func (r Mongo) AutoDisableNotificationSubscription(id model.SubscriptionKey, reason string, at time.Time) (bool, error) {
+	result, err := r.db.Collection(model.CollectionNotificationSubscription).UpdateOne(
+		r.getContext(),
+		bson.M{
+			"_id":    id,
+			"status": bson.M{"$in": bson.A{nil, types.SubscriptionStatusActive}},
+		},
+		bson.M{"$set": bson.M{
+			"status":         types.SubscriptionStatusDisabled,
+			"disabledAt":     at,
+			"disabledReason": reason,
+			"updatedAt":      at,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"xenotification/app/model"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const clientCertificateColumns = `id, merchant_id, certificate, private_key, subject, fingerprint, not_after, sealed,
+	created_at, updated_at`
+
+// FindClientCertificates :
+func (r Repository) FindClientCertificates(merchantID string) ([]*model.ClientCertificate, error) {
+	return r.queryClientCertificates(
+		`SELECT `+clientCertificateColumns+` FROM client_certificate
+		WHERE merchant_id = $1
+		ORDER BY not_after`,
+		merchantID,
+	)
+}
+
+// FindClientCertificate :
+func (r Repository) FindClientCertificate(id primitive.ObjectID, merchantID string) (*model.ClientCertificate, error) {
+	return r.scanClientCertificate(r.q.QueryRowContext(
+		r.getContext(),
+		`SELECT `+clientCertificateColumns+` FROM client_certificate
+		WHERE id = $1 AND merchant_id = $2`,
+		id.Hex(), merchantID,
+	))
+}
+
+// CreateClientCertificate :
+func (r Repository) CreateClientCertificate(cert *model.ClientCertificate) error {
+	sealed, err := marshalSealed(cert.Sealed)
+	if err != nil {
+		r.getLogger().Error("entity marshal error", slog.Any("error", err))
+		return errors.New("entity marshal error")
+	}
+
+	_, err = r.q.ExecContext(
+		r.getContext(),
+		`INSERT INTO client_certificate (`+clientCertificateColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		cert.ID.Hex(),
+		cert.MerchantID,
+		cert.Certificate,
+		cert.PrivateKey,
+		cert.Subject,
+		cert.Fingerprint,
+		cert.NotAfter,
+		sealed,
+		cert.CreatedAt,
+		cert.UpdatedAt,
+	)
+	return mapError(err)
+}
+
+// DeleteClientCertificate :
+func (r Repository) DeleteClientCertificate(id primitive.ObjectID, merchantID string) error {
+	_, err := r.q.ExecContext(
+		r.getContext(),
+		`DELETE FROM client_certificate WHERE id = $1 AND merchant_id = $2`,
+		id.Hex(), merchantID,
+	)
+	return err
+}
+
+// ClientCertificateInUse :
+func (r Repository) ClientCertificateInUse(id primitive.ObjectID) (bool, error) {
+	var inUse bool
+	err := r.q.QueryRowContext(
+		r.getContext(),
+		`SELECT EXISTS (SELECT 1 FROM notification_subscription WHERE client_certificate_id = $1)`,
+		id.Hex(),
+	).Scan(&inUse)
+	return inUse, err
+}
+
+func (r Repository) queryClientCertificates(query string, args ...interface{}) ([]*model.ClientCertificate, error) {
+	rows, err := r.q.QueryContext(r.getContext(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := make([]*model.ClientCertificate, 0)
+	for rows.Next() {
+		cert, err := r.scanClientCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, rows.Err()
+}
+
+func (r Repository) scanClientCertificate(row scanner) (*model.ClientCertificate, error) {
+	var (
+		id     string
+		sealed []byte
+	)
+
+	v := new(model.ClientCertificate)
+	if err := row.Scan(
+		&id,
+		&v.MerchantID,
+		&v.Certificate,
+		&v.PrivateKey,
+		&v.Subject,
+		&v.Fingerprint,
+		&v.NotAfter,
+		&sealed,
+		&v.CreatedAt,
+		&v.UpdatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, mapError(err)
+		}
+		r.getLogger().Error("entity decode error", slog.Any("error", err))
+		return nil, errors.New("entity decode error")
+	}
+
+	var err error
+	if v.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		r.getLogger().Error("entity decode error", slog.Any("error", err))
+		return nil, errors.New("entity decode error")
+	}
+
+	if v.Sealed, err = unmarshalSealed(sealed); err != nil {
+		r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+		return nil, errors.New("entity unmarshal error")
+	}
+
+	v.NotAfter = v.NotAfter.UTC()
+	v.CreatedAt = v.CreatedAt.UTC()
+	v.UpdatedAt = v.UpdatedAt.UTC()
+
+	return v, nil
+}
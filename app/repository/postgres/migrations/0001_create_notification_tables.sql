@@ -0,0 +1,48 @@
+CREATE TABLE notification_subscription (
+    merchant_id             TEXT        NOT NULL,
+    type                    TEXT        NOT NULL,
+    notification_url        TEXT        NOT NULL DEFAULT '',
+    notification_key        TEXT        NOT NULL DEFAULT '',
+    acceptable_status_codes INTEGER[]   NOT NULL DEFAULT '{}',
+    created_at              TIMESTAMPTZ NOT NULL,
+    updated_at              TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (merchant_id, type)
+);
+
+CREATE TABLE notification (
+    id               TEXT        PRIMARY KEY,
+    merchant_id      TEXT        NOT NULL,
+    request_id       TEXT        NOT NULL,
+    type             TEXT        NOT NULL,
+    payload          JSONB,
+    notification_url TEXT        NOT NULL DEFAULT '',
+    notification_key TEXT        NOT NULL DEFAULT '',
+    attempt_no       INTEGER     NOT NULL DEFAULT 0,
+    attempted_at     TIMESTAMPTZ,
+    status           TEXT        NOT NULL,
+    trace_parent     TEXT        NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL,
+    CONSTRAINT notification_type_request_id_key UNIQUE (type, request_id)
+);
+
+CREATE INDEX notification_merchant_id_updated_at_idx ON notification (merchant_id, updated_at DESC);
+CREATE INDEX notification_retry_idx ON notification (status, attempt_no, attempted_at);
+CREATE INDEX notification_status_updated_at_idx ON notification (status, updated_at);
+
+CREATE TABLE notification_attempt (
+    id              TEXT        PRIMARY KEY,
+    notification_id TEXT        NOT NULL REFERENCES notification (id) ON DELETE CASCADE,
+    merchant_id     TEXT        NOT NULL,
+    attempt_no      INTEGER     NOT NULL,
+    status          TEXT        NOT NULL,
+    status_code     INTEGER     NOT NULL DEFAULT 0,
+    error           TEXT,
+    sent_at         TIMESTAMPTZ,
+    trace_parent    TEXT        NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX notification_attempt_notification_id_attempt_no_idx ON notification_attempt (notification_id, attempt_no DESC);
+CREATE INDEX notification_attempt_status_updated_at_idx ON notification_attempt (status, updated_at);
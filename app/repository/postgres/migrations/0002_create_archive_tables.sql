@@ -0,0 +1,16 @@
+CREATE TABLE notification_archive (
+    LIKE notification INCLUDING DEFAULTS,
+    archived_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX notification_archive_merchant_id_updated_at_idx ON notification_archive (merchant_id, updated_at DESC);
+CREATE INDEX notification_archive_updated_at_idx ON notification_archive (updated_at);
+
+CREATE TABLE notification_attempt_archive (
+    LIKE notification_attempt INCLUDING DEFAULTS,
+    archived_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX notification_attempt_archive_notification_id_idx ON notification_attempt_archive (notification_id);
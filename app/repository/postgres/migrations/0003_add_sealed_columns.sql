@@ -0,0 +1,3 @@
+ALTER TABLE notification ADD COLUMN sealed JSONB;
+ALTER TABLE notification_archive ADD COLUMN sealed JSONB;
+ALTER TABLE notification_subscription ADD COLUMN sealed JSONB;
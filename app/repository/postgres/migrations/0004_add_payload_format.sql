@@ -0,0 +1,3 @@
+ALTER TABLE notification ADD COLUMN payload_format TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification_archive ADD COLUMN payload_format TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification_subscription ADD COLUMN payload_format TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE notification_subscription ADD COLUMN http_options JSONB;
@@ -0,0 +1,19 @@
+CREATE TABLE client_certificate (
+    id TEXT PRIMARY KEY,
+    merchant_id TEXT NOT NULL,
+    certificate TEXT NOT NULL,
+    private_key TEXT NOT NULL DEFAULT '',
+    subject TEXT NOT NULL DEFAULT '',
+    fingerprint TEXT NOT NULL DEFAULT '',
+    not_after TIMESTAMPTZ NOT NULL,
+    sealed JSONB,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX client_certificate_merchant_id_idx ON client_certificate (merchant_id);
+
+ALTER TABLE notification_subscription ADD COLUMN client_certificate_id TEXT;
+
+CREATE INDEX notification_subscription_client_certificate_id_idx ON notification_subscription (client_certificate_id)
+    WHERE client_certificate_id IS NOT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE notification_subscription
+    ADD COLUMN method TEXT NOT NULL DEFAULT '',
+    ADD COLUMN body_encoding TEXT NOT NULL DEFAULT '',
+    ADD COLUMN content_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN gzip BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,9 @@
+ALTER TABLE notification_subscription ADD COLUMN transform JSONB;
+
+ALTER TABLE notification_attempt
+    ADD COLUMN request_body TEXT NOT NULL DEFAULT '',
+    ADD COLUMN sealed JSONB;
+
+ALTER TABLE notification_attempt_archive
+    ADD COLUMN request_body TEXT NOT NULL DEFAULT '',
+    ADD COLUMN sealed JSONB;
@@ -0,0 +1,3 @@
+ALTER TABLE notification_subscription ADD COLUMN status TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX notification_held_idx ON notification (merchant_id, type, created_at) WHERE status = 'HELD';
@@ -0,0 +1,6 @@
+ALTER TABLE notification_subscription
+	ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN failing_since TIMESTAMPTZ,
+	ADD COLUMN last_success_at TIMESTAMPTZ,
+	ADD COLUMN disabled_at TIMESTAMPTZ,
+	ADD COLUMN disabled_reason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+CREATE TABLE subscription_audit (
+    id TEXT PRIMARY KEY,
+    merchant_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    source_ip TEXT NOT NULL DEFAULT '',
+    changes JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX subscription_audit_merchant_id_created_at_idx ON subscription_audit (merchant_id, created_at DESC);
+
+CREATE INDEX subscription_audit_merchant_id_type_created_at_idx ON subscription_audit (merchant_id, type, created_at DESC);
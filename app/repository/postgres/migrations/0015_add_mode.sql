@@ -0,0 +1,10 @@
+ALTER TABLE notification_subscription ADD COLUMN mode TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification_subscription DROP CONSTRAINT notification_subscription_pkey;
+ALTER TABLE notification_subscription ADD PRIMARY KEY (merchant_id, type, mode);
+
+ALTER TABLE notification ADD COLUMN mode TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification DROP CONSTRAINT notification_type_request_id_key;
+ALTER TABLE notification ADD CONSTRAINT notification_type_request_id_mode_key UNIQUE (type, request_id, mode);
+ALTER TABLE notification_archive ADD COLUMN mode TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE subscription_audit ADD COLUMN mode TEXT NOT NULL DEFAULT '';
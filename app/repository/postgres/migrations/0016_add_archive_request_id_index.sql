@@ -0,0 +1 @@
+CREATE INDEX notification_archive_type_request_id_mode_idx ON notification_archive (type, request_id, mode);
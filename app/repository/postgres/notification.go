@@ -0,0 +1,351 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/types"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const notificationColumns = `id, merchant_id, request_id, type, payload, notification_url, notification_key,
+	attempt_no, attempted_at, status, trace_parent, created_at, updated_at, sealed, payload_format, mode`
+
+// FindNotifications :
+func (r Repository) FindNotifications(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	currentSkip, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	notifications, err := r.queryNotifications(
+		`SELECT `+notificationColumns+` FROM notification
+		WHERE merchant_id = $1 AND mode = $2
+		ORDER BY updated_at DESC
+		LIMIT $3 OFFSET $4`,
+		merchantID, mode, limit+1, currentSkip,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(notifications) > int(limit) {
+		return notifications[:len(notifications)-1], encodeCursor(currentSkip + limit), nil
+	}
+
+	return notifications, "", nil
+}
+
+// FindNotificationByID :
+func (r Repository) FindNotificationByID(id string, merchantID string) (*model.Notification, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+
+	return r.scanNotification(r.q.QueryRowContext(
+		r.getContext(),
+		`SELECT `+notificationColumns+` FROM notification WHERE id = $1 AND merchant_id = $2`,
+		id, merchantID,
+	))
+}
+
+// FindNotification :
+func (r Repository) FindNotification(typ string, requestID string, mode types.Mode) (*model.Notification, error) {
+	return r.scanNotification(r.q.QueryRowContext(
+		r.getContext(),
+		`SELECT `+notificationColumns+` FROM notification WHERE type = $1 AND request_id = $2 AND mode = $3`,
+		typ, requestID, mode,
+	))
+}
+
+// UpsertNotification :
+func (r Repository) UpsertNotification(notification *model.Notification) error {
+	payload, err := json.Marshal(notification.Payload)
+	if err != nil {
+		r.getLogger().Error("entity marshal error", slog.Any("error", err))
+		return errors.New("entity marshal error")
+	}
+
+	sealed, err := marshalSealed(notification.Sealed)
+	if err != nil {
+		r.getLogger().Error("entity marshal error", slog.Any("error", err))
+		return errors.New("entity marshal error")
+	}
+
+	_, err = r.q.ExecContext(
+		r.getContext(),
+		`INSERT INTO notification (`+notificationColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (id) DO UPDATE SET
+			merchant_id = EXCLUDED.merchant_id,
+			request_id = EXCLUDED.request_id,
+			type = EXCLUDED.type,
+			payload = EXCLUDED.payload,
+			notification_url = EXCLUDED.notification_url,
+			notification_key = EXCLUDED.notification_key,
+			attempt_no = EXCLUDED.attempt_no,
+			attempted_at = EXCLUDED.attempted_at,
+			status = EXCLUDED.status,
+			trace_parent = COALESCE(NULLIF(EXCLUDED.trace_parent, ''), notification.trace_parent),
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at,
+			sealed = COALESCE(EXCLUDED.sealed, notification.sealed),
+			payload_format = EXCLUDED.payload_format,
+			mode = EXCLUDED.mode`,
+		notification.ID.Hex(),
+		notification.MerchantID,
+		notification.RequestID,
+		notification.Type,
+		string(payload), // []byte would be sent as bytea
+		notification.NotificationURL,
+		notification.NotificationKey,
+		notification.AttemptNo,
+		notification.AttemptedAt,
+		notification.Status,
+		notification.TraceParent,
+		notification.CreatedAt,
+		notification.UpdatedAt,
+		sealed,
+		notification.PayloadFormat,
+		notification.Mode,
+	)
+	return mapError(err)
+}
+
+// CreateNotification : creates the notification together with its first attempt, pending or held.
+// A notification with the same type, request ID and mode makes it fail with repository.ErrDuplicate.
+func (r Repository) CreateNotification(notification *model.Notification) error {
+	return r.withTransaction(func(tx *Repository) error {
+		if err := tx.UpsertNotification(notification); err != nil {
+			return err
+		}
+
+		// Create the first attempt
+		notificationAttempt := new(model.NotificationAttempt)
+		notificationAttempt.ID = primitive.NewObjectID()
+		notificationAttempt.NotificationID = notification.ID
+		notificationAttempt.MerchantID = notification.MerchantID
+		notificationAttempt.AttemptNo = 1
+		notificationAttempt.Status = repository.FirstAttemptStatus(notification)
+		notificationAttempt.TraceParent = notification.TraceParent
+		notificationAttempt.CreatedAt = time.Now().UTC()
+		notificationAttempt.UpdatedAt = time.Now().UTC()
+
+		return tx.UpsertNotificationAttempt(notificationAttempt)
+	})
+}
+
+// SaveNotificationAttemptResult : writes the outcome of an attempt and the resulting notification status atomically
+func (r Repository) SaveNotificationAttemptResult(notification *model.Notification, attempt *model.NotificationAttempt) error {
+	return r.withTransaction(func(tx *Repository) error {
+		if err := tx.UpsertNotification(notification); err != nil {
+			return err
+		}
+
+		return tx.UpsertNotificationAttempt(attempt)
+	})
+}
+
+// FindRetryNotifications : claims the next batch of notifications due for a retry.
+// Rows are picked with FOR UPDATE SKIP LOCKED and their attemptedAt is moved to now, so a sweep
+// running on another instance gets a different batch. A claim which is never delivered becomes
+// due again after the retry interval. The cursor only tells whether more rows may be due.
+func (r Repository) FindRetryNotifications(policy repository.RetryPolicy, cursor string) ([]*model.Notification, string, error) {
+	var notifications []*model.Notification
+
+	err := r.withTransaction(func(tx *Repository) error {
+		now := time.Now().UTC()
+
+		var err error
+		notifications, err = tx.queryNotifications(
+			`UPDATE notification SET attempted_at = $1
+			WHERE id IN (
+				SELECT id FROM notification
+				WHERE status = $2
+					AND mode = $6
+					AND attempt_no < $3
+					AND (attempted_at IS NULL OR attempted_at <= $4)
+				ORDER BY attempted_at NULLS FIRST
+				LIMIT $5
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING `+notificationColumns,
+			now,
+			types.NotificationStatusFailed,
+			policy.Attempts,
+			now.Add(-1*policy.Interval),
+			defaultLimit,
+			policy.Mode,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(notifications) == defaultLimit {
+		return notifications, encodeCursor(defaultLimit), nil
+	}
+
+	return notifications, "", nil
+}
+
+// FindStuckNotifications :
+func (r Repository) FindStuckNotifications(cutoff time.Time, cursor string) ([]*model.Notification, string, error) {
+	currentSkip, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	notifications, err := r.queryNotifications(
+		`SELECT `+notificationColumns+` FROM notification
+		WHERE status = $1 AND updated_at <= $2
+		ORDER BY updated_at
+		LIMIT $3 OFFSET $4`,
+		types.NotificationStatusPending, cutoff, defaultLimit+1, currentSkip,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(notifications) > defaultLimit {
+		return notifications[:len(notifications)-1], encodeCursor(currentSkip + defaultLimit), nil
+	}
+
+	return notifications, "", nil
+}
+
+// FindHeldSubscriptionKeys :
+func (r Repository) FindHeldSubscriptionKeys() ([]model.SubscriptionKey, error) {
+	rows, err := r.q.QueryContext(r.getContext(),
+		`SELECT DISTINCT merchant_id, type, mode FROM notification WHERE status = $1`,
+		types.NotificationStatusHeld,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]model.SubscriptionKey, 0)
+	for rows.Next() {
+		var key model.SubscriptionKey
+		if err := rows.Scan(&key.MerchantID, &key.Type, &key.Mode); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// FindHeldNotifications :
+func (r Repository) FindHeldNotifications(id model.SubscriptionKey, limit int64) ([]*model.Notification, error) {
+	return r.queryNotifications(
+		`SELECT `+notificationColumns+` FROM notification
+		WHERE merchant_id = $1 AND type = $2 AND mode = $5 AND status = $3
+		ORDER BY created_at, id
+		LIMIT $4`,
+		id.MerchantID, id.Type, types.NotificationStatusHeld, limit, id.Mode,
+	)
+}
+
+func (r Repository) queryNotifications(query string, args ...interface{}) ([]*model.Notification, error) {
+	rows, err := r.q.QueryContext(r.getContext(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]*model.Notification, 0)
+	for rows.Next() {
+		notification, err := r.scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanNotification : extra receives the columns selected after notificationColumns
+func (r Repository) scanNotification(row scanner, extra ...interface{}) (*model.Notification, error) {
+	var (
+		id          string
+		payload     []byte
+		attemptedAt sql.NullTime
+		sealed      []byte
+	)
+
+	v := new(model.Notification)
+	dest := []interface{}{
+		&id,
+		&v.MerchantID,
+		&v.RequestID,
+		&v.Type,
+		&payload,
+		&v.NotificationURL,
+		&v.NotificationKey,
+		&v.AttemptNo,
+		&attemptedAt,
+		&v.Status,
+		&v.TraceParent,
+		&v.CreatedAt,
+		&v.UpdatedAt,
+		&sealed,
+		&v.PayloadFormat,
+		&v.Mode,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, mapError(err)
+		}
+		r.getLogger().Error("entity decode error", slog.Any("error", err))
+		return nil, errors.New("entity decode error")
+	}
+
+	var err error
+	if v.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		r.getLogger().Error("entity decode error", slog.Any("error", err))
+		return nil, errors.New("entity decode error")
+	}
+
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &v.Payload); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+			return nil, errors.New("entity unmarshal error")
+		}
+	}
+
+	if v.Sealed, err = unmarshalSealed(sealed); err != nil {
+		r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+		return nil, errors.New("entity unmarshal error")
+	}
+
+	if attemptedAt.Valid {
+		t := attemptedAt.Time.UTC()
+		v.AttemptedAt = &t
+	}
+	v.CreatedAt = v.CreatedAt.UTC()
+	v.UpdatedAt = v.UpdatedAt.UTC()
+
+	return v, nil
+}
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const notificationAttemptColumns = `id, notification_id, merchant_id, attempt_no, status, status_code, error, sent_at,
+	trace_parent, created_at, updated_at, request_body, sealed`
+
+// FindLastNotificationAttempt :
+func (r Repository) FindLastNotificationAttempt(notificationID primitive.ObjectID) (*model.NotificationAttempt, error) {
+	return r.scanNotificationAttempt(r.q.QueryRowContext(
+		r.getContext(),
+		`SELECT `+notificationAttemptColumns+` FROM notification_attempt
+		WHERE notification_id = $1
+		ORDER BY attempt_no DESC
+		LIMIT 1`,
+		notificationID.Hex(),
+	))
+}
+
+// UpsertNotificationAttempt :
+func (r Repository) UpsertNotificationAttempt(att *model.NotificationAttempt) error {
+	sealed, err := marshalSealed(att.Sealed)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.q.ExecContext(
+		r.getContext(),
+		`INSERT INTO notification_attempt (`+notificationAttemptColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE SET
+			notification_id = EXCLUDED.notification_id,
+			merchant_id = EXCLUDED.merchant_id,
+			attempt_no = EXCLUDED.attempt_no,
+			status = EXCLUDED.status,
+			status_code = EXCLUDED.status_code,
+			error = EXCLUDED.error,
+			sent_at = EXCLUDED.sent_at,
+			trace_parent = COALESCE(NULLIF(EXCLUDED.trace_parent, ''), notification_attempt.trace_parent),
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at,
+			request_body = EXCLUDED.request_body,
+			sealed = COALESCE(EXCLUDED.sealed, notification_attempt.sealed)`,
+		att.ID.Hex(),
+		att.NotificationID.Hex(),
+		att.MerchantID,
+		att.AttemptNo,
+		att.Status,
+		att.StatusCode,
+		att.Error,
+		att.SentAt,
+		att.TraceParent,
+		att.CreatedAt,
+		att.UpdatedAt,
+		att.RequestBody,
+		sealed,
+	)
+	return mapError(err)
+}
+
+// FindStuckNotificationAttempts : attempts still pending after the cutoff, their outcome was never recorded
+func (r Repository) FindStuckNotificationAttempts(cutoff time.Time, cursor string) ([]*model.NotificationAttempt, string, error) {
+	currentSkip, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := r.q.QueryContext(
+		r.getContext(),
+		`SELECT `+notificationAttemptColumns+` FROM notification_attempt
+		WHERE status = $1 AND updated_at <= $2
+		ORDER BY updated_at
+		LIMIT $3 OFFSET $4`,
+		types.NotificationStatusPending, cutoff, defaultLimit+1, currentSkip,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	attempts := make([]*model.NotificationAttempt, 0)
+	for rows.Next() {
+		attempt, err := r.scanNotificationAttempt(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(attempts) > defaultLimit {
+		return attempts[:len(attempts)-1], encodeCursor(currentSkip + defaultLimit), nil
+	}
+
+	return attempts, "", nil
+}
+
+func (r Repository) scanNotificationAttempt(row scanner) (*model.NotificationAttempt, error) {
+	var (
+		id             string
+		notificationID string
+		attemptErr     sql.NullString
+		sentAt         sql.NullTime
+		sealed         []byte
+	)
+
+	v := new(model.NotificationAttempt)
+	if err := row.Scan(
+		&id,
+		&notificationID,
+		&v.MerchantID,
+		&v.AttemptNo,
+		&v.Status,
+		&v.StatusCode,
+		&attemptErr,
+		&sentAt,
+		&v.TraceParent,
+		&v.CreatedAt,
+		&v.UpdatedAt,
+		&v.RequestBody,
+		&sealed,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, mapError(err)
+		}
+		r.getLogger().Error("entity decode error", slog.Any("error", err))
+		return nil, errors.New("entity decode error")
+	}
+
+	var err error
+	if v.ID, err = primitive.ObjectIDFromHex(id); err == nil {
+		v.NotificationID, err = primitive.ObjectIDFromHex(notificationID)
+	}
+	if err != nil {
+		r.getLogger().Error("entity decode error", slog.Any("error", err))
+		return nil, errors.New("entity decode error")
+	}
+
+	if v.Sealed, err = unmarshalSealed(sealed); err != nil {
+		r.getLogger().Error("entity decode error", slog.Any("error", err))
+		return nil, errors.New("entity decode error")
+	}
+	if attemptErr.Valid {
+		v.Error = &attemptErr.String
+	}
+	if sentAt.Valid {
+		t := sentAt.Time.UTC()
+		v.SentAt = &t
+	}
+	v.CreatedAt = v.CreatedAt.UTC()
+	v.UpdatedAt = v.UpdatedAt.UTC()
+
+	return v, nil
+}
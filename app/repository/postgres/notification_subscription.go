@@ -0,0 +1,406 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/types"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const notificationSubscriptionColumns = `merchant_id, type, notification_url, notification_key, acceptable_status_codes,
+	created_at, updated_at, sealed, payload_format, http_options, client_certificate_id, auth,
+	method, body_encoding, content_type, gzip, transform, filters, status,
+	consecutive_failures, failing_since, last_success_at, disabled_at, disabled_reason, verified_at, mode`
+
+// FindNotificationSubscriptions :
+func (r Repository) FindNotificationSubscriptions(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.NotificationSubscription, string, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	currentSkip, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := r.q.QueryContext(
+		r.getContext(),
+		`SELECT `+notificationSubscriptionColumns+` FROM notification_subscription
+		WHERE merchant_id = $1 AND mode = $2
+		ORDER BY type
+		LIMIT $3 OFFSET $4`,
+		merchantID, mode, limit+1, currentSkip,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	notificationSubs := make([]*model.NotificationSubscription, 0)
+	for rows.Next() {
+		notificationSub, err := r.scanNotificationSubscription(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		notificationSubs = append(notificationSubs, notificationSub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(notificationSubs) > int(limit) {
+		return notificationSubs[:len(notificationSubs)-1], encodeCursor(currentSkip + limit), nil
+	}
+
+	return notificationSubs, "", nil
+}
+
+// FindNotificationSubscription :
+func (r Repository) FindNotificationSubscription(id model.SubscriptionKey) (*model.NotificationSubscription, error) {
+	return r.scanNotificationSubscription(r.q.QueryRowContext(
+		r.getContext(),
+		`SELECT `+notificationSubscriptionColumns+` FROM notification_subscription
+		WHERE merchant_id = $1 AND type = $2 AND mode = $3`,
+		id.MerchantID, id.Type, id.Mode,
+	))
+}
+
+// UpsertNotificationSubscription :
+func (r Repository) UpsertNotificationSubscription(sub *model.NotificationSubscription) error {
+	codes := make([]int64, len(sub.AcceptableStatusCodes))
+	for i, code := range sub.AcceptableStatusCodes {
+		codes[i] = int64(code)
+	}
+
+	sealed, err := marshalSealed(sub.Sealed)
+	if err != nil {
+		r.getLogger().Error("entity marshal error", slog.Any("error", err))
+		return errors.New("entity marshal error")
+	}
+
+	var httpOptions interface{}
+	if sub.HTTPOptions != nil {
+		data, err := json.Marshal(sub.HTTPOptions)
+		if err != nil {
+			r.getLogger().Error("entity marshal error", slog.Any("error", err))
+			return errors.New("entity marshal error")
+		}
+		httpOptions = string(data) // []byte would be sent as bytea
+	}
+
+	var auth interface{}
+	if sub.Auth != nil {
+		data, err := json.Marshal(sub.Auth)
+		if err != nil {
+			r.getLogger().Error("entity marshal error", slog.Any("error", err))
+			return errors.New("entity marshal error")
+		}
+		auth = string(data)
+	}
+
+	var transform interface{}
+	if sub.Transform != nil {
+		data, err := json.Marshal(sub.Transform)
+		if err != nil {
+			r.getLogger().Error("entity marshal error", slog.Any("error", err))
+			return errors.New("entity marshal error")
+		}
+		transform = string(data)
+	}
+
+	var filters interface{}
+	if len(sub.Filters) > 0 {
+		data, err := json.Marshal(sub.Filters)
+		if err != nil {
+			r.getLogger().Error("entity marshal error", slog.Any("error", err))
+			return errors.New("entity marshal error")
+		}
+		filters = string(data)
+	}
+
+	var clientCertificateID interface{}
+	if sub.ClientCertificateID != nil {
+		clientCertificateID = sub.ClientCertificateID.Hex()
+	}
+
+	_, err = r.q.ExecContext(
+		r.getContext(),
+		`INSERT INTO notification_subscription (`+notificationSubscriptionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25, $26)
+		ON CONFLICT (merchant_id, type, mode) DO UPDATE SET
+			notification_url = EXCLUDED.notification_url,
+			notification_key = EXCLUDED.notification_key,
+			acceptable_status_codes = EXCLUDED.acceptable_status_codes,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at,
+			sealed = COALESCE(EXCLUDED.sealed, notification_subscription.sealed),
+			payload_format = EXCLUDED.payload_format,
+			http_options = EXCLUDED.http_options,
+			client_certificate_id = EXCLUDED.client_certificate_id,
+			auth = EXCLUDED.auth,
+			method = EXCLUDED.method,
+			body_encoding = EXCLUDED.body_encoding,
+			content_type = EXCLUDED.content_type,
+			gzip = EXCLUDED.gzip,
+			transform = EXCLUDED.transform,
+			filters = EXCLUDED.filters,
+			status = EXCLUDED.status,
+			consecutive_failures = EXCLUDED.consecutive_failures,
+			failing_since = EXCLUDED.failing_since,
+			last_success_at = EXCLUDED.last_success_at,
+			disabled_at = EXCLUDED.disabled_at,
+			disabled_reason = EXCLUDED.disabled_reason,
+			verified_at = EXCLUDED.verified_at`,
+		sub.ID.MerchantID,
+		sub.ID.Type,
+		sub.NotificationURL,
+		sub.NotificationKey,
+		pq.Array(codes),
+		sub.CreatedAt,
+		sub.UpdatedAt,
+		sealed,
+		sub.PayloadFormat,
+		httpOptions,
+		clientCertificateID,
+		auth,
+		sub.Method,
+		sub.BodyEncoding,
+		sub.ContentType,
+		sub.Gzip,
+		transform,
+		filters,
+		sub.Status,
+		sub.ConsecutiveFailures,
+		sub.FailingSince,
+		sub.LastSuccessAt,
+		sub.DisabledAt,
+		sub.DisabledReason,
+		sub.VerifiedAt,
+		sub.ID.Mode,
+	)
+	return mapError(err)
+}
+
+// DeleteNotificationSubscription :
+func (r Repository) DeleteNotificationSubscription(id model.SubscriptionKey) error {
+	_, err := r.q.ExecContext(
+		r.getContext(),
+		`DELETE FROM notification_subscription WHERE merchant_id = $1 AND type = $2 AND mode = $3`,
+		id.MerchantID, id.Type, id.Mode,
+	)
+	return err
+}
+
+// UpdateNotificationSubscriptionStatus :
+func (r Repository) UpdateNotificationSubscriptionStatus(id model.SubscriptionKey, status types.SubscriptionStatus) error {
+	result, err := r.q.ExecContext(
+		r.getContext(),
+		`UPDATE notification_subscription SET status = $3, updated_at = $4,
+			consecutive_failures = CASE WHEN $5 THEN 0 ELSE consecutive_failures END,
+			failing_since = CASE WHEN $5 THEN NULL ELSE failing_since END,
+			disabled_at = CASE WHEN $5 THEN NULL ELSE disabled_at END,
+			disabled_reason = CASE WHEN $5 THEN '' ELSE disabled_reason END
+		WHERE merchant_id = $1 AND type = $2 AND mode = $6`,
+		id.MerchantID, id.Type, status, time.Now().UTC(), status == types.SubscriptionStatusActive, id.Mode,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// RecordNotificationSubscriptionDelivery :
+func (r Repository) RecordNotificationSubscriptionDelivery(id model.SubscriptionKey, succeeded bool, at time.Time) (*model.NotificationSubscription, error) {
+	query := `UPDATE notification_subscription SET
+			consecutive_failures = consecutive_failures + 1,
+			failing_since = LEAST(failing_since, $3)
+		WHERE merchant_id = $1 AND type = $2 AND mode = $4
+		RETURNING ` + notificationSubscriptionColumns
+	if succeeded {
+		query = `UPDATE notification_subscription SET
+			consecutive_failures = 0,
+			failing_since = NULL,
+			last_success_at = $3
+		WHERE merchant_id = $1 AND type = $2 AND mode = $4
+		RETURNING ` + notificationSubscriptionColumns
+	}
+
+	return r.scanNotificationSubscription(r.q.QueryRowContext(r.getContext(), query, id.MerchantID, id.Type, at, id.Mode))
+}
+
+// VerifyNotificationSubscription :
+func (r Repository) VerifyNotificationSubscription(id model.SubscriptionKey, url string, at time.Time) (bool, error) {
+	result, err := r.q.ExecContext(
+		r.getContext(),
+		`UPDATE notification_subscription SET status = $5, verified_at = $6, updated_at = $6
+		WHERE merchant_id = $1 AND type = $2 AND mode = $7 AND notification_url = $3 AND status = $4`,
+		id.MerchantID, id.Type, url, types.SubscriptionStatusPendingVerification, types.SubscriptionStatusActive, at, id.Mode,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// AutoDisableNotificationSubscription :
+func (r Repository) AutoDisableNotificationSubscription(id model.SubscriptionKey, reason string, at time.Time) (bool, error) {
+	result, err := r.q.ExecContext(
+		r.getContext(),
+		`UPDATE notification_subscription SET status = $3, disabled_at = $4, disabled_reason = $5, updated_at = $4
+		WHERE merchant_id = $1 AND type = $2 AND mode = $7 AND status IN ('', $6)`,
+		id.MerchantID, id.Type, types.SubscriptionStatusDisabled, at, reason, types.SubscriptionStatusActive, id.Mode,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r Repository) scanNotificationSubscription(row scanner) (*model.NotificationSubscription, error) {
+	var (
+		codes               []int64
+		sealed              []byte
+		httpOptions         []byte
+		clientCertificateID sql.NullString
+		auth                []byte
+		transform           []byte
+		filters             []byte
+		failingSince        sql.NullTime
+		lastSuccessAt       sql.NullTime
+		disabledAt          sql.NullTime
+		verifiedAt          sql.NullTime
+	)
+
+	v := new(model.NotificationSubscription)
+	if err := row.Scan(
+		&v.ID.MerchantID,
+		&v.ID.Type,
+		&v.NotificationURL,
+		&v.NotificationKey,
+		pq.Array(&codes),
+		&v.CreatedAt,
+		&v.UpdatedAt,
+		&sealed,
+		&v.PayloadFormat,
+		&httpOptions,
+		&clientCertificateID,
+		&auth,
+		&v.Method,
+		&v.BodyEncoding,
+		&v.ContentType,
+		&v.Gzip,
+		&transform,
+		&filters,
+		&v.Status,
+		&v.ConsecutiveFailures,
+		&failingSince,
+		&lastSuccessAt,
+		&disabledAt,
+		&v.DisabledReason,
+		&verifiedAt,
+		&v.ID.Mode,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, mapError(err)
+		}
+		r.getLogger().Error("entity decode error", slog.Any("error", err))
+		return nil, errors.New("entity decode error")
+	}
+
+	var err error
+	if v.Sealed, err = unmarshalSealed(sealed); err != nil {
+		r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+		return nil, errors.New("entity unmarshal error")
+	}
+
+	if len(httpOptions) > 0 {
+		v.HTTPOptions = new(model.HTTPOptions)
+		if err := json.Unmarshal(httpOptions, v.HTTPOptions); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+			return nil, errors.New("entity unmarshal error")
+		}
+	}
+
+	if len(auth) > 0 {
+		v.Auth = new(model.SubscriptionAuth)
+		if err := json.Unmarshal(auth, v.Auth); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+			return nil, errors.New("entity unmarshal error")
+		}
+	}
+
+	if len(transform) > 0 {
+		v.Transform = new(model.PayloadTransform)
+		if err := json.Unmarshal(transform, v.Transform); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+			return nil, errors.New("entity unmarshal error")
+		}
+	}
+
+	if len(filters) > 0 {
+		if err := json.Unmarshal(filters, &v.Filters); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+			return nil, errors.New("entity unmarshal error")
+		}
+	}
+
+	if clientCertificateID.Valid {
+		id, err := primitive.ObjectIDFromHex(clientCertificateID.String)
+		if err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, errors.New("entity decode error")
+		}
+		v.ClientCertificateID = &id
+	}
+
+	for _, each := range []struct {
+		src sql.NullTime
+		dst **time.Time
+	}{
+		{failingSince, &v.FailingSince},
+		{lastSuccessAt, &v.LastSuccessAt},
+		{disabledAt, &v.DisabledAt},
+		{verifiedAt, &v.VerifiedAt},
+	} {
+		if each.src.Valid {
+			t := each.src.Time.UTC()
+			*each.dst = &t
+		}
+	}
+
+	v.AcceptableStatusCodes = make([]int, len(codes))
+	for i, code := range codes {
+		v.AcceptableStatusCodes[i] = int(code)
+	}
+	v.CreatedAt = v.CreatedAt.UTC()
+	v.UpdatedAt = v.UpdatedAt.UTC()
+
+	return v, nil
+}
@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	xlogger "xenotification/app/kit/logger"
+	"xenotification/app/repository"
+
+	"github.com/lib/pq"
+)
+
+const defaultLimit = 50
+
+// Postgres error codes which are safe to retry the whole transaction on
+const (
+	errCodeSerializationFailure = "40001"
+	errCodeDeadlockDetected     = "40P01"
+	errCodeUniqueViolation      = "23505"
+)
+
+const transactionRetries = 3
+
+// querier : the part of *sql.DB and *sql.Tx the queries need
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Repository : the PostgreSQL backed repository
+type Repository struct {
+	db     *sql.DB
+	q      querier
+	ctx    context.Context
+	logger *slog.Logger
+}
+
+var _ repository.Repository = (*Repository)(nil)
+
+// New :
+func New(ctx context.Context, db *sql.DB, logger *slog.Logger) *Repository {
+	return &Repository{
+		db:     db,
+		q:      db,
+		ctx:    ctx,
+		logger: logger,
+	}
+}
+
+// WithContext :
+func (r Repository) WithContext(ctx context.Context) repository.Repository {
+	r.ctx = ctx
+	return &r
+}
+
+// withTransaction : runs fn in a transaction, retrying the whole of it on serialization failures and
+// deadlocks, so fn must be safe to run more than once
+func (r Repository) withTransaction(fn func(tx *Repository) error) error {
+	var err error
+	for i := 0; i < transactionRetries; i++ {
+		if err = r.runTransaction(fn); !isRetryable(err) {
+			return err
+		}
+		r.getLogger().Warn("retrying transaction", slog.Int("attempt", i+1), slog.Any("error", err))
+	}
+	return err
+}
+
+func (r Repository) runTransaction(fn func(tx *Repository) error) error {
+	sqlTx, err := r.db.BeginTx(r.getContext(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return err
+	}
+
+	tx := r
+	tx.q = sqlTx
+	if err := fn(&tx); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+
+	return sqlTx.Commit()
+}
+
+func (r Repository) getLogger() *slog.Logger {
+	return xlogger.FromContext(r.getContext(), r.logger)
+}
+
+func (r Repository) getContext() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// mapError : translates driver errors into the ones the repository package exposes
+func mapError(err error) error {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return repository.ErrNotFound
+	case errors.As(err, &pqErr) && pqErr.Code == errCodeUniqueViolation:
+		return repository.ErrDuplicate
+	}
+	return err
+}
+
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == errCodeSerializationFailure || pqErr.Code == errCodeDeadlockDetected
+}
+
+// decodeCursor : cursors are the same hex encoded offsets the MongoDB repository hands out
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	data, err := hex.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+func encodeCursor(skip int64) string {
+	return hex.EncodeToString([]byte(fmt.Sprintf("%d", skip)))
+}
@@ -0,0 +1,234 @@
+package postgres
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"xenotification/app/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindNotificationsToReseal : the smallest IDs of both tables, as notifications move to the archive keeping theirs
+func (r Repository) FindNotificationsToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.Notification, error) {
+	notifications, err := r.queryNotifications(
+		`SELECT `+notificationColumns+` FROM notification
+		WHERE id > $2 AND sealed->>'keyId' IS DISTINCT FROM $1
+		ORDER BY id
+		LIMIT $3`,
+		keyID, after.Hex(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.q.QueryContext(
+		r.getContext(),
+		`SELECT `+notificationColumns+`, archived_at FROM notification_archive
+		WHERE id > $2 AND sealed->>'keyId' IS DISTINCT FROM $1
+		ORDER BY id
+		LIMIT $3`,
+		keyID, after.Hex(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var archivedAt time.Time
+		notification, err := r.scanNotification(rows, &archivedAt)
+		if err != nil {
+			return nil, err
+		}
+		archivedAt = archivedAt.UTC()
+		notification.ArchivedAt = &archivedAt
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].ID.Hex() < notifications[j].ID.Hex()
+	})
+	if int64(len(notifications)) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+// ResealNotification :
+func (r Repository) ResealNotification(notification *model.Notification, sealed *model.Sealed) error {
+	data, err := marshalSealed(sealed)
+	if err != nil {
+		return err
+	}
+
+	table := "notification"
+	if notification.ArchivedAt != nil {
+		table = "notification_archive"
+	}
+
+	_, err = r.q.ExecContext(
+		r.getContext(),
+		`UPDATE `+table+` SET sealed = $2, payload = NULL, notification_key = '' WHERE id = $1`,
+		notification.ID.Hex(), data,
+	)
+	return err
+}
+
+// FindNotificationSubscriptionsToReseal :
+func (r Repository) FindNotificationSubscriptionsToReseal(keyID string, after model.SubscriptionKey, limit int64) ([]*model.NotificationSubscription, error) {
+	rows, err := r.q.QueryContext(
+		r.getContext(),
+		`SELECT `+notificationSubscriptionColumns+` FROM notification_subscription
+		WHERE (merchant_id, type, mode) > ($2, $3, $4) AND sealed->>'keyId' IS DISTINCT FROM $1
+		ORDER BY merchant_id, type, mode
+		LIMIT $5`,
+		keyID, after.MerchantID, after.Type, after.Mode, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notificationSubs := make([]*model.NotificationSubscription, 0)
+	for rows.Next() {
+		notificationSub, err := r.scanNotificationSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		notificationSubs = append(notificationSubs, notificationSub)
+	}
+
+	return notificationSubs, rows.Err()
+}
+
+// ResealNotificationSubscription :
+func (r Repository) ResealNotificationSubscription(id model.SubscriptionKey, sealed *model.Sealed) error {
+	data, err := marshalSealed(sealed)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.q.ExecContext(
+		r.getContext(),
+		`UPDATE notification_subscription SET sealed = $3, notification_key = '', auth = NULL
+		WHERE merchant_id = $1 AND type = $2 AND mode = $4`,
+		id.MerchantID, id.Type, data, id.Mode,
+	)
+	return err
+}
+
+// FindNotificationAttemptsToReseal : only attempts that recorded a request body are sealed
+func (r Repository) FindNotificationAttemptsToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.NotificationAttempt, error) {
+	attempts := make([]*model.NotificationAttempt, 0)
+	for _, table := range []string{"notification_attempt", "notification_attempt_archive"} {
+		rows, err := r.q.QueryContext(
+			r.getContext(),
+			`SELECT `+notificationAttemptColumns+` FROM `+table+`
+			WHERE id > $2 AND ((sealed IS NOT NULL AND sealed->>'keyId' IS DISTINCT FROM $1) OR request_body <> '')
+			ORDER BY id
+			LIMIT $3`,
+			keyID, after.Hex(), limit,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			attempt, err := r.scanNotificationAttempt(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			attempts = append(attempts, attempt)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].ID.Hex() < attempts[j].ID.Hex()
+	})
+	if int64(len(attempts)) > limit {
+		attempts = attempts[:limit]
+	}
+	return attempts, nil
+}
+
+// ResealNotificationAttempt :
+func (r Repository) ResealNotificationAttempt(id primitive.ObjectID, sealed *model.Sealed) error {
+	data, err := marshalSealed(sealed)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"notification_attempt", "notification_attempt_archive"} {
+		if _, err := r.q.ExecContext(
+			r.getContext(),
+			`UPDATE `+table+` SET sealed = $2, request_body = '' WHERE id = $1`,
+			id.Hex(), data,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindClientCertificatesToReseal :
+func (r Repository) FindClientCertificatesToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.ClientCertificate, error) {
+	return r.queryClientCertificates(
+		`SELECT `+clientCertificateColumns+` FROM client_certificate
+		WHERE id > $2 AND sealed->>'keyId' IS DISTINCT FROM $1
+		ORDER BY id
+		LIMIT $3`,
+		keyID, after.Hex(), limit,
+	)
+}
+
+// ResealClientCertificate :
+func (r Repository) ResealClientCertificate(id primitive.ObjectID, sealed *model.Sealed) error {
+	data, err := marshalSealed(sealed)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.q.ExecContext(
+		r.getContext(),
+		`UPDATE client_certificate SET sealed = $2, private_key = '' WHERE id = $1`,
+		id.Hex(), data,
+	)
+	return err
+}
+
+// marshalSealed : a nil Sealed is stored as NULL, the upserts then keep the current value
+func marshalSealed(sealed *model.Sealed) (interface{}, error) {
+	if sealed == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil // []byte would be sent as bytea
+}
+
+func unmarshalSealed(data []byte) (*model.Sealed, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	sealed := new(model.Sealed)
+	if err := json.Unmarshal(data, sealed); err != nil {
+		return nil, err
+	}
+	return sealed, nil
+}
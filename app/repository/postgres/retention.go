@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"time"
+
+	"xenotification/app/model"
+	"xenotification/app/repository"
+	"xenotification/app/types"
+
+	"github.com/lib/pq"
+)
+
+// scopeCondition : matches merchant_id against the scope, its arrays are bound to $1 and $2, and the mode bound
+// to $3. A nil slice is bound as NULL, hence the COALESCEs.
+const scopeCondition = `(COALESCE(cardinality($1::text[]), 0) = 0 OR merchant_id = ANY($1::text[]))
+	AND NOT merchant_id = ANY(COALESCE($2::text[], '{}'))
+	AND mode = $3`
+
+// ArchiveNotifications :
+func (r Repository) ArchiveNotifications(scope repository.MerchantScope, before time.Time, retryAttempts uint, limit int64) (int64, error) {
+	var archived int64
+
+	err := r.withTransaction(func(tx *Repository) error {
+		ctx := tx.getContext()
+
+		rows, err := tx.q.QueryContext(ctx,
+			`SELECT id FROM notification
+			WHERE `+scopeCondition+` AND (status = ANY($4) OR (status = $5 AND attempt_no >= $6)) AND updated_at <= $7
+			ORDER BY updated_at
+			LIMIT $8
+			FOR UPDATE SKIP LOCKED`,
+			pq.Array(scope.MerchantIDs), pq.Array(scope.ExcludeMerchantIDs), scope.Mode,
+			pq.Array(archivableStatuses()), types.NotificationStatusFailed, retryAttempts, before, limit,
+		)
+		if err != nil {
+			return err
+		}
+
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		archived = int64(len(ids))
+		if archived == 0 {
+			return nil
+		}
+
+		now := time.Now().UTC()
+
+		if _, err := tx.q.ExecContext(ctx,
+			`INSERT INTO notification_attempt_archive (`+notificationAttemptColumns+`, archived_at)
+			SELECT `+notificationAttemptColumns+`, $2 FROM notification_attempt WHERE notification_id = ANY($1)
+			ON CONFLICT (id) DO NOTHING`,
+			pq.Array(ids), now,
+		); err != nil {
+			return err
+		}
+
+		if _, err := tx.q.ExecContext(ctx,
+			`INSERT INTO notification_archive (`+notificationColumns+`, archived_at)
+			SELECT `+notificationColumns+`, $2 FROM notification WHERE id = ANY($1)
+			ON CONFLICT (id) DO NOTHING`,
+			pq.Array(ids), now,
+		); err != nil {
+			return err
+		}
+
+		// Attempts are removed by the cascade
+		_, err = tx.q.ExecContext(ctx, `DELETE FROM notification WHERE id = ANY($1)`, pq.Array(ids))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return archived, nil
+}
+
+// PurgeArchivedNotifications :
+func (r Repository) PurgeArchivedNotifications(scope repository.MerchantScope, before time.Time, limit int64) (int64, error) {
+	var purged int64
+
+	err := r.withTransaction(func(tx *Repository) error {
+		ctx := tx.getContext()
+
+		rows, err := tx.q.QueryContext(ctx,
+			`DELETE FROM notification_archive
+			WHERE id IN (
+				SELECT id FROM notification_archive
+				WHERE `+scopeCondition+` AND updated_at <= $4
+				ORDER BY updated_at
+				LIMIT $5
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id`,
+			pq.Array(scope.MerchantIDs), pq.Array(scope.ExcludeMerchantIDs), scope.Mode, before, limit,
+		)
+		if err != nil {
+			return err
+		}
+
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		purged = int64(len(ids))
+		if purged == 0 {
+			return nil
+		}
+
+		_, err = tx.q.ExecContext(ctx, `DELETE FROM notification_attempt_archive WHERE notification_id = ANY($1)`, pq.Array(ids))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// FindArchivedNotifications :
+func (r Repository) FindArchivedNotifications(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	currentSkip, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := r.q.QueryContext(
+		r.getContext(),
+		`SELECT `+notificationColumns+`, archived_at FROM notification_archive
+		WHERE merchant_id = $1 AND mode = $2
+		ORDER BY updated_at DESC
+		LIMIT $3 OFFSET $4`,
+		merchantID, mode, limit+1, currentSkip,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	notifications := make([]*model.Notification, 0)
+	for rows.Next() {
+		var archivedAt time.Time
+		notification, err := r.scanNotification(rows, &archivedAt)
+		if err != nil {
+			return nil, "", err
+		}
+		archivedAt = archivedAt.UTC()
+		notification.ArchivedAt = &archivedAt
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(notifications) > int(limit) {
+		return notifications[:len(notifications)-1], encodeCursor(currentSkip + limit), nil
+	}
+
+	return notifications, "", nil
+}
+
+// FindArchivedNotification :
+func (r Repository) FindArchivedNotification(typ string, requestID string, mode types.Mode) (*model.Notification, error) {
+	var archivedAt time.Time
+	notification, err := r.scanNotification(r.q.QueryRowContext(
+		r.getContext(),
+		`SELECT `+notificationColumns+`, archived_at FROM notification_archive WHERE type = $1 AND request_id = $2 AND mode = $3`,
+		typ, requestID, mode,
+	), &archivedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	archivedAt = archivedAt.UTC()
+	notification.ArchivedAt = &archivedAt
+	return notification, nil
+}
+
+func archivableStatuses() []string {
+	statuses := make([]string, len(types.ArchivableNotificationStatuses))
+	for i, each := range types.ArchivableNotificationStatuses {
+		statuses[i] = string(each)
+	}
+	return statuses
+}
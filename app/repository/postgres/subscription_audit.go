@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const subscriptionAuditColumns = `id, merchant_id, type, action, actor, source_ip, changes, created_at, mode`
+
+// CreateSubscriptionAudit :
+func (r Repository) CreateSubscriptionAudit(audit *model.SubscriptionAudit) error {
+	changes := audit.Changes
+	if changes == nil {
+		changes = []model.SubscriptionChange{}
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		r.getLogger().Error("entity marshal error", slog.Any("error", err))
+		return errors.New("entity marshal error")
+	}
+
+	_, err = r.q.ExecContext(
+		r.getContext(),
+		`INSERT INTO subscription_audit (`+subscriptionAuditColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		audit.ID.Hex(),
+		audit.MerchantID,
+		audit.Type,
+		audit.Action,
+		audit.Actor,
+		audit.SourceIP,
+		string(data), // []byte would be sent as bytea
+		audit.CreatedAt,
+		audit.Mode,
+	)
+	return mapError(err)
+}
+
+// FindSubscriptionAudits :
+func (r Repository) FindSubscriptionAudits(merchantID string, mode types.Mode, typ string, cursor string, limit int64) ([]*model.SubscriptionAudit, string, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	currentSkip, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := r.q.QueryContext(
+		r.getContext(),
+		`SELECT `+subscriptionAuditColumns+` FROM subscription_audit
+		WHERE merchant_id = $1 AND mode = $2 AND ($3 = '' OR type = $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4 OFFSET $5`,
+		merchantID, mode, typ, limit+1, currentSkip,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	audits := make([]*model.SubscriptionAudit, 0)
+	for rows.Next() {
+		var (
+			id      string
+			changes []byte
+		)
+
+		audit := new(model.SubscriptionAudit)
+		if err := rows.Scan(
+			&id,
+			&audit.MerchantID,
+			&audit.Type,
+			&audit.Action,
+			&audit.Actor,
+			&audit.SourceIP,
+			&changes,
+			&audit.CreatedAt,
+			&audit.Mode,
+		); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, "", errors.New("entity decode error")
+		}
+
+		if audit.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, "", errors.New("entity decode error")
+		}
+		if err := json.Unmarshal(changes, &audit.Changes); err != nil {
+			r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+			return nil, "", errors.New("entity unmarshal error")
+		}
+		audit.CreatedAt = audit.CreatedAt.UTC()
+
+		audits = append(audits, audit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(audits) > int(limit) {
+		return audits[:len(audits)-1], encodeCursor(currentSkip + limit), nil
+	}
+
+	return audits, "", nil
+}
@@ -2,36 +2,228 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"time"
 	"xenotification/app/env"
+	xlogger "xenotification/app/kit/logger"
 	"xenotification/app/model"
+	"xenotification/app/types"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
-// Repository :
-type Repository struct {
-	db *mongo.Database
+// ErrNotFound : returned by the Find methods when nothing matches
+var ErrNotFound = mongo.ErrNoDocuments
+
+// ErrDuplicate : returned when a write breaks a uniqueness rule, e.g. a second notification for the same type and request ID
+var ErrDuplicate = errors.New("entity already exists")
+
+// Repository : persistence of notifications, their attempts and subscriptions
+type Repository interface {
+	// WithContext : returns a copy of the repository which runs its queries under ctx
+	WithContext(ctx context.Context) Repository
+	// Migrate : brings the schema and indexes up to date, it is safe to run on every start
+	Migrate() error
+
+	// FindNotifications : the merchant's notifications in the mode, live when empty like every mode below
+	FindNotifications(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error)
+	FindNotificationByID(id string, merchantID string) (*model.Notification, error)
+	// FindNotification : request IDs are unique per type within a mode
+	FindNotification(typ string, requestID string, mode types.Mode) (*model.Notification, error)
+	UpsertNotification(notification *model.Notification) error
+	CreateNotification(notification *model.Notification) error
+	SaveNotificationAttemptResult(notification *model.Notification, attempt *model.NotificationAttempt) error
+	// FindRetryNotifications : the failed notifications due for a retry under the policy
+	FindRetryNotifications(policy RetryPolicy, cursor string) ([]*model.Notification, string, error)
+	FindStuckNotifications(cutoff time.Time, cursor string) ([]*model.Notification, string, error)
+	// FindHeldNotifications : up to limit notifications held for the subscription, oldest first
+	FindHeldNotifications(id model.SubscriptionKey, limit int64) ([]*model.Notification, error)
+	// FindHeldSubscriptionKeys : the subscriptions with notifications held
+	FindHeldSubscriptionKeys() ([]model.SubscriptionKey, error)
+
+	FindLastNotificationAttempt(notificationID primitive.ObjectID) (*model.NotificationAttempt, error)
+	UpsertNotificationAttempt(att *model.NotificationAttempt) error
+	FindStuckNotificationAttempts(cutoff time.Time, cursor string) ([]*model.NotificationAttempt, string, error)
+
+	// ArchiveNotifications : moves up to limit notifications last updated before the cutoff, with their attempts, to the archive.
+	// Those are the ones with an archivable status, and the failed ones which have had the retryAttempts the retry cron makes.
+	ArchiveNotifications(scope MerchantScope, before time.Time, retryAttempts uint, limit int64) (int64, error)
+	// PurgeArchivedNotifications : deletes up to limit archived notifications last updated before the cutoff, with their attempts
+	PurgeArchivedNotifications(scope MerchantScope, before time.Time, limit int64) (int64, error)
+	FindArchivedNotifications(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.Notification, string, error)
+	// FindArchivedNotification : like FindNotification, in the archive
+	FindArchivedNotification(typ string, requestID string, mode types.Mode) (*model.Notification, error)
+
+	FindNotificationSubscriptions(merchantID string, mode types.Mode, cursor string, limit int64) ([]*model.NotificationSubscription, string, error)
+	FindNotificationSubscription(id model.SubscriptionKey) (*model.NotificationSubscription, error)
+	UpsertNotificationSubscription(sub *model.NotificationSubscription) error
+	DeleteNotificationSubscription(id model.SubscriptionKey) error
+	// UpdateNotificationSubscriptionStatus : ErrNotFound when there is no such subscription. Activating it also
+	// clears its failure streak and why it was disabled
+	UpdateNotificationSubscriptionStatus(id model.SubscriptionKey, status types.SubscriptionStatus) error
+	// RecordNotificationSubscriptionDelivery : a success ends the failure streak, a failure extends it. Returns the
+	// subscription as updated, ErrNotFound when there is no such subscription
+	RecordNotificationSubscriptionDelivery(id model.SubscriptionKey, succeeded bool, at time.Time) (*model.NotificationSubscription, error)
+	// VerifyNotificationSubscription : activates the subscription if it is still pending verification of the same
+	// URL, reporting whether it did
+	VerifyNotificationSubscription(id model.SubscriptionKey, url string, at time.Time) (bool, error)
+	// AutoDisableNotificationSubscription : disables the subscription only while it is active, reporting whether it did
+	AutoDisableNotificationSubscription(id model.SubscriptionKey, reason string, at time.Time) (bool, error)
+
+	// CreateSubscriptionAudit : audit records are never updated nor deleted
+	CreateSubscriptionAudit(audit *model.SubscriptionAudit) error
+	// FindSubscriptionAudits : newest first, for all of the merchant's subscriptions in the mode when typ is empty
+	FindSubscriptionAudits(merchantID string, mode types.Mode, typ string, cursor string, limit int64) ([]*model.SubscriptionAudit, string, error)
+
+	FindClientCertificates(merchantID string) ([]*model.ClientCertificate, error)
+	FindClientCertificate(id primitive.ObjectID, merchantID string) (*model.ClientCertificate, error)
+	CreateClientCertificate(cert *model.ClientCertificate) error
+	DeleteClientCertificate(id primitive.ObjectID, merchantID string) error
+	// ClientCertificateInUse : whether any subscription presents the certificate
+	ClientCertificateInUse(id primitive.ObjectID) (bool, error)
+
+	// FindNotificationsToReseal : up to limit notifications, archived ones included, not sealed with keyID, in ID
+	// order after the given one. Those needing no resealing still match, so callers page with the last ID seen.
+	FindNotificationsToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.Notification, error)
+	// ResealNotification : replaces the sealed fields and drops any plaintext, leaving the rest of the notification as is
+	ResealNotification(notification *model.Notification, sealed *model.Sealed) error
+	// FindNotificationSubscriptionsToReseal : up to limit subscriptions not sealed with keyID, ordered by merchant ID,
+	// type and mode after the given key, the zero key starting from the first
+	FindNotificationSubscriptionsToReseal(keyID string, after model.SubscriptionKey, limit int64) ([]*model.NotificationSubscription, error)
+	// ResealNotificationSubscription :
+	ResealNotificationSubscription(id model.SubscriptionKey, sealed *model.Sealed) error
+	// FindNotificationAttemptsToReseal : up to limit attempts, archived ones included, with a request body not sealed with keyID,
+	// in ID order after the given one
+	FindNotificationAttemptsToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.NotificationAttempt, error)
+	// ResealNotificationAttempt : archived or not
+	ResealNotificationAttempt(id primitive.ObjectID, sealed *model.Sealed) error
+	// FindClientCertificatesToReseal : up to limit client certificates not sealed with keyID, in ID order after the given one
+	FindClientCertificatesToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.ClientCertificate, error)
+	// ResealClientCertificate :
+	ResealClientCertificate(id primitive.ObjectID, sealed *model.Sealed) error
+}
+
+// MerchantScope : limits a retention run to the Mode's notifications of the listed merchants, or of every
+// merchant but the excluded ones when MerchantIDs is empty
+type MerchantScope struct {
+	MerchantIDs        []string
+	ExcludeMerchantIDs []string
+	Mode               types.Mode
+}
+
+// Includes :
+func (s MerchantScope) Includes(merchantID string) bool {
+	for _, each := range s.ExcludeMerchantIDs {
+		if each == merchantID {
+			return false
+		}
+	}
+	if len(s.MerchantIDs) == 0 {
+		return true
+	}
+	for _, each := range s.MerchantIDs {
+		if each == merchantID {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryPolicy : the Mode's failed notifications are retried until they have had Attempts attempts, once Interval
+// has passed since the last one
+type RetryPolicy struct {
+	Mode     types.Mode
+	Attempts uint
+	Interval time.Duration
+}
+
+// modeQuery : matches records of the mode, live ones are stored without a mode
+func modeQuery(mode types.Mode) interface{} {
+	if mode == "" {
+		return nil
+	}
+	return mode
+}
+
+// FirstAttemptStatus : the status CreateNotification gives the first attempt. It is held along with a held
+// notification, a pending one would be taken for a stuck delivery.
+func FirstAttemptStatus(notification *model.Notification) types.NotificationStatus {
+	if notification.Status == types.NotificationStatusHeld {
+		return types.NotificationStatusHeld
+	}
+	return types.NotificationStatusPending
+}
+
+// Mongo : the MongoDB backed repository
+type Mongo struct {
+	db     *mongo.Database
+	ctx    context.Context
+	logger *slog.Logger
 }
 
 // New :
-func New(ctx context.Context, mongo *mongo.Client) *Repository {
-	return &Repository{
-		db: mongo.Database(env.Config.Mongo.DBName),
+func New(ctx context.Context, mongo *mongo.Client, logger *slog.Logger) Repository {
+	return &Mongo{
+		db:     mongo.Database(env.Config.Mongo.DBName),
+		ctx:    ctx,
+		logger: logger,
+	}
+}
+
+// WithContext :
+func (r Mongo) WithContext(ctx context.Context) Repository {
+	r.ctx = ctx
+	return &r
+}
+
+// withTransaction : runs fn in a transaction. The driver retries fn and the commit on transient errors,
+// so fn must be safe to run more than once.
+func (r Mongo) withTransaction(fn func(tx *Mongo) error) error {
+	session, err := r.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(r.getContext())
+
+	_, err = session.WithTransaction(
+		r.getContext(),
+		func(sctx mongo.SessionContext) (interface{}, error) {
+			tx := r
+			tx.ctx = sctx
+			return nil, fn(&tx)
+		},
+		options.Transaction().
+			SetReadConcern(readconcern.Snapshot()).
+			SetWriteConcern(writeconcern.New(writeconcern.WMajority())),
+	)
+	return err
+}
+
+func (r Mongo) getLogger() *slog.Logger {
+	return xlogger.FromContext(r.getContext(), r.logger)
+}
+
+func (r Mongo) getContext() context.Context {
+	if r.ctx == nil {
+		return context.Background()
 	}
+	return r.ctx
 }
 
 // GetDB :
-func (r Repository) GetDB() *mongo.Database {
+func (r Mongo) GetDB() *mongo.Database {
 	return r.db
 }
 
 // Create : a generic function to create entity
-func (r Repository) Create(entityName model.Collection, entity interface{}) (*mongo.InsertOneResult, error) {
-	insertResult, err := r.db.Collection(entityName).InsertOne(context.Background(), entity)
+func (r Mongo) Create(entityName model.Collection, entity interface{}) (*mongo.InsertOneResult, error) {
+	insertResult, err := r.db.Collection(entityName).InsertOne(r.getContext(), entity)
 	if err != nil {
 		return nil, err
 	}
@@ -39,41 +231,41 @@ func (r Repository) Create(entityName model.Collection, entity interface{}) (*mo
 }
 
 // FindByID :
-func (r Repository) FindByID(entityName model.Collection, id primitive.ObjectID, v interface{}) error {
+func (r Mongo) FindByID(entityName model.Collection, id primitive.ObjectID, v interface{}) error {
 
 	return r.db.Collection(entityName).FindOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": id},
 	).Decode(v)
 }
 
 // FindByHexID :
-func (r Repository) FindByHexID(entityName model.Collection, hex string, v interface{}) error {
+func (r Mongo) FindByHexID(entityName model.Collection, hex string, v interface{}) error {
 	id, err := primitive.ObjectIDFromHex(hex)
 	if err != nil {
 		return nil
 	}
 
 	return r.db.Collection(entityName).FindOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": id},
 	).Decode(v)
 }
 
 // Delete :
-func (r Repository) Delete(entityName model.Collection, id primitive.ObjectID) error {
+func (r Mongo) Delete(entityName model.Collection, id primitive.ObjectID) error {
 
 	_, err := r.db.Collection(entityName).DeleteOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": id},
 	)
 	return err
 }
 
 // SoftDelete :
-func (r Repository) SoftDelete(entityName model.Collection, id primitive.ObjectID) error {
+func (r Mongo) SoftDelete(entityName model.Collection, id primitive.ObjectID) error {
 	_, err := r.db.Collection(entityName).UpdateOne(
-		context.Background(),
+		r.getContext(),
 		bson.M{"_id": id},
 		bson.M{"$set": bson.M{
 			"deletedAt": time.Now().UTC(),
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sort"
+
+	"xenotification/app/model"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindNotificationsToReseal : the smallest IDs of both collections, as notifications move to the archive keeping
+// theirs
+func (r Mongo) FindNotificationsToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.Notification, error) {
+	notifications := make([]*model.Notification, 0)
+
+	ctx := r.getContext()
+	for _, entityName := range []model.Collection{model.CollectionNotification, model.CollectionNotificationArchive} {
+		nextCursor, err := r.db.Collection(entityName).Find(
+			ctx,
+			bson.M{"_id": bson.M{"$gt": after}, "sealed.keyId": bson.M{"$ne": keyID}},
+			options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for nextCursor.Next(ctx) {
+			tempResult := bson.M{}
+
+			if err := nextCursor.Decode(&tempResult); err != nil {
+				nextCursor.Close(ctx)
+				r.getLogger().Error("entity decode error", slog.Any("error", err))
+				return nil, errors.New("entity decode error")
+			}
+
+			data, err := json.Marshal(tempResult)
+			if err != nil {
+				nextCursor.Close(ctx)
+				r.getLogger().Error("entity marshal error", slog.Any("error", err))
+				return nil, errors.New("entity marshal error")
+			}
+
+			notification := new(model.Notification)
+			if err := json.Unmarshal(data, notification); err != nil {
+				nextCursor.Close(ctx)
+				r.getLogger().Error("entity unmarshal error", slog.Any("error", err))
+				return nil, errors.New("entity unmarshal error")
+			}
+
+			notifications = append(notifications, notification)
+		}
+
+		err = nextCursor.Err()
+		nextCursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].ID.Hex() < notifications[j].ID.Hex()
+	})
+	if int64(len(notifications)) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+// ResealNotification :
+func (r Mongo) ResealNotification(notification *model.Notification, sealed *model.Sealed) error {
+	entityName := model.CollectionNotification
+	if notification.ArchivedAt != nil {
+		entityName = model.CollectionNotificationArchive
+	}
+
+	_, err := r.db.Collection(entityName).UpdateOne(
+		r.getContext(),
+		bson.M{"_id": notification.ID},
+		bson.M{
+			"$set":   bson.M{"sealed": sealed},
+			"$unset": bson.M{"payload": "", "notificationKey": ""},
+		},
+	)
+	return err
+}
+
+// FindNotificationSubscriptionsToReseal :
+func (r Mongo) FindNotificationSubscriptionsToReseal(keyID string, after model.SubscriptionKey, limit int64) ([]*model.NotificationSubscription, error) {
+	notificationSubs := make([]*model.NotificationSubscription, 0)
+
+	// Keys are compared as documents, field by field in the order they are stored, a live key without a mode
+	// coming before the same key in another mode
+	ctx := r.getContext()
+	nextCursor, err := r.db.Collection(model.CollectionNotificationSubscription).Find(
+		ctx,
+		bson.M{"_id": bson.M{"$gt": after}, "sealed.keyId": bson.M{"$ne": keyID}},
+		options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		notificationSub := new(model.NotificationSubscription)
+		if err := nextCursor.Decode(notificationSub); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, errors.New("entity decode error")
+		}
+		notificationSubs = append(notificationSubs, notificationSub)
+	}
+
+	return notificationSubs, nextCursor.Err()
+}
+
+// ResealNotificationSubscription :
+func (r Mongo) ResealNotificationSubscription(id model.SubscriptionKey, sealed *model.Sealed) error {
+	_, err := r.db.Collection(model.CollectionNotificationSubscription).UpdateOne(
+		r.getContext(),
+		bson.M{"_id": id},
+		bson.M{
+			"$set":   bson.M{"sealed": sealed},
+			"$unset": bson.M{"notificationKey": "", "auth": ""},
+		},
+	)
+	return err
+}
+
+// FindNotificationAttemptsToReseal : only attempts that recorded a request body are sealed
+func (r Mongo) FindNotificationAttemptsToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.NotificationAttempt, error) {
+	attempts := make([]*model.NotificationAttempt, 0)
+
+	ctx := r.getContext()
+	query := bson.M{
+		"_id": bson.M{"$gt": after},
+		"$or": bson.A{
+			bson.M{"sealed.keyId": bson.M{"$exists": true, "$ne": keyID}},
+			bson.M{"requestBody": bson.M{"$exists": true, "$ne": ""}},
+		},
+	}
+	for _, entityName := range []model.Collection{model.CollectionNotificationAttempt, model.CollectionNotificationAttemptArchive} {
+		nextCursor, err := r.db.Collection(entityName).Find(ctx, query, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit))
+		if err != nil {
+			return nil, err
+		}
+
+		for nextCursor.Next(ctx) {
+			attempt := new(model.NotificationAttempt)
+			if err := nextCursor.Decode(attempt); err != nil {
+				nextCursor.Close(ctx)
+				r.getLogger().Error("entity decode error", slog.Any("error", err))
+				return nil, errors.New("entity decode error")
+			}
+			attempts = append(attempts, attempt)
+		}
+
+		err = nextCursor.Err()
+		nextCursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].ID.Hex() < attempts[j].ID.Hex()
+	})
+	if int64(len(attempts)) > limit {
+		attempts = attempts[:limit]
+	}
+	return attempts, nil
+}
+
+// ResealNotificationAttempt :
+func (r Mongo) ResealNotificationAttempt(id primitive.ObjectID, sealed *model.Sealed) error {
+	for _, entityName := range []model.Collection{model.CollectionNotificationAttempt, model.CollectionNotificationAttemptArchive} {
+		if _, err := r.db.Collection(entityName).UpdateOne(
+			r.getContext(),
+			bson.M{"_id": id},
+			bson.M{
+				"$set":   bson.M{"sealed": sealed},
+				"$unset": bson.M{"requestBody": ""},
+			},
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindClientCertificatesToReseal :
+func (r Mongo) FindClientCertificatesToReseal(keyID string, after primitive.ObjectID, limit int64) ([]*model.ClientCertificate, error) {
+	certs := make([]*model.ClientCertificate, 0)
+
+	ctx := r.getContext()
+	nextCursor, err := r.db.Collection(model.CollectionClientCertificate).Find(
+		ctx,
+		bson.M{"_id": bson.M{"$gt": after}, "sealed.keyId": bson.M{"$ne": keyID}},
+		options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		cert := new(model.ClientCertificate)
+		if err := nextCursor.Decode(cert); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, errors.New("entity decode error")
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nextCursor.Err()
+}
+
+// ResealClientCertificate :
+func (r Mongo) ResealClientCertificate(id primitive.ObjectID, sealed *model.Sealed) error {
+	_, err := r.db.Collection(model.CollectionClientCertificate).UpdateOne(
+		r.getContext(),
+		bson.M{"_id": id},
+		bson.M{
+			"$set":   bson.M{"sealed": sealed},
+			"$unset": bson.M{"privateKey": ""},
+		},
+	)
+	return err
+}
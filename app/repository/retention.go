@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"time"
+
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ArchiveNotifications :
+func (r Mongo) ArchiveNotifications(scope MerchantScope, before time.Time, retryAttempts uint, limit int64) (int64, error) {
+	query := scope.query()
+	query["$or"] = bson.A{
+		bson.M{"status": bson.M{"$in": types.ArchivableNotificationStatuses}},
+		bson.M{"status": types.NotificationStatusFailed, "attemptNo": bson.M{"$gte": retryAttempts}},
+	}
+	query["updatedAt"] = bson.M{"$lte": before}
+
+	ids, err := r.findIDs(model.CollectionNotification, query, limit)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	err = r.withTransaction(func(tx *Mongo) error {
+		now := time.Now().UTC()
+
+		if err := tx.copyDocuments(model.CollectionNotificationAttempt, model.CollectionNotificationAttemptArchive, bson.M{"notificationId": bson.M{"$in": ids}}, now); err != nil {
+			return err
+		}
+		if err := tx.copyDocuments(model.CollectionNotification, model.CollectionNotificationArchive, bson.M{"_id": bson.M{"$in": ids}}, now); err != nil {
+			return err
+		}
+
+		if _, err := tx.db.Collection(model.CollectionNotificationAttempt).DeleteMany(tx.getContext(), bson.M{"notificationId": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+		_, err := tx.db.Collection(model.CollectionNotification).DeleteMany(tx.getContext(), bson.M{"_id": bson.M{"$in": ids}})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
+
+// PurgeArchivedNotifications :
+func (r Mongo) PurgeArchivedNotifications(scope MerchantScope, before time.Time, limit int64) (int64, error) {
+	query := scope.query()
+	query["updatedAt"] = bson.M{"$lte": before}
+
+	ids, err := r.findIDs(model.CollectionNotificationArchive, query, limit)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	// Attempts go first, a purge interrupted halfway is finished by the next run
+	if _, err := r.db.Collection(model.CollectionNotificationAttemptArchive).DeleteMany(r.getContext(), bson.M{"notificationId": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+
+	result, err := r.db.Collection(model.CollectionNotificationArchive).DeleteMany(r.getContext(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (s MerchantScope) query() bson.M {
+	query := bson.M{"mode": modeQuery(s.Mode)}
+
+	merchantID := bson.M{}
+	if len(s.MerchantIDs) > 0 {
+		merchantID["$in"] = s.MerchantIDs
+	}
+	if len(s.ExcludeMerchantIDs) > 0 {
+		merchantID["$nin"] = s.ExcludeMerchantIDs
+	}
+	if len(merchantID) > 0 {
+		query["merchantId"] = merchantID
+	}
+
+	return query
+}
+
+func (r Mongo) findIDs(entityName model.Collection, query bson.M, limit int64) ([]primitive.ObjectID, error) {
+	ctx := r.getContext()
+
+	cursor, err := r.db.Collection(entityName).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit).SetSort(bson.M{"updatedAt": 1}).SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+// copyDocuments : copies the matching documents as they are, stamped with archivedAt. Replacing by _id
+// keeps it idempotent when the transaction is retried.
+func (r Mongo) copyDocuments(from, to model.Collection, query bson.M, archivedAt time.Time) error {
+	ctx := r.getContext()
+
+	cursor, err := r.db.Collection(from).Find(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, len(docs))
+	for i, doc := range docs {
+		doc["archivedAt"] = archivedAt
+		writes[i] = mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": doc["_id"]}).SetReplacement(doc).SetUpsert(true)
+	}
+
+	_, err = r.db.Collection(to).BulkWrite(ctx, writes)
+	return err
+}
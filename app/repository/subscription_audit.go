@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"xenotification/app/model"
+	"xenotification/app/types"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateSubscriptionAudit :
+func (r Mongo) CreateSubscriptionAudit(audit *model.SubscriptionAudit) error {
+	_, err := r.db.Collection(model.CollectionSubscriptionAudit).InsertOne(r.getContext(), audit)
+	return err
+}
+
+// FindSubscriptionAudits :
+func (r Mongo) FindSubscriptionAudits(merchantID string, mode types.Mode, typ string, cursor string, limit int64) ([]*model.SubscriptionAudit, string, error) {
+	audits := make([]*model.SubscriptionAudit, 0)
+
+	ctx := r.getContext()
+	query := bson.M{
+		"merchantId": merchantID,
+		"mode":       modeQuery(mode),
+	}
+	if typ != "" {
+		query["type"] = typ
+	}
+
+	if limit <= 0 {
+		limit = 50
+	}
+
+	currentSkip := int64(0)
+
+	if cursor != "" {
+		data, err := hex.DecodeString(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		currentSkip, err = strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	nextCursor, err := r.db.Collection(model.CollectionSubscriptionAudit).Find(
+		ctx,
+		query,
+		options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+			SetLimit(limit+1).
+			SetSkip(currentSkip),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		audit := new(model.SubscriptionAudit)
+		if err := nextCursor.Decode(audit); err != nil {
+			r.getLogger().Error("entity decode error", slog.Any("error", err))
+			return nil, "", errors.New("entity decode error")
+		}
+		audits = append(audits, audit)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(audits) > int(limit) {
+		return audits[:len(audits)-1], hex.EncodeToString([]byte(fmt.Sprintf("%d", currentSkip+limit))), nil
+	}
+
+	return audits, "", nil
+}
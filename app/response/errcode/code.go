@@ -13,6 +13,16 @@ const (
 	NotificationError           = "NOTIFICATION_ERROR"
 	NotificationAttemptNotFound = "NOTIFICATION_ATTEMPT_NOT_EXIST"
 	TooManyRequests             = "TOO_MANY_REQUESTS"
+	ServerShuttingDown          = "SERVER_SHUTTING_DOWN"
+	EncryptionDisabled          = "ENCRYPTION_DISABLED"
+	IdempotencyKeyReused        = "IDEMPOTENCY_KEY_REUSED"
+	IdempotencyKeyInUse         = "IDEMPOTENCY_KEY_IN_USE"
+	ClientCertificateNotFound   = "CLIENT_CERTIFICATE_NOT_FOUND"
+	ClientCertificateInUse      = "CLIENT_CERTIFICATE_IN_USE"
+	TransformError              = "TRANSFORM_ERROR"
+	SubscriptionNotVerified     = "SUBSCRIPTION_NOT_VERIFIED"
+	NotificationLocked          = "NOTIFICATION_LOCKED"
+	SubscriptionNotActive       = "SUBSCRIPTION_NOT_ACTIVE"
 
 	// Validation error
 	OnlyFailedNotificationCanRetry = "ONLY_FAILED_NOTIFICATION_CAN_RETRY"
@@ -31,5 +41,15 @@ func init() {
 	Message.Store(NotificationError, "Notification error")
 	Message.Store(NotificationAttemptNotFound, "Notification attempt not exist")
 	Message.Store(TooManyRequests, "Too many requests, please try again later")
+	Message.Store(ServerShuttingDown, "Server is shutting down, please try again")
+	Message.Store(EncryptionDisabled, "Encryption at rest is not configured")
+	Message.Store(IdempotencyKeyReused, "Idempotency key was already used with a different request")
+	Message.Store(IdempotencyKeyInUse, "A request with this idempotency key is in progress, please try again")
+	Message.Store(ClientCertificateNotFound, "Client certificate not found")
+	Message.Store(ClientCertificateInUse, "Client certificate is used by a subscription")
+	Message.Store(TransformError, "Payload could not be transformed")
+	Message.Store(SubscriptionNotVerified, "Subscription endpoint is pending verification")
+	Message.Store(NotificationLocked, "A notification is being delivered, please try again")
+	Message.Store(SubscriptionNotActive, "Subscription is paused or disabled")
 	Message.Store(OnlyFailedNotificationCanRetry, "Only failed notification can be retried")
 }
@@ -0,0 +1,41 @@
+package transformer
+
+import (
+	"fmt"
+	"time"
+
+	"xenotification/app/model"
+)
+
+// ClientCertificate : the private key is never returned
+type ClientCertificate struct {
+	ID          string    `json:"id"`
+	MerchantID  string    `json:"merchantId"`
+	Subject     string    `json:"subject"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"notAfter"`
+	Expired     bool      `json:"expired"`
+	Warnings    []string  `json:"warnings,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ToClientCertificate : warns when the certificate expires within expiryWarning
+func ToClientCertificate(i *model.ClientCertificate, expiryWarning time.Duration) (o ClientCertificate) {
+	now := time.Now().UTC()
+
+	o.ID = i.ID.Hex()
+	o.MerchantID = i.MerchantID
+	o.Subject = i.Subject
+	o.Fingerprint = i.Fingerprint
+	o.NotAfter = i.NotAfter
+	o.Expired = !now.Before(i.NotAfter)
+	switch {
+	case o.Expired:
+		o.Warnings = append(o.Warnings, fmt.Sprintf("client certificate %s expired at %s", o.ID, i.NotAfter.Format(time.RFC3339)))
+	case now.Add(expiryWarning).After(i.NotAfter):
+		o.Warnings = append(o.Warnings, fmt.Sprintf("client certificate %s expires at %s", o.ID, i.NotAfter.Format(time.RFC3339)))
+	}
+	o.CreatedAt = i.CreatedAt
+
+	return
+}
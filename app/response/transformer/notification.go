@@ -12,13 +12,16 @@ type Notification struct {
 	ID              string                   `json:"id"`
 	MerchantID      string                   `json:"merchantId"`
 	Type            string                   `json:"type"`
+	Mode            types.Mode               `json:"mode"`
 	NotificationURL string                   `json:"notificationUrl"`
 	NotificationKey string                   `json:"notificationKey"`
+	PayloadFormat   types.PayloadFormat      `json:"payloadFormat"`
 	RequestID       string                   `json:"requestID"`
 	Payload         interface{}              `json:"payload"`
 	Status          types.NotificationStatus `json:"status"`
 	AttemptNo       uint                     `json:"attemptNo"`
 	SentAt          *time.Time               `json:"sentAt,omitempty"`
+	ArchivedAt      *time.Time               `json:"archivedAt,omitempty"`
 	CreatedAt       time.Time                `json:"createdAt"`
 	UpdatedAt       time.Time                `json:"updatedAt"`
 }
@@ -28,50 +31,83 @@ type NotificationWithAttempt struct {
 	ID              string                   `json:"id"`
 	MerchantID      string                   `json:"merchantId"`
 	Type            string                   `json:"type"`
+	Mode            types.Mode               `json:"mode"`
 	NotificationURL string                   `json:"notificationUrl"`
 	NotificationKey string                   `json:"notificationKey"`
+	PayloadFormat   types.PayloadFormat      `json:"payloadFormat"`
 	RequestID       string                   `json:"requestID"`
 	Payload         interface{}              `json:"payload"`
 	Status          types.NotificationStatus `json:"status"`
 	StatusCode      int                      `json:"statusCode"`
 	AttemptNo       uint                     `json:"attemptNo"`
+	RequestBody     string                   `json:"requestBody,omitempty"`
 	SentAt          *time.Time               `json:"sentAt,omitempty"`
+	ArchivedAt      *time.Time               `json:"archivedAt,omitempty"`
 	CreatedAt       time.Time                `json:"createdAt"`
 	UpdatedAt       time.Time                `json:"updatedAt"`
 }
 
 // ToNotification :
-func ToNotification(i *model.Notification) (o Notification) {
+func ToNotification(i *model.Notification, opener Opener) (o Notification, err error) {
+	if i, err = openNotification(i, opener); err != nil {
+		return
+	}
+
 	o.ID = i.ID.Hex()
 	o.MerchantID = i.MerchantID
 	o.Type = i.Type
+	o.Mode = mode(i.Mode)
 	o.NotificationURL = i.NotificationURL
 	o.NotificationKey = i.NotificationKey
+	o.PayloadFormat = payloadFormat(i.PayloadFormat)
 	o.RequestID = i.RequestID
 	o.Payload = i.Payload
 	o.Status = i.Status
 	o.AttemptNo = i.AttemptNo
 	o.SentAt = i.AttemptedAt
+	o.ArchivedAt = i.ArchivedAt
 	o.CreatedAt = i.CreatedAt
 	o.UpdatedAt = i.UpdatedAt
 	return
 }
 
-// ToNotificationWithAttempt :
-func ToNotificationWithAttempt(i *model.Notification, j *model.NotificationAttempt) (o NotificationWithAttempt) {
+// ToNotificationWithAttempt : an archived notification comes without its attempt, the notification's outcome is
+// shown instead
+func ToNotificationWithAttempt(i *model.Notification, j *model.NotificationAttempt, opener Opener) (o NotificationWithAttempt, err error) {
+	if i, err = openNotification(i, opener); err != nil {
+		return
+	}
+	if j == nil {
+		j = &model.NotificationAttempt{Status: i.Status, AttemptNo: i.AttemptNo, SentAt: i.AttemptedAt}
+	} else if j, err = openNotificationAttempt(j, opener); err != nil {
+		return
+	}
+
 	o.ID = i.ID.Hex()
 	o.MerchantID = i.MerchantID
 	o.Type = i.Type
+	o.Mode = mode(i.Mode)
 	o.NotificationURL = i.NotificationURL
 	o.NotificationKey = i.NotificationKey
+	o.PayloadFormat = payloadFormat(i.PayloadFormat)
 	o.RequestID = i.RequestID
 	o.Payload = i.Payload
+	o.RequestBody = j.RequestBody
 	o.Status = j.Status
 	o.StatusCode = j.StatusCode
 	o.AttemptNo = j.AttemptNo
 	o.SentAt = j.SentAt
+	o.ArchivedAt = i.ArchivedAt
 	o.CreatedAt = i.CreatedAt
 	o.UpdatedAt = i.UpdatedAt
 
 	return
 }
+
+// mode : live is stored empty
+func mode(m types.Mode) types.Mode {
+	if m == "" {
+		return types.ModeLive
+	}
+	return m
+}
@@ -1,31 +1,192 @@
 package transformer
 
 import (
+	"fmt"
+	"net/http"
 	"time"
 
 	"xenotification/app/model"
+	"xenotification/app/types"
 )
 
 // NotificationSubscription :
 type NotificationSubscription struct {
-	MerchantID            string    `json:"merchantId"`
-	Type                  string    `json:"type"`
-	NotificationURL       string    `json:"notificationUrl"`
-	NotificationKey       string    `json:"notificationKey"`
-	AcceptableStatusCodes []int     `json:"acceptableStatusCodes"`
-	CreatedAt             time.Time `json:"createdAt"`
-	UpdatedAt             time.Time `json:"updatedAt"`
+	MerchantID            string                   `json:"merchantId"`
+	Type                  string                   `json:"type"`
+	Mode                  types.Mode               `json:"mode"`
+	NotificationURL       string                   `json:"notificationUrl"`
+	NotificationKey       string                   `json:"notificationKey"`
+	AcceptableStatusCodes []int                    `json:"acceptableStatusCodes"`
+	Status                types.SubscriptionStatus `json:"status"`
+	VerifiedAt            *time.Time               `json:"verifiedAt,omitempty"`
+	DisabledAt            *time.Time               `json:"disabledAt,omitempty"`
+	DisabledReason        string                   `json:"disabledReason,omitempty"`
+	ConsecutiveFailures   int                      `json:"consecutiveFailures"`
+	FailingSince          *time.Time               `json:"failingSince,omitempty"`
+	LastSuccessAt         *time.Time               `json:"lastSuccessAt,omitempty"`
+	PayloadFormat         types.PayloadFormat      `json:"payloadFormat"`
+	Method                string                   `json:"method"`
+	BodyEncoding          types.BodyEncoding       `json:"bodyEncoding"`
+	ContentType           string                   `json:"contentType,omitempty"`
+	Gzip                  bool                     `json:"gzip"`
+	HTTPOptions           *HTTPOptions             `json:"httpOptions,omitempty"`
+	Auth                  *SubscriptionAuth        `json:"auth,omitempty"`
+	Transform             *PayloadTransform        `json:"transform,omitempty"`
+	Filters               []SubscriptionFilter     `json:"filters,omitempty"`
+	ClientCertificate     *ClientCertificate       `json:"clientCertificate,omitempty"`
+	Warnings              []string                 `json:"warnings,omitempty"`
+	CreatedAt             time.Time                `json:"createdAt"`
+	UpdatedAt             time.Time                `json:"updatedAt"`
+}
+
+// HTTPOptions :
+type HTTPOptions struct {
+	TimeoutMs       int64  `json:"timeoutMs,omitempty"`
+	MaxResponseSize int64  `json:"maxResponseSize,omitempty"`
+	MaxRedirects    *int   `json:"maxRedirects,omitempty"`
+	ProxyURL        string `json:"proxyUrl,omitempty"`
+	CABundle        string `json:"caBundle,omitempty"`
+	ServerCA        string `json:"serverCa,omitempty"`
+}
+
+// PayloadTransform :
+type PayloadTransform struct {
+	Type       types.TransformType `json:"type"`
+	Template   string              `json:"template,omitempty"`
+	Projection map[string]string   `json:"projection,omitempty"`
+}
+
+// SubscriptionFilter :
+type SubscriptionFilter struct {
+	Field    string               `json:"field"`
+	Operator types.FilterOperator `json:"operator"`
+	Value    interface{}          `json:"value,omitempty"`
+}
+
+// SubscriptionAuth : secrets are masked, only whether they are set is shown
+type SubscriptionAuth struct {
+	Type         types.AuthType    `json:"type"`
+	Username     string            `json:"username,omitempty"`
+	Password     string            `json:"password,omitempty"`
+	Token        string            `json:"token,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	TokenURL     string            `json:"tokenUrl,omitempty"`
+	ClientID     string            `json:"clientId,omitempty"`
+	ClientSecret string            `json:"clientSecret,omitempty"`
+	Scopes       []string          `json:"scopes,omitempty"`
+}
+
+// maskedSecret : replaces every secret whatever its length
+const maskedSecret = "********"
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return maskedSecret
 }
 
 // ToNotificationSubscription :
-func ToNotificationSubscription(i *model.NotificationSubscription) (o NotificationSubscription) {
+func ToNotificationSubscription(i *model.NotificationSubscription, opener Opener) (o NotificationSubscription, err error) {
+	if i, err = openNotificationSubscription(i, opener); err != nil {
+		return
+	}
+
 	o.MerchantID = i.ID.MerchantID
 	o.Type = i.ID.Type
+	o.Mode = mode(i.ID.Mode)
 	o.NotificationURL = i.NotificationURL
 	o.NotificationKey = i.NotificationKey
 	o.AcceptableStatusCodes = i.AcceptableStatusCodes
+	o.Status = i.Status
+	if o.Status == "" {
+		o.Status = types.SubscriptionStatusActive
+	}
+	o.VerifiedAt = i.VerifiedAt
+	o.DisabledAt = i.DisabledAt
+	o.DisabledReason = i.DisabledReason
+	o.ConsecutiveFailures = i.ConsecutiveFailures
+	o.FailingSince = i.FailingSince
+	o.LastSuccessAt = i.LastSuccessAt
+	o.PayloadFormat = payloadFormat(i.PayloadFormat)
+	o.Method = i.Method
+	if o.Method == "" {
+		o.Method = http.MethodPost
+	}
+	o.BodyEncoding = i.BodyEncoding
+	if o.BodyEncoding == "" {
+		o.BodyEncoding = types.BodyEncodingJSON
+	}
+	o.ContentType = i.ContentType
+	o.Gzip = i.Gzip
+	if i.HTTPOptions != nil {
+		o.HTTPOptions = &HTTPOptions{
+			TimeoutMs:       i.HTTPOptions.Timeout.Milliseconds(),
+			MaxResponseSize: i.HTTPOptions.MaxResponseSize,
+			MaxRedirects:    i.HTTPOptions.MaxRedirects,
+			ProxyURL:        i.HTTPOptions.ProxyURL,
+			CABundle:        i.HTTPOptions.CABundle,
+			ServerCA:        i.HTTPOptions.ServerCA,
+		}
+	}
+	if i.Auth != nil {
+		o.Auth = &SubscriptionAuth{
+			Type:         i.Auth.Type,
+			Username:     i.Auth.Username,
+			Password:     mask(i.Auth.Password),
+			Token:        mask(i.Auth.Token),
+			TokenURL:     i.Auth.TokenURL,
+			ClientID:     i.Auth.ClientID,
+			ClientSecret: mask(i.Auth.ClientSecret),
+			Scopes:       i.Auth.Scopes,
+		}
+		if len(i.Auth.Headers) > 0 {
+			o.Auth.Headers = make(map[string]string, len(i.Auth.Headers))
+			for name, value := range i.Auth.Headers {
+				o.Auth.Headers[name] = mask(value)
+			}
+		}
+	}
+	if i.Transform != nil {
+		o.Transform = &PayloadTransform{
+			Type:       i.Transform.Type,
+			Template:   i.Transform.Template,
+			Projection: i.Transform.Projection,
+		}
+	}
+	for _, each := range i.Filters {
+		o.Filters = append(o.Filters, SubscriptionFilter{
+			Field:    each.Field,
+			Operator: each.Operator,
+			Value:    each.Value,
+		})
+	}
 	o.CreatedAt = i.CreatedAt
 	o.UpdatedAt = i.UpdatedAt
 
 	return
 }
+
+// WithClientCertificate : adds the certificate the subscription presents, nil when it no longer exists,
+// and raises its warnings to the subscription
+func (o *NotificationSubscription) WithClientCertificate(i *model.NotificationSubscription, cert *model.ClientCertificate, expiryWarning time.Duration) {
+	if i.ClientCertificateID == nil {
+		return
+	}
+
+	if cert == nil {
+		o.Warnings = append(o.Warnings, fmt.Sprintf("client certificate %s no longer exists", i.ClientCertificateID.Hex()))
+		return
+	}
+
+	formatted := ToClientCertificate(cert, expiryWarning)
+	o.ClientCertificate = &formatted
+	o.Warnings = append(o.Warnings, formatted.Warnings...)
+}
+
+// WithVerificationError : raises why the endpoint failed the verification challenge, if it did
+func (o *NotificationSubscription) WithVerificationError(err error) {
+	if err != nil {
+		o.Warnings = append(o.Warnings, fmt.Sprintf("endpoint verification failed: %s", err))
+	}
+}
@@ -0,0 +1,39 @@
+package transformer
+
+import "xenotification/app/model"
+
+// Opener : decrypts the fields sealed at rest. The transformers leave those fields out when the Opener is nil,
+// which is what callers not allowed to see them get.
+type Opener interface {
+	OpenNotification(n *model.Notification) (*model.Notification, error)
+	OpenNotificationSubscription(s *model.NotificationSubscription) (*model.NotificationSubscription, error)
+	OpenNotificationAttempt(a *model.NotificationAttempt) (*model.NotificationAttempt, error)
+}
+
+func openNotification(i *model.Notification, opener Opener) (*model.Notification, error) {
+	if opener == nil {
+		redacted := *i
+		redacted.Payload = nil
+		redacted.NotificationKey = ""
+		return &redacted, nil
+	}
+	return opener.OpenNotification(i)
+}
+
+func openNotificationSubscription(i *model.NotificationSubscription, opener Opener) (*model.NotificationSubscription, error) {
+	if opener == nil {
+		redacted := *i
+		redacted.NotificationKey = ""
+		return &redacted, nil
+	}
+	return opener.OpenNotificationSubscription(i)
+}
+
+func openNotificationAttempt(i *model.NotificationAttempt, opener Opener) (*model.NotificationAttempt, error) {
+	if opener == nil {
+		redacted := *i
+		redacted.RequestBody = ""
+		return &redacted, nil
+	}
+	return opener.OpenNotificationAttempt(i)
+}
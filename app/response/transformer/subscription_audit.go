@@ -0,0 +1,191 @@
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"xenotification/app/model"
+	"xenotification/app/types"
+)
+
+// SubscriptionAudit :
+type SubscriptionAudit struct {
+	ID         string               `json:"id"`
+	MerchantID string               `json:"merchantId"`
+	Type       string               `json:"type"`
+	Mode       types.Mode           `json:"mode"`
+	Action     types.AuditAction    `json:"action"`
+	Actor      string               `json:"actor"`
+	SourceIP   string               `json:"sourceIp,omitempty"`
+	Changes    []SubscriptionChange `json:"changes"`
+	CreatedAt  time.Time            `json:"createdAt"`
+}
+
+// SubscriptionChange : before is left out for a field which was not set, after for one which is no longer set
+type SubscriptionChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// ToSubscriptionAudit :
+func ToSubscriptionAudit(i *model.SubscriptionAudit) (o SubscriptionAudit) {
+	o.ID = i.ID.Hex()
+	o.MerchantID = i.MerchantID
+	o.Type = i.Type
+	o.Mode = mode(i.Mode)
+	o.Action = i.Action
+	o.Actor = i.Actor
+	o.SourceIP = i.SourceIP
+	o.Changes = make([]SubscriptionChange, len(i.Changes))
+	for n, each := range i.Changes {
+		o.Changes[n].Field = each.Field
+		if each.Before != "" {
+			o.Changes[n].Before = json.RawMessage(each.Before)
+		}
+		if each.After != "" {
+			o.Changes[n].After = json.RawMessage(each.After)
+		}
+	}
+	o.CreatedAt = i.CreatedAt
+
+	return
+}
+
+// notAudited : fields which change without anyone changing the subscription's settings
+var notAudited = map[string]bool{
+	"notificationKey":     true, // Compared on its own, the snapshot never holds it
+	"consecutiveFailures": true,
+	"failingSince":        true,
+	"lastSuccessAt":       true,
+	"warnings":            true,
+	"createdAt":           true,
+	"updatedAt":           true,
+}
+
+// SubscriptionChanges : the fields which differ between the opened subscriptions as the API shows them, with the
+// secrets masked. before is nil for a created subscription, after for a deleted one. The notification key is
+// never shown, only that it changed.
+func SubscriptionChanges(before, after *model.NotificationSubscription) ([]model.SubscriptionChange, error) {
+	previous, err := auditSnapshot(before)
+	if err != nil {
+		return nil, err
+	}
+	current, err := auditSnapshot(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(previous)+len(current))
+	for field := range previous {
+		fields = append(fields, field)
+	}
+	for field := range current {
+		if _, ok := previous[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]model.SubscriptionChange, 0)
+	for _, field := range fields {
+		if notAudited[field] {
+			continue
+		}
+
+		// Masked secrets look the same before and after, the change is still recorded
+		changed := !bytes.Equal(previous[field], current[field])
+		if field == "auth" && before != nil && after != nil {
+			changed = changed || !reflect.DeepEqual(before.Auth, after.Auth)
+		}
+		if field == "httpOptions" && before != nil && after != nil {
+			changed = changed || proxyURL(before) != proxyURL(after)
+		}
+
+		if changed {
+			changes = append(changes, model.SubscriptionChange{
+				Field:  field,
+				Before: string(previous[field]),
+				After:  string(current[field]),
+			})
+		}
+	}
+
+	var previousKey, currentKey string
+	if before != nil {
+		previousKey = before.NotificationKey
+	}
+	if after != nil {
+		currentKey = after.NotificationKey
+	}
+	if previousKey != currentKey {
+		change := model.SubscriptionChange{Field: "notificationKey"}
+		if previousKey != "" {
+			change.Before = `"` + maskedSecret + `"`
+		}
+		if currentKey != "" {
+			change.After = `"` + maskedSecret + `"`
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// auditSnapshot : the subscription's fields as the API shows them, JSON encoded, leaving out those which are not set
+func auditSnapshot(i *model.NotificationSubscription) (map[string]json.RawMessage, error) {
+	snapshot := make(map[string]json.RawMessage)
+	if i == nil {
+		return snapshot, nil
+	}
+
+	o, err := ToNotificationSubscription(i, nil)
+	if err != nil {
+		return nil, err
+	}
+	if o.HTTPOptions != nil {
+		options := *o.HTTPOptions
+		options.ProxyURL = maskUserinfo(options.ProxyURL)
+		o.HTTPOptions = &options
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+
+	for field, value := range snapshot {
+		if string(value) == "null" || string(value) == `""` {
+			delete(snapshot, field)
+		}
+	}
+	return snapshot, nil
+}
+
+// maskUserinfo : the proxy's credentials, if the URL has any, are masked
+func maskUserinfo(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return maskedSecret
+	} else if u.User == nil {
+		return rawURL
+	}
+	// Set through url.User, the mask would come out escaped
+	u.User = nil
+	return strings.Replace(u.String(), "//", "//"+maskedSecret+"@", 1)
+}
+
+func proxyURL(i *model.NotificationSubscription) string {
+	if i.HTTPOptions == nil {
+		return ""
+	}
+	return i.HTTPOptions.ProxyURL
+}
@@ -0,0 +1,116 @@
+package transformer
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"xenotification/app/constant"
+	"xenotification/app/kit/bodyencoding"
+	httprequest "xenotification/app/kit/httpRequest"
+	"xenotification/app/model"
+	"xenotification/app/types"
+)
+
+// WebhookEnvelope : the body sent to subscriptions using the envelope payload format
+type WebhookEnvelope struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// ToWebhookEnvelope : i must be opened
+func ToWebhookEnvelope(i *model.Notification) (o WebhookEnvelope) {
+	o.ID = i.ID.Hex()
+	o.Type = i.Type
+	o.CreatedAt = i.CreatedAt
+	o.Data = i.Payload
+
+	return
+}
+
+// payloadFormat : records stored before formats existed are sent raw
+func payloadFormat(format types.PayloadFormat) types.PayloadFormat {
+	if format == "" {
+		return types.PayloadFormatRaw
+	}
+	return format
+}
+
+// WebhookExchange : the webhook request a simulation sent and the response it got, either is nil when the
+// simulation got no further
+type WebhookExchange struct {
+	Request    *WebhookRequest  `json:"request"`
+	Response   *WebhookResponse `json:"response"`
+	DurationMs int64            `json:"durationMs"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// WebhookRequest : the body is shown before compression
+type WebhookRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// WebhookResponse : the body is cut to the maximum response size, truncated says whether it was
+type WebhookResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	Truncated  bool              `json:"truncated,omitempty"`
+}
+
+// ToWebhookExchange : the credentials auth put on the request are masked, and so are the notification key and
+// the body, which carries the payload, when the opener is nil
+func ToWebhookExchange(i *httprequest.Exchange, auth *model.SubscriptionAuth, attempt *model.NotificationAttempt, opener Opener) (o WebhookExchange) {
+	if attempt != nil && attempt.Error != nil {
+		o.Error = *attempt.Error
+	}
+	if i == nil || i.Method == "" {
+		return
+	}
+
+	secret := map[string]bool{"authorization": true}
+	if opener == nil {
+		secret[strings.ToLower(constant.HeaderWebhookKey)] = true
+	}
+	if auth != nil {
+		for name := range auth.Headers {
+			secret[strings.ToLower(name)] = true
+		}
+	}
+
+	o.Request = &WebhookRequest{Method: i.Method, URL: i.URL, Headers: make(map[string]string, len(i.RequestHeaders))}
+	for name, value := range i.RequestHeaders {
+		if secret[strings.ToLower(name)] {
+			value = mask(value)
+		}
+		o.Request.Headers[name] = value
+	}
+
+	body := i.RequestBody
+	if strings.EqualFold(i.RequestHeaders["Content-Encoding"], "gzip") {
+		if decompressed, err := bodyencoding.Gunzip(body); err == nil {
+			body = decompressed
+		}
+	}
+	o.Request.Body = string(body)
+	if opener == nil {
+		o.Request.Body = mask(o.Request.Body)
+	}
+	o.DurationMs = i.Duration.Milliseconds()
+
+	if i.StatusCode == 0 {
+		return
+	}
+
+	o.Response = &WebhookResponse{StatusCode: i.StatusCode, Headers: make(map[string]string, len(i.ResponseHeaders)), Body: string(i.ResponseBody), Truncated: i.ResponseTruncated}
+	for name, values := range i.ResponseHeaders {
+		o.Response.Headers[http.CanonicalHeaderKey(name)] = strings.Join(values, ", ")
+	}
+
+	return
+}
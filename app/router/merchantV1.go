@@ -8,20 +8,35 @@ import (
 func merchantV1(e *echo.Echo, r *Router) {
 	h := r.handler
 	mw := r.apiMiddleware
-	v1 := e.Group("/v1", mw.OpenTracing("notification"))
+	v1 := e.Group("/v1", mw.OpenTelemetry("notification"))
 
 	cronRoute := v1.Group("/cron")
 	cronRoute.POST("/resend-notification", h.CronSendNotification)
+	cronRoute.POST("/recover-notification", h.CronRecoverNotification)
+	cronRoute.POST("/archive-notification", h.CronArchiveNotification)
+	cronRoute.POST("/rotate-encryption-key", h.CronRotateEncryptionKey)
 
 	subscriptionRoute := v1.Group("/subscription")
 	subscriptionRoute.GET("s", h.GetSubscriptions)
+	subscriptionRoute.GET("/audits", h.GetSubscriptionAudits)
 	subscriptionRoute.PUT("", h.UpsertSubscription)
 	subscriptionRoute.DELETE("", h.DeleteSubscription)
+	subscriptionRoute.POST("/preview", h.PreviewSubscription)
+	subscriptionRoute.POST("/pause", h.PauseSubscription)
+	subscriptionRoute.POST("/resume", h.ResumeSubscription)
+	subscriptionRoute.POST("/disable", h.DisableSubscription)
+	subscriptionRoute.POST("/verify", h.VerifySubscription)
+	subscriptionRoute.POST("/rotate-key", h.RotateSubscriptionKey)
+
+	clientCertificateRoute := v1.Group("/client-certificate")
+	clientCertificateRoute.GET("s", h.GetClientCertificates)
+	clientCertificateRoute.POST("", h.UploadClientCertificate)
+	clientCertificateRoute.DELETE("", h.DeleteClientCertificate)
 
 	notificationRoute := v1.Group("/notify")
 	notificationRoute.GET("s", h.GetNotifications)
-	notificationRoute.POST("", h.SendNotification)
-	notificationRoute.POST("/resend", h.ResendNotification)
+	notificationRoute.POST("", h.SendNotification, mw.Idempotency())
+	notificationRoute.POST("/resend", h.ResendNotification, mw.Idempotency())
 	notificationRoute.POST("/simulate", h.SimulateNotification, mw.APIRateLimit(3))
 
 	mockRoute := v1.Group("/mock")
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"context"
+
 	"xenotification/app/bootstrap"
 	"xenotification/app/handler"
 	midware "xenotification/app/middleware"
@@ -15,12 +17,28 @@ type Router struct {
 }
 
 // New :
-func New(e *echo.Echo, bs *bootstrap.Bootstrap) {
+func New(e *echo.Echo, bs *bootstrap.Bootstrap) *Router {
 	router := Router{
 		apiMiddleware: midware.New(bs),
 		handler:       handler.New(bs),
 	}
 
+	e.Use(router.apiMiddleware.RequestLogger())
+
 	e.GET("/health", router.handler.APIHealthCheck)
+	e.GET("/livez", router.handler.APILiveness)
+	e.GET("/readyz", router.handler.APIReadiness)
 	merchantV1(e, &router)
+
+	return &router
+}
+
+// Drain : stops accepting new deliveries
+func (r *Router) Drain() {
+	r.handler.Drain()
+}
+
+// Shutdown : waits for in-flight deliveries and releases their locks
+func (r *Router) Shutdown(ctx context.Context) error {
+	return r.handler.Shutdown(ctx)
 }
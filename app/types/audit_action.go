@@ -0,0 +1,19 @@
+package types
+
+// AuditAction : what a subscription audit record is about
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "CREATE"
+	AuditActionUpdate AuditAction = "UPDATE"
+	AuditActionDelete AuditAction = "DELETE"
+	// AuditActionRotate : the subscription's notification key was replaced
+	AuditActionRotate AuditAction = "ROTATE"
+	// AuditActionReseal : the encryption key rotation sealed the subscription's secrets with the active key
+	AuditActionReseal      AuditAction = "RESEAL"
+	AuditActionPause       AuditAction = "PAUSE"
+	AuditActionResume      AuditAction = "RESUME"
+	AuditActionDisable     AuditAction = "DISABLE"
+	AuditActionVerify      AuditAction = "VERIFY"
+	AuditActionAutoDisable AuditAction = "AUTO_DISABLE"
+)
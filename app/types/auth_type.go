@@ -0,0 +1,15 @@
+package types
+
+// AuthType : how webhooks authenticate to the merchant's endpoint on top of the notification key
+type AuthType string
+
+const (
+	// AuthTypeBasic : HTTP Basic with a username and password
+	AuthTypeBasic AuthType = "BASIC"
+	// AuthTypeBearer : a static bearer token
+	AuthTypeBearer AuthType = "BEARER"
+	// AuthTypeHeaders : arbitrary headers set as given
+	AuthTypeHeaders AuthType = "HEADERS"
+	// AuthTypeOAuth2ClientCredentials : a bearer token fetched from the merchant's token URL
+	AuthTypeOAuth2ClientCredentials AuthType = "OAUTH2_CLIENT_CREDENTIALS"
+)
@@ -0,0 +1,15 @@
+package types
+
+// BodyEncoding : how the webhook body is serialized
+type BodyEncoding string
+
+const (
+	// BodyEncodingJSON : the default
+	BodyEncodingJSON BodyEncoding = "JSON"
+	// BodyEncodingForm : application/x-www-form-urlencoded, nested fields as a[b][0]
+	BodyEncodingForm BodyEncoding = "FORM"
+	// BodyEncodingXML : fields as elements under a <notification> root
+	BodyEncodingXML BodyEncoding = "XML"
+	// BodyEncodingRaw : a string payload sent as is
+	BodyEncodingRaw BodyEncoding = "RAW"
+)
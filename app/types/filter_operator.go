@@ -0,0 +1,27 @@
+package types
+
+// FilterOperator : how a subscription filter compares a payload field with its value
+type FilterOperator string
+
+const (
+	// FilterOperatorEquals : the field equals the value, numbers compare by value
+	FilterOperatorEquals FilterOperator = "EQ"
+	// FilterOperatorNotEquals : the field is missing or differs from the value
+	FilterOperatorNotEquals FilterOperator = "NE"
+	// FilterOperatorIn : the field equals one of the values
+	FilterOperatorIn FilterOperator = "IN"
+	// FilterOperatorNotIn : the field is missing or equals none of the values
+	FilterOperatorNotIn FilterOperator = "NOT_IN"
+	// FilterOperatorGreaterThan : the field is a number above the value
+	FilterOperatorGreaterThan FilterOperator = "GT"
+	// FilterOperatorGreaterThanOrEqual : the field is a number at or above the value
+	FilterOperatorGreaterThanOrEqual FilterOperator = "GTE"
+	// FilterOperatorLessThan : the field is a number below the value
+	FilterOperatorLessThan FilterOperator = "LT"
+	// FilterOperatorLessThanOrEqual : the field is a number at or below the value
+	FilterOperatorLessThanOrEqual FilterOperator = "LTE"
+	// FilterOperatorExists : the field is present, null included
+	FilterOperatorExists FilterOperator = "EXISTS"
+	// FilterOperatorNotExists : the field is missing
+	FilterOperatorNotExists FilterOperator = "NOT_EXISTS"
+)
@@ -0,0 +1,11 @@
+package types
+
+// Mode : separates a merchant's test data from their live data, each mode has its own subscriptions
+type Mode string
+
+const (
+	// ModeLive : stored empty, so that everything from before modes is live
+	ModeLive Mode = "LIVE"
+	// ModeTest : for merchants trying out their integration
+	ModeTest Mode = "TEST"
+)
@@ -0,0 +1,11 @@
+package types
+
+// PayloadFormat : how the payload is sent to the merchant
+type PayloadFormat string
+
+const (
+	// PayloadFormatRaw : the payload as received, the default
+	PayloadFormatRaw PayloadFormat = "RAW"
+	// PayloadFormatEnvelope : the payload wrapped as {id, type, createdAt, data}
+	PayloadFormatEnvelope PayloadFormat = "ENVELOPE"
+)
@@ -6,4 +6,17 @@ const (
 	NotificationStatusPending NotificationStatus = "PENDING"
 	NotificationStatusSuccess NotificationStatus = "SUCCESS"
 	NotificationStatusFailed  NotificationStatus = "FAILED"
+	// NotificationStatusFiltered : the subscription's filters rejected the payload, nothing was sent
+	NotificationStatusFiltered NotificationStatus = "FILTERED"
+	// NotificationStatusHeld : stored while the subscription is paused, delivered when it resumes
+	NotificationStatusHeld NotificationStatus = "HELD"
+	// NotificationStatusDropped : held, then discarded when the subscription resumed
+	NotificationStatusDropped NotificationStatus = "DROPPED"
 )
+
+// ArchivableNotificationStatuses : nothing more happens to notifications with these, retention archives them
+var ArchivableNotificationStatuses = []NotificationStatus{
+	NotificationStatusSuccess,
+	NotificationStatusFiltered,
+	NotificationStatusDropped,
+}
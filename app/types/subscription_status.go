@@ -0,0 +1,15 @@
+package types
+
+// SubscriptionStatus : whether a subscription's notifications are delivered
+type SubscriptionStatus string
+
+const (
+	// SubscriptionStatusActive : notifications are delivered, subscriptions stored without a status are active
+	SubscriptionStatusActive SubscriptionStatus = "ACTIVE"
+	// SubscriptionStatusPaused : notifications are stored as held and delivered on resume
+	SubscriptionStatusPaused SubscriptionStatus = "PAUSED"
+	// SubscriptionStatusDisabled : notifications are neither stored nor delivered, as if there was no subscription
+	SubscriptionStatusDisabled SubscriptionStatus = "DISABLED"
+	// SubscriptionStatusPendingVerification : like disabled until the endpoint answers the verification challenge
+	SubscriptionStatusPendingVerification SubscriptionStatus = "PENDING_VERIFICATION"
+)
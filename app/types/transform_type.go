@@ -0,0 +1,11 @@
+package types
+
+// TransformType : how a subscription reshapes the body before it is encoded
+type TransformType string
+
+const (
+	// TransformTypeTemplate : a Go text/template rendering the body
+	TransformTypeTemplate TransformType = "TEMPLATE"
+	// TransformTypeProjection : output fields picked from the body with paths like $.data.items[0].id
+	TransformTypeProjection TransformType = "PROJECTION"
+)
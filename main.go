@@ -4,9 +4,19 @@ import (
 	"os"
 
 	"xenotification/app"
+	"xenotification/app/env"
 )
 
 func main() {
+	if err := env.Load(); err != nil {
+		panic(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		app.Migrate()
+		return
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "7000"